@@ -1,7 +1,9 @@
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -18,31 +20,61 @@ func WriteResponse(status int, body interface{}, w http.ResponseWriter) {
 	w.Write(payload)
 }
 
+//go:embed web/index.html
+var indexPage []byte
+
 // HTTP Handlers
 
-func ReadNote(w http.ResponseWriter, r *http.Request) {
+// Index serves the browser client, which encrypts the notes before
+// posting them and keeps the key in the URL fragment
+func Index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexPage)
+}
+
+type NoteHandlers struct {
+	Backend *backend.Backend
+}
+
+func (h NoteHandlers) ReadNote(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	if data, err := backend.GetKey(id); err == nil {
-		WriteResponse(200, data, w)
+	if note, err := h.Backend.GetNote(id, r.Header.Get("X-Note-Passphrase")); err == nil {
+		if note.Cipher != nil {
+			// encrypted by the client: ciphertext and metadata
+			WriteResponse(200, note, w)
+		} else {
+			WriteResponse(200, note.Text, w)
+		}
 	} else {
-		if err.Error() == "not found" {
+		if errors.Is(err, db.ErrNotFound) {
 			WriteResponse(404, "Note not found", w)
+		} else if errors.Is(err, backend.ErrPassphraseRequired) {
+			WriteResponse(401, "Passphrase required", w)
+		} else if errors.Is(err, backend.ErrWrongPassphrase) {
+			WriteResponse(403, "Wrong passphrase", w)
 		} else {
 			WriteResponse(500, "Error", w)
 		}
 	}
 }
 
-func WriteNote(w http.ResponseWriter, r *http.Request) {
+// WriteRequest is the body of a POST: the note and, for notes encrypted
+// by the server, the passphrase (never stored)
+type WriteRequest struct {
+	db.Note
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+func (h NoteHandlers) WriteNote(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
-	var note db.Note
+	var note WriteRequest
 	if err := decoder.Decode(&note); err != nil {
 		WriteResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}, w)
 		return
 	}
-	uuidString, err := backend.SaveKey(note.Text, note.OneTime)
+	uuidString, err := h.Backend.SaveNote(note.Note, note.Passphrase)
 	if err != nil {
 		WriteResponse(http.StatusBadRequest, map[string]string{"error": "invalid request"}, w)
 	} else {
@@ -67,13 +99,31 @@ func main() {
 		databasePassword = dbPassword
 	}
 
-	db.DatabaseUrl = databaseUrl
-	db.DatabasePassword = databasePassword
+	// redis (default), memory or bolt
+	databaseType := os.Getenv("API_DB_TYPE")
+	databasePath := "notes.db"
+	if dbPath, hasValue := os.LookupEnv("API_DB_PATH"); hasValue {
+		databasePath = dbPath
+	}
+
+	store, err := db.Open(db.Config{
+		Type:     databaseType,
+		Url:      databaseUrl,
+		Password: databasePassword,
+		Path:     databasePath,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	handlers := NoteHandlers{Backend: backend.New(store)}
 
 	router := mux.NewRouter()
-	router.HandleFunc("/api/note/{id}", ReadNote).Methods("GET")
-	router.HandleFunc("/api/note", WriteNote).Methods("POST")
-	err := http.ListenAndServe(fmt.Sprintf(":%s", serverPort), router)
+	router.HandleFunc("/api/note/{id}", handlers.ReadNote).Methods("GET")
+	router.HandleFunc("/api/note", handlers.WriteNote).Methods("POST")
+	router.HandleFunc("/", Index).Methods("GET")
+	err = http.ListenAndServe(fmt.Sprintf(":%s", serverPort), router)
 	fmt.Println(err)
 
 }
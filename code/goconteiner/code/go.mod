@@ -2,21 +2,26 @@ module com.blocopad/blocopad_poc
 
 go 1.19
 
+require (
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/mux v1.8.0
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/crypto v0.5.0
+)
+
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/go-redis/redis/v8 v8.11.5 // indirect
-	github.com/go-redis/redis/v9 v9.0.0-rc.2 // indirect
 	github.com/golang/mock v1.6.0 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/nitishm/go-rejson/v4 v4.1.0 // indirect
 	github.com/satori/go.uuid v1.2.0 // indirect
 	github.com/tkanos/gonfig v0.0.0-20210106201359-53e13348de2f // indirect
 	go.opentelemetry.io/otel v0.15.0 // indirect
 	golang.org/x/mod v0.4.2 // indirect
-	golang.org/x/sys v0.2.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 	golang.org/x/tools v0.1.1 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var notesBucket = []byte("notes")
+
+// BoltStore keeps the notes in a local BoltDB file, so a single instance
+// runs without a database server. Expired notes are removed when read and
+// on each save.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+type boltNote struct {
+	Note
+	Expires time.Time `json:"expires"`
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	if path == "" {
+		return nil, errors.New("bolt database needs a file path")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(notesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) GetNote(key string) (Note, error) {
+	var stored boltNote
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(notesBucket).Get([]byte(key))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &stored)
+	})
+	if err != nil {
+		return Note{}, err
+	}
+	if !time.Now().Before(stored.Expires) {
+		if err := s.DeleteNote(key); err != nil {
+			return Note{}, err
+		}
+		return Note{}, ErrNotFound
+	}
+	return stored.Note, nil
+}
+
+func (s *BoltStore) TakeNote(key string) (Note, error) {
+	var stored boltNote
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(notesBucket)
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return Note{}, err
+	}
+	if !time.Now().Before(stored.Expires) {
+		return Note{}, ErrNotFound
+	}
+	return stored.Note, nil
+}
+
+func (s *BoltStore) SaveNote(note Note) (string, error) {
+	key := newKey()
+	value, err := json.Marshal(boltNote{Note: note, Expires: time.Now().Add(NoteTTL)})
+	if err != nil {
+		return "", err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(notesBucket)
+		if err := purgeExpired(bucket); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *BoltStore) DeleteNote(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(notesBucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func purgeExpired(bucket *bolt.Bucket) error {
+	now := time.Now()
+	var expired [][]byte
+	err := bucket.ForEach(func(key, value []byte) error {
+		var stored boltNote
+		if err := json.Unmarshal(value, &stored); err == nil && !now.Before(stored.Expires) {
+			expired = append(expired, append([]byte{}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
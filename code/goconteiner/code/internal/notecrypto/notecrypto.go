@@ -0,0 +1,114 @@
+// Package notecrypto encrypts notes with AES-256-GCM. In client mode the
+// key is generated by the client and travels only in the URL fragment
+// (https://host/#<code>:<key>), which browsers never send to the server.
+// In passphrase mode the server derives the key from a passphrase with
+// scrypt and keeps only the ciphertext, the salt and the parameters.
+package notecrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	AlgorithmAESGCM = "aes-256-gcm"
+	KDFScrypt       = "scrypt"
+	KeySize         = 32
+)
+
+// scrypt parameters for new passphrase notes (about 50ms)
+const (
+	ScryptN = 1 << 15
+	ScryptR = 8
+	ScryptP = 1
+)
+
+var ErrDecrypt = errors.New("cannot decrypt note: wrong key or corrupted data")
+
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// EncodeKey encodes the key for the URL fragment
+func EncodeKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, errors.New("invalid key")
+	}
+	return key, nil
+}
+
+func DeriveKey(passphrase string, salt []byte, n, r, p int) ([]byte, error) {
+	if n > 1<<20 || r*p > 64 {
+		return nil, fmt.Errorf("scrypt parameters too expensive: N=%d r=%d p=%d", n, r, p)
+	}
+	return scrypt.Key([]byte(passphrase), salt, n, r, p, KeySize)
+}
+
+// Seal encrypts the plaintext and returns the ciphertext and the IV, both
+// in standard base64
+func Seal(key, plaintext []byte) (string, string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", "", err
+	}
+	ciphertext := gcm.Seal(nil, iv, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), base64.StdEncoding.EncodeToString(iv), nil
+}
+
+func Open(key []byte, data, iv string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	nonce, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("invalid key size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"com.blocopad/blocopad_poc/internal/backend"
+	"com.blocopad/blocopad_poc/internal/db"
+)
+
+// stores that run without a database server
+func localStores(t *testing.T) map[string]db.NoteStore {
+	memory, err := db.Open(db.Config{Type: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt, err := db.Open(db.Config{Type: "bolt", Path: filepath.Join(t.TempDir(), "notes.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		memory.Close()
+		bolt.Close()
+	})
+	return map[string]db.NoteStore{"memory": memory, "bolt": bolt}
+}
+
+func TestStoreSaveGetDelete(t *testing.T) {
+	for name, store := range localStores(t) {
+		// Given
+		key, err := store.SaveNote(db.Note{Text: "my note", OneTime: true})
+		if err != nil {
+			t.Fatalf("TestStoreSaveGetDelete %s: SaveNote returned %v", name, err)
+		}
+
+		// When
+		note, err := store.GetNote(key)
+
+		// Then
+		if err != nil || !note.OneTime || note.Text != "my note" {
+			t.Fatalf("TestStoreSaveGetDelete %s: GetNote returned %+v %v", name, note, err)
+		}
+
+		// When
+		err = store.DeleteNote(key)
+
+		// Then
+		if err != nil {
+			t.Fatalf("TestStoreSaveGetDelete %s: DeleteNote returned %v", name, err)
+		}
+		if _, err := store.GetNote(key); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("TestStoreSaveGetDelete %s: deleted note should be not found, got %v", name, err)
+		}
+	}
+}
+
+func TestStoreNotFound(t *testing.T) {
+	for name, store := range localStores(t) {
+		if _, err := store.GetNote("no-such-key"); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("TestStoreNotFound %s: got %v", name, err)
+		}
+		if err := store.DeleteNote("no-such-key"); err != nil {
+			t.Fatalf("TestStoreNotFound %s: deleting a missing note should not fail: %v", name, err)
+		}
+	}
+}
+
+func TestBackendWithStores(t *testing.T) {
+	for name, store := range localStores(t) {
+		// Given
+		notes := backend.New(store)
+		key, err := notes.SaveKey("read me once", true)
+		if err != nil {
+			t.Fatalf("TestBackendWithStores %s: SaveKey returned %v", name, err)
+		}
+
+		// When
+		data, err := notes.GetKey(key)
+
+		// Then
+		if err != nil || data != "read me once" {
+			t.Fatalf("TestBackendWithStores %s: GetKey returned %q %v", name, data, err)
+		}
+		if _, err := notes.GetKey(key); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("TestBackendWithStores %s: one time note read twice: %v", name, err)
+		}
+	}
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "notes.db")
+	store, err := db.NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.SaveNote(db.Note{Text: "persistent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// When
+	store, err = db.NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	note, err := store.GetNote(key)
+
+	// Then
+	if err != nil || note.OneTime || note.Text != "persistent" {
+		t.Fatalf("TestBoltStoreReopen: got %+v %v", note, err)
+	}
+}
+
+func TestOpenUnknownType(t *testing.T) {
+	if _, err := db.Open(db.Config{Type: "mongo"}); err == nil {
+		t.Fatal("TestOpenUnknownType should return error")
+	}
+	if _, err := db.Open(db.Config{Type: "bolt"}); err == nil {
+		t.Fatal("TestOpenUnknownType bolt without path should return error")
+	}
+}
+
+func TestStoreTakeNote(t *testing.T) {
+	for name, store := range localStores(t) {
+		// Given
+		key, err := store.SaveNote(db.Note{Text: "take me", OneTime: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// When
+		note, err := store.TakeNote(key)
+
+		// Then
+		if err != nil || note.Text != "take me" {
+			t.Fatalf("TestStoreTakeNote %s: TakeNote returned %+v %v", name, note, err)
+		}
+		if _, err := store.TakeNote(key); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("TestStoreTakeNote %s: note taken twice: %v", name, err)
+		}
+		if _, err := store.GetNote(key); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("TestStoreTakeNote %s: taken note still stored: %v", name, err)
+		}
+	}
+}
+
+// many goroutines read the same one time note: exactly one gets it
+func TestOneTimeNoteConcurrentReads(t *testing.T) {
+	for name, store := range localStores(t) {
+		// each passphrase read takes 32MB for scrypt
+		for passphrase, readers := range map[string]int{"": 64, "secret": 8} {
+			// Given
+			notes := backend.New(store)
+			key, err := notes.SaveNote(db.Note{Text: "only once", OneTime: true}, passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// When
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			got, notFound := 0, 0
+			start := make(chan struct{})
+			for i := 0; i < readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					note, err := notes.GetNote(key, passphrase)
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil && note.Text == "only once":
+						got++
+					case errors.Is(err, db.ErrNotFound):
+						notFound++
+					default:
+						t.Errorf("TestOneTimeNoteConcurrentReads %s: unexpected %+v %v", name, note, err)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			// Then
+			if got != 1 || notFound != readers-1 {
+				t.Fatalf("TestOneTimeNoteConcurrentReads %s (passphrase %q): %d readers got the note, %d not found", name, passphrase, got, notFound)
+			}
+		}
+	}
+}
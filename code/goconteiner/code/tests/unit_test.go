@@ -14,14 +14,44 @@ var (
 	deletedKey    string
 )
 
+// mockStore answers with the functions each test sets
+type mockStore struct {
+	getNote    func(key string) (db.Note, error)
+	saveNote   func(note db.Note) (string, error)
+	deleteNote func(key string) error
+	takeNote   func(key string) (db.Note, error)
+}
+
+func (m *mockStore) GetNote(key string) (db.Note, error) {
+	return m.getNote(key)
+}
+
+func (m *mockStore) SaveNote(note db.Note) (string, error) {
+	return m.saveNote(note)
+}
+
+func (m *mockStore) DeleteNote(key string) error {
+	return m.deleteNote(key)
+}
+
+func (m *mockStore) TakeNote(key string) (db.Note, error) {
+	return m.takeNote(key)
+}
+
+func (m *mockStore) Close() error {
+	return nil
+}
+
 func TestGetKeyOk(t *testing.T) {
 	// Given
-	db.GetNote = func(key string) (bool, string, error) {
-		return false, "OK", nil
+	store := &mockStore{}
+	notes := backend.New(store)
+	store.getNote = func(key string) (db.Note, error) {
+		return db.Note{Text: "OK"}, nil
 	}
 
 	// When
-	data, err := backend.GetKey("key1")
+	data, err := notes.GetKey("key1")
 
 	// Then
 	if err != nil {
@@ -34,11 +64,13 @@ func TestGetKeyOk(t *testing.T) {
 
 func TestGetErrorSize(t *testing.T) {
 	// Given
+	store := &mockStore{}
+	notes := backend.New(store)
 	keyString := ""
 	keyString2 := strings.Repeat("a", 40)
 
 	// When
-	_, err := backend.GetKey(keyString)
+	_, err := notes.GetKey(keyString)
 
 	// Then
 	if err == nil {
@@ -46,7 +78,7 @@ func TestGetErrorSize(t *testing.T) {
 	}
 
 	// When
-	_, err = backend.GetKey(keyString2)
+	_, err = notes.GetKey(keyString2)
 
 	// Then
 	if err == nil {
@@ -56,12 +88,14 @@ func TestGetErrorSize(t *testing.T) {
 
 func TestGetKeyDbError(t *testing.T) {
 	// Given
-	db.GetNote = func(key string) (bool, string, error) {
-		return false, "OK", errors.New("Error")
+	store := &mockStore{}
+	notes := backend.New(store)
+	store.getNote = func(key string) (db.Note, error) {
+		return db.Note{Text: "OK"}, errors.New("Error")
 	}
 
 	// When
-	_, err := backend.GetKey("key1")
+	_, err := notes.GetKey("key1")
 
 	// Then
 	if err == nil {
@@ -72,12 +106,14 @@ func TestGetKeyDbError(t *testing.T) {
 func TestSaveKeyOK(t *testing.T) {
 
 	// Given
-	db.SaveNote = func(data string, oneTime bool) (string, error) {
+	store := &mockStore{}
+	notes := backend.New(store)
+	store.saveNote = func(note db.Note) (string, error) {
 		return "123456", nil
 	}
 
 	// When
-	uuid, err := backend.SaveKey("blablabla", false)
+	uuid, err := notes.SaveKey("blablabla", false)
 
 	// Then
 	if err != nil {
@@ -92,12 +128,14 @@ func TestSaveKeyOK(t *testing.T) {
 func TestSaveKeyDbError(t *testing.T) {
 
 	// Given
-	db.SaveNote = func(data string, oneTime bool) (string, error) {
+	store := &mockStore{}
+	notes := backend.New(store)
+	store.saveNote = func(note db.Note) (string, error) {
 		return "123456", errors.New("Error")
 	}
 
 	// When
-	_, err := backend.SaveKey("blablabla", false)
+	_, err := notes.SaveKey("blablabla", false)
 
 	// Then
 	if err == nil {
@@ -108,11 +146,13 @@ func TestSaveKeyDbError(t *testing.T) {
 func TestSaveInvalidSize(t *testing.T) {
 
 	// Given
+	store := &mockStore{}
+	notes := backend.New(store)
 	dataZeroLength := ""
 	dataTooBig := strings.Repeat("a", 330000)
 
 	// When
-	_, err := backend.SaveKey(dataZeroLength, false)
+	_, err := notes.SaveKey(dataZeroLength, false)
 
 	// Then
 	if err == nil {
@@ -120,7 +160,7 @@ func TestSaveInvalidSize(t *testing.T) {
 	}
 
 	// When
-	_, err = backend.SaveKey(dataTooBig, false)
+	_, err = notes.SaveKey(dataTooBig, false)
 
 	// Then
 	if err == nil {
@@ -132,21 +172,23 @@ func TestSaveInvalidSize(t *testing.T) {
 func TestGetKeyDeleteOk(t *testing.T) {
 
 	// Given
+	store := &mockStore{}
+	notes := backend.New(store)
 	deleteInvoked = false
 	deletedKey = ""
 
-	db.GetNote = func(key string) (bool, string, error) {
-		return true, "OK", nil
+	store.getNote = func(key string) (db.Note, error) {
+		return db.Note{Text: "OK", OneTime: true}, nil
 	}
 
-	db.DeleteNote = func(key string) error {
+	store.takeNote = func(key string) (db.Note, error) {
 		deleteInvoked = true
 		deletedKey = key
-		return nil
+		return db.Note{Text: "OK", OneTime: true}, nil
 	}
 
 	// When
-	data, err := backend.GetKey("key1")
+	data, err := notes.GetKey("key1")
 
 	// Then
 	if err != nil {
@@ -166,30 +208,53 @@ func TestGetKeyDeleteOk(t *testing.T) {
 func TestGetKeyDeleteDbError(t *testing.T) {
 
 	// Given
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("TestGetKeyDeleteDbError The code did not panic")
-		}
-	}()
-
+	store := &mockStore{}
+	notes := backend.New(store)
 	deleteInvoked = false
 	deletedKey = ""
 
-	db.GetNote = func(key string) (bool, string, error) {
-		return true, "OK", nil
+	store.getNote = func(key string) (db.Note, error) {
+		return db.Note{Text: "OK", OneTime: true}, nil
 	}
 
-	db.DeleteNote = func(key string) error {
+	store.takeNote = func(key string) (db.Note, error) {
 		deleteInvoked = true
 		deletedKey = key
-		return errors.New("Error")
+		return db.Note{}, errors.New("Error")
 	}
 
 	// When
-	_, err := backend.GetKey("key1")
+	data, err := notes.GetKey("key1")
 
 	// Then
-	if err != nil {
-		t.Fatal("TestGetKeyDeleteDbError Should not return error")
+	if err == nil {
+		t.Fatal("TestGetKeyDeleteDbError Should return error")
+	}
+	if data != "" {
+		t.Fatal("TestGetKeyDeleteDbError should not return a note it could not delete")
+	}
+}
+
+func TestGetKeyOneTimeTakenByOther(t *testing.T) {
+
+	// Given
+	store := &mockStore{}
+	notes := backend.New(store)
+
+	store.getNote = func(key string) (db.Note, error) {
+		return db.Note{Text: "OK", OneTime: true}, nil
+	}
+
+	// another reader took it between the read and the take
+	store.takeNote = func(key string) (db.Note, error) {
+		return db.Note{}, db.ErrNotFound
+	}
+
+	// When
+	_, err := notes.GetKey("key1")
+
+	// Then
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("TestGetKeyOneTimeTakenByOther Should return not found")
 	}
 }
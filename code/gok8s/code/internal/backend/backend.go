@@ -1,36 +1,206 @@
 package backend
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 
 	"com.blocopad/blocopad_poc/internal/db"
+	"com.blocopad/blocopad_poc/internal/notecrypto"
 )
 
-func GetKey(key string) (string, error) {
-	if len(key) == 0 || len(key) > 36 {
-		return "", errors.New("Key with wrong size")
-	}
-	oneTime, data, err := db.GetNote(key)
+const (
+	ModeClient     = "client"
+	ModePassphrase = "passphrase"
+
+	maxNoteSize = 32 * 1024
+	// ciphertext of maxNoteSize runes in UTF-8 plus the GCM tag
+	maxCipherSize = 4*maxNoteSize + 16
+)
+
+var (
+	ErrEncrypted          = errors.New("note is encrypted")
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase")
+)
+
+type Backend struct {
+	store db.NoteStore
+}
+
+func New(store db.NoteStore) *Backend {
+	return &Backend{store: store}
+}
+
+// GetKey returns the text of a plaintext note. An encrypted note is
+// refused before it is taken, so a one time note is not burned unread.
+func (b *Backend) GetKey(key string) (string, error) {
+	note, err := b.read(key)
 	if err != nil {
 		return "", err
 	}
-	if oneTime {
-		if err := db.DeleteNote(key); err != nil {
-			panic("Cannot delete onetime note!!!!!")
+	if note.Cipher != nil {
+		return "", ErrEncrypted
+	}
+	if err := b.take(key, note); err != nil {
+		return "", err
+	}
+	return note.Text, nil
+}
+
+// GetNote returns the note as stored, except for passphrase notes, which
+// are decrypted with the passphrase. A one time note is taken from the
+// store atomically, so of concurrent readers only one gets it; it is only
+// taken once the passphrase is checked, so a wrong one does not burn it.
+func (b *Backend) GetNote(key string, passphrase string) (db.Note, error) {
+	note, err := b.read(key)
+	if err != nil {
+		return db.Note{}, err
+	}
+	if note.Cipher != nil && note.Cipher.Mode == ModePassphrase {
+		if note, err = decrypt(note, passphrase); err != nil {
+			return db.Note{}, err
 		}
 	}
-	return data, nil
+	if err := b.take(key, note); err != nil {
+		return db.Note{}, err
+	}
+	return note, nil
 }
 
-func SaveKey(data string, oneTime bool) (string, error) {
-	byteSize := len([]rune(data))
-	if byteSize == 0 || byteSize > (32*1024) {
-		return "", errors.New(("Invalid note size"))
+// reads the note without taking it, even if it is a one time note
+func (b *Backend) read(key string) (db.Note, error) {
+	if len(key) == 0 || len(key) > 36 {
+		return db.Note{}, errors.New("Key with wrong size")
+	}
+	return b.store.GetNote(key)
+}
+
+// takes a one time note from the store after it was read.
+// Notes never change once saved: whoever takes it gets what was read
+func (b *Backend) take(key string, note db.Note) error {
+	if !note.OneTime {
+		return nil
+	}
+	if _, err := b.store.TakeNote(key); errors.Is(err, db.ErrNotFound) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("cannot delete onetime note: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) SaveKey(data string, oneTime bool) (string, error) {
+	return b.SaveNote(db.Note{Text: data, OneTime: oneTime}, "")
+}
+
+// SaveNote stores the note. With a passphrase, the text is encrypted here
+// and only the ciphertext is stored; with a Cipher, the text is already
+// the client's ciphertext and is stored as is.
+func (b *Backend) SaveNote(note db.Note, passphrase string) (string, error) {
+	var err error
+	switch {
+	case passphrase != "" && note.Cipher != nil:
+		return "", errors.New("passphrase given for a note encrypted by the client")
+	case passphrase != "":
+		if err = checkSize(note.Text); err == nil {
+			note, err = encrypt(note, passphrase)
+		}
+	case note.Cipher != nil:
+		err = checkCipher(note)
+	default:
+		err = checkSize(note.Text)
 	}
-	uuidCode, err := db.SaveNote(data, oneTime)
+	if err != nil {
+		return "", err
+	}
+	uuidCode, err := b.store.SaveNote(note)
 	if err != nil {
 		return "", errors.New(err.Error())
 	}
 	return uuidCode, nil
 }
+
+func checkSize(data string) error {
+	byteSize := len([]rune(data))
+	if byteSize == 0 || byteSize > maxNoteSize {
+		return errors.New(("Invalid note size"))
+	}
+	return nil
+}
+
+// the server cannot open client notes: it only checks the shape
+func checkCipher(note db.Note) error {
+	c := note.Cipher
+	if c.Mode != ModeClient {
+		return errors.New("Invalid cipher mode")
+	}
+	if c.Algorithm != notecrypto.AlgorithmAESGCM {
+		return errors.New("Unsupported cipher algorithm")
+	}
+	if c.KDF != "" || c.Salt != "" || c.N != 0 || c.R != 0 || c.P != 0 {
+		return errors.New("Key derivation is not stored for client notes")
+	}
+	if iv, err := base64.StdEncoding.DecodeString(c.IV); err != nil || len(iv) != 12 {
+		return errors.New("Invalid cipher iv")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(note.Text)
+	if err != nil || len(ciphertext) <= 16 || len(ciphertext) > maxCipherSize {
+		return errors.New("Invalid note size")
+	}
+	return nil
+}
+
+func encrypt(note db.Note, passphrase string) (db.Note, error) {
+	salt, err := notecrypto.NewSalt()
+	if err != nil {
+		return db.Note{}, err
+	}
+	key, err := notecrypto.DeriveKey(passphrase, salt, notecrypto.ScryptN, notecrypto.ScryptR, notecrypto.ScryptP)
+	if err != nil {
+		return db.Note{}, err
+	}
+	data, iv, err := notecrypto.Seal(key, []byte(note.Text))
+	if err != nil {
+		return db.Note{}, err
+	}
+	note.Text = data
+	note.Cipher = &db.Cipher{
+		Mode:      ModePassphrase,
+		Algorithm: notecrypto.AlgorithmAESGCM,
+		IV:        iv,
+		KDF:       notecrypto.KDFScrypt,
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		N:         notecrypto.ScryptN,
+		R:         notecrypto.ScryptR,
+		P:         notecrypto.ScryptP,
+	}
+	return note, nil
+}
+
+func decrypt(note db.Note, passphrase string) (db.Note, error) {
+	if passphrase == "" {
+		return db.Note{}, ErrPassphraseRequired
+	}
+	c := note.Cipher
+	if c.KDF != notecrypto.KDFScrypt || c.Algorithm != notecrypto.AlgorithmAESGCM {
+		return db.Note{}, errors.New("Unsupported cipher")
+	}
+	salt, err := base64.StdEncoding.DecodeString(c.Salt)
+	if err != nil {
+		return db.Note{}, err
+	}
+	key, err := notecrypto.DeriveKey(passphrase, salt, c.N, c.R, c.P)
+	if err != nil {
+		return db.Note{}, err
+	}
+	plaintext, err := notecrypto.Open(key, note.Text, c.IV)
+	if errors.Is(err, notecrypto.ErrDecrypt) {
+		return db.Note{}, ErrWrongPassphrase
+	} else if err != nil {
+		return db.Note{}, err
+	}
+	note.Text = string(plaintext)
+	note.Cipher = nil
+	return note, nil
+}
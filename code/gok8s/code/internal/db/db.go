@@ -1,81 +1,72 @@
 package db
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
-	"github.com/go-redis/redis/v9"
 	"github.com/google/uuid"
 )
 
-var (
-	DatabaseUrl      string
-	DatabasePassword string
-	rDB              *redis.Client
-	ctx              = context.Background()
-)
+// Notes expire 24 hours after being saved, in every store
+const NoteTTL = 24 * time.Hour
 
-var GetDatabase = func() *redis.Client {
-	if rDB == nil {
-		rDB = redis.NewClient(&redis.Options{
-			Addr:     DatabaseUrl,
-			Password: DatabasePassword,
-			DB:       0,
-		})
-	}
-	return rDB
-}
+var ErrNotFound = errors.New("not found")
 
 type Note struct {
-	Text    string `json:"data"`
-	OneTime bool   `json:"onetime"`
+	Text    string  `json:"data"`
+	OneTime bool    `json:"onetime"`
+	Cipher  *Cipher `json:"cipher,omitempty"` // nil for plaintext notes
 }
 
-var GetNote = func(key string) (bool, string, error) {
-	db := GetDatabase()
-	jsonNote, err := db.Get(ctx, key).Result()
-	if errors.Is(err, redis.Nil) {
-		return false, "", errors.New("not found")
-	} else if err != nil {
-		// Some other error
-		return false, "", err
-	}
+// Cipher describes an encrypted note, whose Text is the ciphertext in
+// base64. In "client" mode the key never reaches the server; in
+// "passphrase" mode the server derives it from a passphrase with the KDF.
+type Cipher struct {
+	Mode      string `json:"mode"`      // client or passphrase
+	Algorithm string `json:"algorithm"` // aes-256-gcm
+	IV        string `json:"iv"`
+	KDF       string `json:"kdf,omitempty"` // passphrase mode: scrypt
+	Salt      string `json:"salt,omitempty"`
+	N         int    `json:"n,omitempty"`
+	R         int    `json:"r,omitempty"`
+	P         int    `json:"p,omitempty"`
+}
 
-	var note Note
-	err = json.Unmarshal([]byte(jsonNote), &note)
-	if err != nil {
-		return false, "", err
-	}
+// NoteStore is where the notes live. Implementations: RedisStore,
+// MemoryStore and BoltStore (embedded, in a local file).
+type NoteStore interface {
+	GetNote(key string) (Note, error)
+	SaveNote(note Note) (string, error)
+	DeleteNote(key string) error
+	// TakeNote reads and deletes the note in one atomic step: of many
+	// concurrent calls for the same key, only one gets the note and the
+	// others get ErrNotFound
+	TakeNote(key string) (Note, error)
+	Close() error
+}
 
-	return note.OneTime, note.Text, nil
+// Config selects and configures the store. Type is "redis" (default),
+// "memory" or "bolt".
+type Config struct {
+	Type     string
+	Url      string // redis
+	Password string // redis
+	Path     string // bolt
 }
 
-var SaveNote = func(data string, oneTime bool) (string, error) {
-	stringUuid := (uuid.New()).String()
-	db := GetDatabase()
-	var note Note
-	note.Text = data
-	note.OneTime = oneTime
-	jsonNote, err := json.Marshal(note)
-	if err != nil {
-		return "", err
-	}
-	exp := 24 * time.Hour
-	err = db.SetEx(ctx, stringUuid, jsonNote, exp).Err()
-	if err != nil {
-		return "", err
+func Open(config Config) (NoteStore, error) {
+	switch config.Type {
+	case "", "redis":
+		return NewRedisStore(config.Url, config.Password), nil
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		return NewBoltStore(config.Path)
 	}
-
-	return stringUuid, nil
+	return nil, fmt.Errorf("unknown database type: %q", config.Type)
 }
 
-var DeleteNote = func(key string) error {
-	db := GetDatabase()
-	_, err := db.Del(ctx, key).Result()
-	if err != nil {
-		return err
-	}
-	return nil
+func newKey() string {
+	return (uuid.New()).String()
 }
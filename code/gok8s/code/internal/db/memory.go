@@ -0,0 +1,86 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the notes in a map. Nothing survives a restart: use it
+// for development and tests.
+type MemoryStore struct {
+	mu    sync.Mutex
+	notes map[string]memoryNote
+}
+
+type memoryNote struct {
+	note    Note
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{notes: map[string]memoryNote{}}
+}
+
+func (s *MemoryStore) GetNote(key string) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.notes[key]
+	if !ok {
+		return Note{}, ErrNotFound
+	}
+	if !time.Now().Before(stored.expires) {
+		delete(s.notes, key)
+		return Note{}, ErrNotFound
+	}
+	return stored.note.clone(), nil
+}
+
+func (s *MemoryStore) TakeNote(key string) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.notes[key]
+	delete(s.notes, key)
+	if !ok || !time.Now().Before(stored.expires) {
+		return Note{}, ErrNotFound
+	}
+	return stored.note.clone(), nil
+}
+
+func (s *MemoryStore) SaveNote(note Note) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	key := newKey()
+	s.notes[key] = memoryNote{note: note.clone(), expires: time.Now().Add(NoteTTL)}
+	return key, nil
+}
+
+func (s *MemoryStore) DeleteNote(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notes, key)
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// removes the expired notes, so unread ones don't pile up
+func (s *MemoryStore) purge() {
+	now := time.Now()
+	for key, stored := range s.notes {
+		if !now.Before(stored.expires) {
+			delete(s.notes, key)
+		}
+	}
+}
+
+// the map must not share the Cipher with the callers
+func (n Note) clone() Note {
+	if n.Cipher != nil {
+		c := *n.Cipher
+		n.Cipher = &c
+	}
+	return n
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
 
 	"github.com/go-redis/redis/v9"
@@ -67,6 +69,12 @@ func TestSaveOK(t *testing.T) {
 		t.Fatal("TestSaveOK Did not return the correct string on GET")
 	}
 
+	// the expiration is only checked in Redis; the server may be running
+	// with another store (API_DB_TYPE)
+	if dbType := os.Getenv("API_DB_TYPE"); dbType != "" && dbType != "redis" {
+		return
+	}
+
 	rDB := redis.NewClient(&redis.Options{
 		Addr:     "localhost:6379",
 		Password: "",
@@ -81,3 +89,49 @@ func TestSaveOK(t *testing.T) {
 	}
 
 }
+
+func TestOneTimeConcurrentReads(t *testing.T) {
+	postUrl := "http://localhost:8080/api/note"
+	response, err := http.Post(postUrl, "application/json", bytes.NewBufferString(`{"data": "only once", "onetime": true}`))
+	if err != nil {
+		panic(err)
+	}
+	var savedNote SavedNote
+	err = json.NewDecoder(response.Body).Decode(&savedNote)
+	response.Body.Close()
+	if err != nil || len(savedNote.Code) == 0 {
+		t.Fatal("TestOneTimeConcurrentReads should save the note")
+	}
+
+	const readers = 50
+	statuses := make(chan int, readers)
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := http.Get(postUrl + "/" + savedNote.Code)
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			response.Body.Close()
+			statuses <- response.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	ok, notFound := 0, 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			ok++
+		case http.StatusNotFound:
+			notFound++
+		}
+	}
+	if ok != 1 || notFound != readers-1 {
+		t.Fatalf("TestOneTimeConcurrentReads %d readers got the note, %d not found", ok, notFound)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -45,19 +47,44 @@ func WriteResponse(status int, body interface{}, w http.ResponseWriter) {
 	w.Write(payload)
 }
 
+//go:embed web/index.html
+var indexPage []byte
+
 // HTTP Handlers
 
-func ReadNote(w http.ResponseWriter, r *http.Request) {
+// Index serves the browser client, which encrypts the notes before
+// posting them and keeps the key in the URL fragment
+func Index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexPage)
+}
+
+type NoteHandlers struct {
+	Backend *backend.Backend
+}
+
+func (h NoteHandlers) ReadNote(w http.ResponseWriter, r *http.Request) {
 	GetNotes.Inc()
 	vars := mux.Vars(r)
 	id := vars["id"]
 	statusCode := 200
-	if data, err := backend.GetKey(id); err == nil {
-		WriteResponse(statusCode, data, w)
+	if note, err := h.Backend.GetNote(id, r.Header.Get("X-Note-Passphrase")); err == nil {
+		if note.Cipher != nil {
+			// encrypted by the client: ciphertext and metadata
+			WriteResponse(statusCode, note, w)
+		} else {
+			WriteResponse(statusCode, note.Text, w)
+		}
 	} else {
-		if err.Error() == "not found" {
+		if errors.Is(err, db.ErrNotFound) {
 			statusCode = 404
 			WriteResponse(404, "Note not found", w)
+		} else if errors.Is(err, backend.ErrPassphraseRequired) {
+			statusCode = 401
+			WriteResponse(401, "Passphrase required", w)
+		} else if errors.Is(err, backend.ErrWrongPassphrase) {
+			statusCode = 403
+			WriteResponse(403, "Wrong passphrase", w)
 		} else {
 			statusCode = 500
 			WriteResponse(500, "Error", w)
@@ -66,18 +93,25 @@ func ReadNote(w http.ResponseWriter, r *http.Request) {
 	totalRequests.WithLabelValues(strconv.Itoa(statusCode)).Inc()
 }
 
-func WriteNote(w http.ResponseWriter, r *http.Request) {
+// WriteRequest is the body of a POST: the note and, for notes encrypted
+// by the server, the passphrase (never stored)
+type WriteRequest struct {
+	db.Note
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+func (h NoteHandlers) WriteNote(w http.ResponseWriter, r *http.Request) {
 	NewNotes.Inc()
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
-	var note db.Note
+	var note WriteRequest
 	statusCode := 200
 	if err := decoder.Decode(&note); err != nil {
 		statusCode = http.StatusBadRequest
 		WriteResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}, w)
 		return
 	}
-	uuidString, err := backend.SaveKey(note.Text, note.OneTime)
+	uuidString, err := h.Backend.SaveNote(note.Note, note.Passphrase)
 	if err != nil {
 		fmt.Println(err)
 		statusCode = http.StatusBadRequest
@@ -110,17 +144,36 @@ func main() {
 	}
 
 	fmt.Printf("\nAPI_PORT: %s, API_DB_URL: %s\n", serverPort, databaseUrl)
-	db.DatabaseUrl = databaseUrl
-	db.DatabasePassword = databasePassword
+	// redis (default), memory or bolt
+	databaseType := os.Getenv("API_DB_TYPE")
+	databasePath := "notes.db"
+	if dbPath, hasValue := os.LookupEnv("API_DB_PATH"); hasValue {
+		databasePath = dbPath
+	}
+
+	store, err := db.Open(db.Config{
+		Type:     databaseType,
+		Url:      databaseUrl,
+		Password: databasePassword,
+		Path:     databasePath,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	handlers := NoteHandlers{Backend: backend.New(store)}
+
 	prometheus.MustRegister(NewNotes)
 	prometheus.MustRegister(GetNotes)
 	prometheus.MustRegister(totalRequests)
 	router := mux.NewRouter()
 	router.Use(prometheusMiddleware)
 	router.Path("/metrics").Handler(promhttp.Handler())
-	router.HandleFunc("/api/note/{id}", ReadNote).Methods("GET")
-	router.HandleFunc("/api/note", WriteNote).Methods("POST")
-	err := http.ListenAndServe(fmt.Sprintf(":%s", serverPort), router)
+	router.HandleFunc("/api/note/{id}", handlers.ReadNote).Methods("GET")
+	router.HandleFunc("/api/note", handlers.WriteNote).Methods("POST")
+	router.HandleFunc("/", Index).Methods("GET")
+	err = http.ListenAndServe(fmt.Sprintf(":%s", serverPort), router)
 	fmt.Println(err)
 
 }
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// GET and DEL in a single script, which Redis runs atomically (GETDEL
+// does the same, but only from Redis 6.2 on)
+var takeScript = redis.NewScript(`
+local note = redis.call("GET", KEYS[1])
+if note then
+	redis.call("DEL", KEYS[1])
+end
+return note
+`)
+
+// RedisStore keeps the notes in Redis, which takes care of expiration
+type RedisStore struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+func NewRedisStore(url string, password string) *RedisStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     url,
+		Password: password,
+		DB:       0,
+	})
+	return &RedisStore{client: client, ctx: context.Background()}
+}
+
+func (s *RedisStore) GetNote(key string) (Note, error) {
+	return s.read(s.client.Get(s.ctx, key).Result())
+}
+
+func (s *RedisStore) TakeNote(key string) (Note, error) {
+	return s.read(takeScript.Run(s.ctx, s.client, []string{key}).Text())
+}
+
+func (s *RedisStore) read(jsonNote string, err error) (Note, error) {
+	var note Note
+	if errors.Is(err, redis.Nil) {
+		return note, ErrNotFound
+	} else if err != nil {
+		// Some other error
+		return note, err
+	}
+
+	err = json.Unmarshal([]byte(jsonNote), &note)
+	return note, err
+}
+
+func (s *RedisStore) SaveNote(note Note) (string, error) {
+	stringUuid := newKey()
+	jsonNote, err := json.Marshal(note)
+	if err != nil {
+		return "", err
+	}
+	err = s.client.SetEx(s.ctx, stringUuid, jsonNote, NoteTTL).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return stringUuid, nil
+}
+
+func (s *RedisStore) DeleteNote(key string) error {
+	_, err := s.client.Del(s.ctx, key).Result()
+	return err
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
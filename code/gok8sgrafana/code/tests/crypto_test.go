@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"com.blocopad/blocopad_poc/internal/backend"
+	"com.blocopad/blocopad_poc/internal/db"
+	"com.blocopad/blocopad_poc/internal/notecrypto"
+)
+
+func TestClientEncryptedNote(t *testing.T) {
+	// Given: the client encrypts and keeps the key for the link fragment
+	store := db.NewMemoryStore()
+	notes := backend.New(store)
+	key, err := notecrypto.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, iv, err := notecrypto.Seal(key, []byte("top secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment := notecrypto.EncodeKey(key)
+
+	// When
+	code, err := notes.SaveNote(db.Note{Text: data, Cipher: &db.Cipher{Mode: backend.ModeClient, Algorithm: notecrypto.AlgorithmAESGCM, IV: iv}}, "")
+
+	// Then
+	if err != nil {
+		t.Fatal("TestClientEncryptedNote Should not return error", err)
+	}
+	stored, _ := store.GetNote(code)
+	if strings.Contains(stored.Text, "top secret") {
+		t.Fatal("TestClientEncryptedNote the store should only see ciphertext")
+	}
+	if _, err := notes.GetKey(code); !errors.Is(err, backend.ErrEncrypted) {
+		t.Fatal("TestClientEncryptedNote GetKey should refuse encrypted notes", err)
+	}
+	note, err := notes.GetNote(code, "")
+	if err != nil || note.Cipher == nil || note.Cipher.IV != iv {
+		t.Fatal("TestClientEncryptedNote should return the blob and its metadata", err)
+	}
+	fragmentKey, err := notecrypto.DecodeKey(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := notecrypto.Open(fragmentKey, note.Text, note.Cipher.IV)
+	if err != nil || string(plaintext) != "top secret" {
+		t.Fatal("TestClientEncryptedNote the client should decrypt the note", err)
+	}
+}
+
+func TestClientEncryptedNoteInvalid(t *testing.T) {
+	notes := backend.New(db.NewMemoryStore())
+	key, _ := notecrypto.NewKey()
+	data, iv, _ := notecrypto.Seal(key, []byte("x"))
+	valid := db.Cipher{Mode: backend.ModeClient, Algorithm: notecrypto.AlgorithmAESGCM, IV: iv}
+
+	cases := map[string]func(n *db.Note){
+		"unknown algorithm": func(n *db.Note) { n.Cipher.Algorithm = "rot13" },
+		"unknown mode":      func(n *db.Note) { n.Cipher.Mode = "other" },
+		"server mode":       func(n *db.Note) { n.Cipher.Mode = backend.ModePassphrase },
+		"bad iv":            func(n *db.Note) { n.Cipher.IV = "AAAA" },
+		"not base64":        func(n *db.Note) { n.Text = "plain text!" },
+		"empty":             func(n *db.Note) { n.Text = "" },
+		"too big":           func(n *db.Note) { n.Text = strings.Repeat("A", 200*1024) },
+	}
+	for name, change := range cases {
+		c := valid
+		note := db.Note{Text: data, Cipher: &c}
+		change(&note)
+		if _, err := notes.SaveNote(note, ""); err == nil {
+			t.Fatalf("TestClientEncryptedNoteInvalid %s should return error", name)
+		}
+	}
+	c := valid
+	if _, err := notes.SaveNote(db.Note{Text: data, Cipher: &c}, "passphrase"); err == nil {
+		t.Fatal("TestClientEncryptedNoteInvalid passphrase and client cipher should return error")
+	}
+}
+
+func TestGetKeyEncryptedOneTime(t *testing.T) {
+	// Given: one time notes encrypted by the client and with a passphrase
+	notes := backend.New(db.NewMemoryStore())
+	key, _ := notecrypto.NewKey()
+	data, iv, _ := notecrypto.Seal(key, []byte("burn after reading"))
+	client, err := notes.SaveNote(db.Note{Text: data, OneTime: true, Cipher: &db.Cipher{Mode: backend.ModeClient, Algorithm: notecrypto.AlgorithmAESGCM, IV: iv}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase, err := notes.SaveNote(db.Note{Text: "burn after reading", OneTime: true}, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When / Then: GetKey refuses them without taking them
+	for name, code := range map[string]string{"client": client, "passphrase": passphrase} {
+		if _, err := notes.GetKey(code); !errors.Is(err, backend.ErrEncrypted) {
+			t.Fatalf("TestGetKeyEncryptedOneTime %s GetKey should refuse encrypted notes: %v", name, err)
+		}
+	}
+	if note, err := notes.GetNote(client, ""); err != nil || note.Text != data {
+		t.Fatal("TestGetKeyEncryptedOneTime GetKey burned the client note", err)
+	}
+	if note, err := notes.GetNote(passphrase, "correct horse"); err != nil || note.Text != "burn after reading" {
+		t.Fatal("TestGetKeyEncryptedOneTime GetKey burned the passphrase note", err)
+	}
+}
+
+func TestPassphraseNote(t *testing.T) {
+	// Given
+	store := db.NewMemoryStore()
+	notes := backend.New(store)
+
+	// When
+	code, err := notes.SaveNote(db.Note{Text: "read me once", OneTime: true}, "correct horse")
+
+	// Then
+	if err != nil {
+		t.Fatal("TestPassphraseNote Should not return error", err)
+	}
+	stored, _ := store.GetNote(code)
+	if stored.Cipher == nil || stored.Cipher.KDF != notecrypto.KDFScrypt || stored.Cipher.Salt == "" || strings.Contains(stored.Text, "read me") {
+		t.Fatalf("TestPassphraseNote the store should only keep ciphertext and kdf metadata: %+v", stored)
+	}
+	if _, err := notes.GetNote(code, ""); !errors.Is(err, backend.ErrPassphraseRequired) {
+		t.Fatal("TestPassphraseNote should ask for the passphrase", err)
+	}
+	if _, err := notes.GetNote(code, "wrong"); !errors.Is(err, backend.ErrWrongPassphrase) {
+		t.Fatal("TestPassphraseNote should refuse a wrong passphrase", err)
+	}
+	// a wrong passphrase does not burn the one time note
+	note, err := notes.GetNote(code, "correct horse")
+	if err != nil || note.Text != "read me once" || note.Cipher != nil {
+		t.Fatalf("TestPassphraseNote should decrypt the note: %+v %v", note, err)
+	}
+	if _, err := notes.GetNote(code, "correct horse"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("TestPassphraseNote one time note read twice", err)
+	}
+}
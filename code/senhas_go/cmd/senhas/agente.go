@@ -0,0 +1,317 @@
+// agente.go
+// Agente local (como o ssh-agent): abre o cofre uma vez e atende get/list
+// por um socket Unix, trancando depois de um tempo ocioso ou com SIGUSR1.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// pedido ao agente, um por conexão
+type pedido struct {
+	Op    string       `json:"op"` // ping, get, list, search, lock
+	Cofre string       `json:"cofre,omitempty"`
+	Local string       `json:"local,omitempty"`
+	Tag   string       `json:"tag,omitempty"`
+	Busca *vault.Query `json:"busca,omitempty"`
+}
+
+type resposta struct {
+	Cofre    string       `json:"cofre"` // cofre que o agente serve
+	Trancado bool         `json:"trancado,omitempty"`
+	Erro     string       `json:"erro,omitempty"`
+	Entrada  *vault.Entry `json:"entrada,omitempty"`
+	Itens    []itemLista  `json:"itens,omitempty"`
+	Total    int          `json:"total,omitempty"` // search: resultados antes da paginação
+}
+
+// $SENHAS_AGENT_SOCK, $XDG_RUNTIME_DIR/senhas/agent.sock ou /tmp/senhas-UID/agent.sock
+func socketPadrao() string {
+	if p := os.Getenv("SENHAS_AGENT_SOCK"); p != "" {
+		return p
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "senhas", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("senhas-%d", os.Getuid()), "agent.sock")
+}
+
+type agente struct {
+	mu      sync.Mutex
+	v       *vault.Vault // nil depois de trancado
+	cofre   string
+	ativo   chan struct{} // cada pedido reinicia o tempo ocioso
+	trancar chan struct{}
+}
+
+func (a *app) cmdAgent(args []string) error {
+	fs := a.flags("agent", "[opções]")
+	ocioso := fs.Duration("timeout", 15*time.Minute, "tranca depois deste tempo sem pedidos")
+	sock := fs.String("socket", socketPadrao(), "socket Unix do agente")
+	lock := fs.Bool("lock", false, "tranca o agente em execução")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	if *lock {
+		if _, err := pedirAgente(*sock, pedido{Op: "lock"}); err != nil {
+			return fmt.Errorf("nenhum agente em %s", *sock)
+		}
+		return a.feito(map[string]string{"socket": *sock}, "agente trancado")
+	}
+	cofre, err := filepath.Abs(a.cofre)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	ln, err := escutar(*sock)
+	if err != nil {
+		v.Lock()
+		return err
+	}
+	defer os.Remove(*sock)
+	defer ln.Close()
+
+	ag := &agente{v: v, cofre: cofre, ativo: make(chan struct{}, 1), trancar: make(chan struct{}, 1)}
+	go ag.servir(ln)
+
+	sinais := make(chan os.Signal, 1)
+	signal.Notify(sinais, append(sinaisTrancar, os.Interrupt, syscall.SIGTERM)...)
+	defer signal.Stop(sinais)
+
+	if err := a.saida(map[string]string{"socket": *sock},
+		fmt.Sprintf("SENHAS_AGENT_SOCK=%s; export SENHAS_AGENT_SOCK;\n", *sock)); err != nil {
+		ag.lock()
+		return err
+	}
+	timer := time.NewTimer(*ocioso)
+	defer timer.Stop()
+	motivo := ""
+	for motivo == "" {
+		select {
+		case <-ag.ativo:
+			timer.Reset(*ocioso)
+		case <-timer.C:
+			motivo = "tempo ocioso esgotado"
+		case s := <-sinais:
+			motivo = "sinal " + s.String()
+		case <-ag.trancar:
+			motivo = "pedido de lock"
+		}
+	}
+	ag.lock()
+	fmt.Fprintln(a.errOut, "agente trancado:", motivo)
+	return nil
+}
+
+// cria o socket num diretório só do usuário; recusa se já há um agente nele
+func escutar(sock string) (net.Listener, error) {
+	dir := filepath.Dir(sock)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := dirPrivado(dir); err != nil {
+		return nil, err
+	}
+	if _, err := pedirAgente(sock, pedido{Op: "ping"}); err == nil {
+		return nil, fmt.Errorf("já há um agente em %s", sock)
+	}
+	// socket de um agente que morreu sem limpar
+	os.Remove(sock)
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(sock, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (ag *agente) servir(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return // fechado ao trancar
+		}
+		go ag.atender(c)
+	}
+}
+
+func (ag *agente) atender(c net.Conn) {
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	var p pedido
+	if err := json.NewDecoder(c).Decode(&p); err != nil {
+		return
+	}
+	json.NewEncoder(c).Encode(ag.responder(p))
+}
+
+func (ag *agente) responder(p pedido) resposta {
+	r := resposta{Cofre: ag.cofre}
+	switch p.Op {
+	case "ping":
+		return r
+	case "lock":
+		ag.pedirLock()
+		r.Trancado = true
+		return r
+	}
+	if p.Cofre != ag.cofre {
+		r.Erro = "o agente serve outro cofre"
+		return r
+	}
+	select {
+	case ag.ativo <- struct{}{}:
+	default:
+	}
+
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.v == nil {
+		r.Trancado = true
+		return r
+	}
+	// vê o que outros processos gravaram; se a senha mudou, as chaves
+	// em memória não servem mais e o agente se tranca
+	if err := ag.v.Reload(); err != nil {
+		ag.pedirLock()
+		r.Trancado, r.Erro = true, err.Error()
+		return r
+	}
+	var err error
+	switch p.Op {
+	case "get":
+		var e vault.Entry
+		if e, err = ag.v.GetEntry(p.Local); err == nil {
+			r.Entrada = &e
+		}
+	case "list":
+		r.Itens, err = listar(ag.v, p.Tag)
+	case "search":
+		if p.Busca == nil {
+			p.Busca = &vault.Query{}
+		}
+		r.Itens, r.Total, err = buscar(ag.v, *p.Busca)
+	default:
+		err = fmt.Errorf("operação desconhecida: %q", p.Op)
+	}
+	if err != nil {
+		r.Erro = err.Error()
+	}
+	return r
+}
+
+func (ag *agente) pedirLock() {
+	select {
+	case ag.trancar <- struct{}{}:
+	default:
+	}
+}
+
+// zera as chaves; pedidos em andamento terminam antes
+func (ag *agente) lock() {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.v != nil {
+		ag.v.Lock()
+		ag.v = nil
+	}
+}
+
+func pedirAgente(sock string, p pedido) (resposta, error) {
+	var r resposta
+	c, err := net.DialTimeout("unix", sock, time.Second)
+	if err != nil {
+		return r, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := json.NewEncoder(c).Encode(p); err != nil {
+		return r, err
+	}
+	err = json.NewDecoder(c).Decode(&r)
+	return r, err
+}
+
+// pede ao agente do socket padrão; ok = false se não há agente
+// destrancado servindo este cofre (aí o comando pede a senha)
+func (a *app) pedirAgente(p pedido) (r resposta, ok bool) {
+	cofre, err := filepath.Abs(a.cofre)
+	if err != nil {
+		return r, false
+	}
+	p.Cofre = cofre
+	r, err = pedirAgente(socketPadrao(), p)
+	if err != nil || r.Cofre != cofre || r.Trancado {
+		return r, false
+	}
+	return r, true
+}
+
+// entrada pelo agente ou, sem ele, abrindo o cofre
+func (a *app) entrada(local string) (vault.Entry, error) {
+	if r, ok := a.pedirAgente(pedido{Op: "get", Local: local}); ok {
+		if r.Erro != "" || r.Entrada == nil {
+			return vault.Entry{}, errors.New(r.Erro)
+		}
+		return *r.Entrada, nil
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return vault.Entry{}, err
+	}
+	return v.GetEntry(local)
+}
+
+// itens de list pelo agente ou, sem ele, abrindo o cofre
+func (a *app) itens(tag string) ([]itemLista, error) {
+	if r, ok := a.pedirAgente(pedido{Op: "list", Tag: tag}); ok {
+		if r.Erro != "" {
+			return nil, errors.New(r.Erro)
+		}
+		if r.Itens == nil {
+			r.Itens = []itemLista{}
+		}
+		return r.Itens, nil
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return nil, err
+	}
+	return listar(v, tag)
+}
+
+// resultado de search pelo agente ou, sem ele, abrindo o cofre
+func (a *app) busca(q vault.Query) ([]itemLista, int, error) {
+	if r, ok := a.pedirAgente(pedido{Op: "search", Busca: &q}); ok {
+		if r.Erro != "" {
+			return nil, 0, errors.New(r.Erro)
+		}
+		if r.Itens == nil {
+			r.Itens = []itemLista{}
+		}
+		return r.Itens, r.Total, nil
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return nil, 0, err
+	}
+	return buscar(v, q)
+}
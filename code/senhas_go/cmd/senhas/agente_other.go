@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// sem SIGUSR1 nesta plataforma: use "senhas agent -lock"
+var sinaisTrancar = []os.Signal{}
+
+// sem permissões no estilo Unix: confia no diretório do usuário
+func dirPrivado(dir string) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+// agente_test.go
+
+/*
+Testes do agente: get/list/search sem senha enquanto destrancado e trancamento
+*/
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sobe o agente em segundo plano e espera o socket responder
+func iniciarAgente(t *testing.T, cofre, senha string, args ...string) <-chan error {
+	t.Helper()
+	fim := make(chan error, 1)
+	args = append([]string{"-vault", cofre, "-password-stdin", "agent"}, args...)
+	go func() {
+		fim <- run(args, strings.NewReader(senha+"\n"), io.Discard, io.Discard)
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := pedirAgente(socketPadrao(), pedido{Op: "ping"}); err == nil {
+			return fim
+		}
+		select {
+		case err := <-fim:
+			t.Fatalf("agente terminou: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	t.Fatal("agente não respondeu")
+	return nil
+}
+
+func esperarFim(t *testing.T, fim <-chan error) {
+	t.Helper()
+	select {
+	case err := <-fim:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agente não trancou")
+	}
+}
+
+func TestAgente(t *testing.T) {
+	dir := t.TempDir()
+	cofre := filepath.Join(dir, "cofre.json")
+	sock := filepath.Join(dir, "agente", "agent.sock")
+	t.Setenv("SENHAS_AGENT_SOCK", sock)
+	senhas(t, cofre, "Mestra\n", "init", "-kdf", "pbkdf2")
+	senhas(t, cofre, "Mestra\nsegredo\n", "add", "-tag", "web", "site")
+
+	fim := iniciarAgente(t, cofre, "Mestra", "-timeout", "1m")
+	if info, err := os.Stat(sock); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket sem permissão 0600: %v %v", info, err)
+	}
+	// nenhuma senha na entrada: quem responde é o agente
+	if s := senhas(t, cofre, "", "get", "-password", "site"); s != "segredo\n" {
+		t.Fatalf("get pelo agente = %q", s)
+	}
+	if s := senhas(t, cofre, "", "list", "-tag", "web"); s != "site\n" {
+		t.Fatalf("list pelo agente = %q", s)
+	}
+	if s := senhas(t, cofre, "", "search", "-fuzzy", "ste"); s != "site\t\n" {
+		t.Fatalf("search pelo agente = %q", s)
+	}
+	// gravações de outros processos aparecem no agente
+	senhas(t, cofre, "Mestra\noutra\n", "update", "-password", "site")
+	if s := senhas(t, cofre, "", "get", "-password", "site"); s != "outra\n" {
+		t.Fatalf("agente não releu o cofre: %q", s)
+	}
+	// o agente só responde pelo cofre que abriu
+	outro := filepath.Join(dir, "outro.json")
+	senhas(t, outro, "Mestra\n", "init", "-kdf", "pbkdf2")
+	if err := run([]string{"-vault", outro, "-password-stdin", "list"}, strings.NewReader(""), io.Discard, io.Discard); err == nil {
+		t.Fatal("agente respondeu por outro cofre")
+	}
+
+	senhas(t, cofre, "", "agent", "-lock")
+	esperarFim(t, fim)
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatal("socket ficou para trás")
+	}
+	if err := run([]string{"-vault", cofre, "-password-stdin", "get", "site"}, strings.NewReader(""), io.Discard, io.Discard); err == nil {
+		t.Fatal("get sem senha funcionou com o agente trancado")
+	}
+}
+
+func TestAgenteOcioso(t *testing.T) {
+	dir := t.TempDir()
+	cofre := filepath.Join(dir, "cofre.json")
+	t.Setenv("SENHAS_AGENT_SOCK", filepath.Join(dir, "agente", "agent.sock"))
+	senhas(t, cofre, "Mestra\n", "init", "-kdf", "pbkdf2")
+
+	fim := iniciarAgente(t, cofre, "Mestra", "-timeout", "100ms")
+	esperarFim(t, fim)
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// SIGUSR1 tranca o agente (kill -USR1)
+var sinaisTrancar = []os.Signal{syscall.SIGUSR1}
+
+// o diretório do socket precisa ser do usuário e fechado para os outros
+func dirPrivado(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s pertence a outro usuário", dir)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s acessível a outros usuários (use chmod 700)", dir)
+	}
+	return nil
+}
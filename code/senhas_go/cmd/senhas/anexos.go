@@ -0,0 +1,148 @@
+// anexos.go
+// Comando attach: anexos cifrados das entradas (chaves SSH, certificados,
+// PDFs de códigos de recuperação).
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+const usoAttach = `uso: senhas attach <subcomando> [opções]
+
+subcomandos:
+  add <local> <arquivo>   anexa o arquivo à entrada (-name troca o nome)
+  list <local>            lista os anexos da entrada
+  get <local> <nome>      decifra o anexo em -out (ou no stdout)
+  rm <local> <nome>       apaga o anexo
+`
+
+var subAttach = map[string]func(a *app, args []string) error{
+	"add":  (*app).attachAdd,
+	"list": (*app).attachList,
+	"get":  (*app).attachGet,
+	"rm":   (*app).attachRm,
+}
+
+func (a *app) cmdAttach(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.errOut, usoAttach)
+		return errUso
+	}
+	sub, ok := subAttach[args[0]]
+	if !ok {
+		fmt.Fprintf(a.errOut, "subcomando desconhecido: %q\n\n%s", args[0], usoAttach)
+		return errUso
+	}
+	return sub(a, args[1:])
+}
+
+func (a *app) attachAdd(args []string) error {
+	fs := a.flags("attach add", "[opções] <local> <arquivo>")
+	nome := fs.String("name", "", "nome do anexo (padrão: nome do arquivo)")
+	local, arquivo, err := parseDois(fs, args)
+	if err != nil {
+		return err
+	}
+	if *nome == "" {
+		*nome = filepath.Base(arquivo)
+	}
+	f, err := os.Open(arquivo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	anexo, err := v.AddAttachment(local, *nome, f)
+	if err != nil {
+		return err
+	}
+	return a.feito(anexo, fmt.Sprintf("anexo %s incluído em %s (%d bytes)", anexo.Nome, local, anexo.Tamanho))
+}
+
+func (a *app) attachList(args []string) error {
+	fs := a.flags("attach list", "[opções] <local>")
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	anexos, err := v.Attachments(local)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, x := range anexos {
+		fmt.Fprintf(&b, "%s\t%d\t%s\n", x.Nome, x.Tamanho, x.Tipo)
+	}
+	return a.saida(anexos, b.String())
+}
+
+// sem -out o conteúdo vai para o stdout, então -json não se aplica
+func (a *app) attachGet(args []string) error {
+	fs := a.flags("attach get", "[opções] <local> <nome>")
+	saida := fs.String("out", "", "arquivo de saída (criado com permissão 0600; padrão: stdout)")
+	local, nome, err := parseDois(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if *saida == "" {
+		_, err := v.GetAttachment(local, nome, a.out)
+		return err
+	}
+	f, err := os.OpenFile(*saida, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	anexo, err := v.GetAttachment(local, nome, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// não deixa conteúdo parcial ou adulterado para trás
+		os.Remove(*saida)
+		return err
+	}
+	return a.feito(anexo, "anexo gravado em "+*saida)
+}
+
+func (a *app) attachRm(args []string) error {
+	fs := a.flags("attach rm", "[opções] <local> <nome>")
+	local, nome, err := parseDois(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if err := v.RemoveAttachment(local, nome); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"local": local, "anexo": nome}, "anexo "+nome+" apagado")
+}
+
+// anexos na saída de get, sem a chave
+func semChave(as []vault.Attachment) []vault.Attachment {
+	res := []vault.Attachment{}
+	for _, x := range as {
+		x.Chave = ""
+		res = append(res, x)
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+// auditoria.go
+// Comando audit: liga o log de auditoria do cofre, confere a cadeia de
+// registros e lista as operações.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// registro com o local resolvido (o log só guarda o ID da entrada)
+type itemAuditoria struct {
+	vault.AuditRecord
+	Local string `json:"local,omitempty"`
+}
+
+func (a *app) cmdAudit(args []string) error {
+	fs := a.flags("audit", "[opções]")
+	ligar := fs.Bool("enable", false, "liga o log de auditoria do cofre")
+	ultimos := fs.Int("last", 0, "mostra só os últimos N registros (0 = todos)")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if *ligar {
+		if err := v.EnableAuditLog(); err != nil {
+			return err
+		}
+		return a.feito(map[string]bool{"auditoria": true}, "auditoria ligada")
+	}
+	recs, err := v.VerifyAuditLog()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.errOut, "log íntegro: %d registros\n", len(recs))
+	if *ultimos > 0 && *ultimos < len(recs) {
+		recs = recs[len(recs)-*ultimos:]
+	}
+	itens := []itemAuditoria{}
+	var b strings.Builder
+	for _, r := range recs {
+		it := itemAuditoria{AuditRecord: r}
+		nome := "-"
+		if r.Entrada != "" {
+			if it.Local, err = v.LocalByID(r.Entrada); err != nil {
+				nome = r.Entrada
+			} else {
+				nome = it.Local
+			}
+		}
+		itens = append(itens, it)
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%s\t%s\n", r.Seq, r.Quando.Local().Format("2006-01-02 15:04:05"), r.Op, nome, r.Ator)
+	}
+	return a.saida(itens, b.String())
+}
+
+// ator dos registros de auditoria feitos pelo cliente: usuário@máquina
+func atorLocal() string {
+	nome := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		nome = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		return nome + "@" + host
+	}
+	return nome
+}
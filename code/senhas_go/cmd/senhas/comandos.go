@@ -0,0 +1,688 @@
+// comandos.go
+// Subcomandos do cliente.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// derivações aceitas em init e passwd
+var kdfs = map[string]vault.KDFParams{
+	"argon2id": vault.DefaultKDF,
+	"pbkdf2":   {Algoritmo: vault.KDFPBKDF2, Iteracoes: 600000},
+}
+
+func escolherKDF(nome string) (vault.KDFParams, error) {
+	kdf, ok := kdfs[nome]
+	if !ok {
+		return vault.KDFParams{}, fmt.Errorf("kdf desconhecido: %q (use argon2id ou pbkdf2)", nome)
+	}
+	return kdf, nil
+}
+
+func (a *app) cmdInit(args []string) error {
+	fs := a.flags("init", "[opções]")
+	kdf := fs.String("kdf", "argon2id", "derivação da chave: argon2id ou pbkdf2")
+	recuperacao := fs.Bool("recovery", false, "gera e imprime uma chave de recuperação")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	params, err := escolherKDF(*kdf)
+	if err != nil {
+		return err
+	}
+	if _, err := a.storage.Load(a.cofre); err == nil {
+		return fmt.Errorf("%s já existe", a.cofre)
+	}
+	if err := os.MkdirAll(filepath.Dir(a.cofre), 0o700); err != nil {
+		return err
+	}
+	senha, err := a.novaSenha("Nova senha-mestre: ")
+	if err != nil {
+		return err
+	}
+	var v *vault.Vault
+	if a.membro != "" {
+		v, err = vault.CreateSharedVault(a.cofre, a.membro, senha, a.storage, params)
+	} else {
+		v, err = vault.CreateVaultWithKDF(a.cofre, senha, a.storage, params)
+	}
+	if err != nil {
+		return err
+	}
+	a.visto(a.cofre, v)
+	if *recuperacao {
+		codigo, err := v.AddRecoveryKey()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(a.errOut, "cofre criado em "+a.cofre+"; guarde a chave de recuperação em lugar seguro:")
+		return a.saida(map[string]string{"cofre": a.cofre, "recuperacao": codigo}, codigo+"\n")
+	}
+	return a.feito(map[string]string{"cofre": a.cofre}, "cofre criado em "+a.cofre)
+}
+
+// opções de geração de senha de add e update
+type geracao struct {
+	gerar   bool
+	frase   bool
+	tamanho int
+	mostrar bool
+}
+
+func (g *geracao) flags(fs *flag.FlagSet) {
+	fs.BoolVar(&g.gerar, "generate", false, "gera uma senha aleatória em vez de perguntar")
+	fs.BoolVar(&g.frase, "passphrase", false, "gera uma frase-senha (diceware) em vez de perguntar")
+	fs.IntVar(&g.tamanho, "length", vault.DefaultPasswordPolicy.Tamanho, "tamanho da senha gerada")
+	fs.BoolVar(&g.mostrar, "show", false, "imprime a senha em stdout")
+}
+
+// gera a senha ou pergunta pela senha da entrada
+func (a *app) senhaEntrada(local string, g geracao) (string, error) {
+	switch {
+	case g.frase:
+		return vault.GeneratePassphrase(vault.DefaultPassphrasePolicy)
+	case g.gerar:
+		p := vault.DefaultPasswordPolicy
+		p.Tamanho = g.tamanho
+		return vault.GeneratePassword(p)
+	}
+	return a.novaSenha("Senha de " + local + ": ")
+}
+
+// campos livres nome=valor
+func campos(l lista) (map[string]string, error) {
+	m := map[string]string{}
+	for _, c := range l {
+		nome, valor, ok := strings.Cut(c, "=")
+		if !ok || nome == "" {
+			return nil, fmt.Errorf("campo inválido %q (use nome=valor)", c)
+		}
+		m[nome] = valor
+	}
+	return m, nil
+}
+
+func (a *app) cmdAdd(args []string) error {
+	fs := a.flags("add", "[opções] <local>")
+	e := vault.Entry{}
+	var urls, tags, extras lista
+	fs.StringVar(&e.Usuario, "user", "", "usuário")
+	fs.Var(&urls, "url", "URL do site (pode repetir)")
+	fs.Var(&tags, "tag", "tag (pode repetir)")
+	fs.StringVar(&e.Notas, "notes", "", "notas")
+	fs.Var(&extras, "field", "campo livre nome=valor (pode repetir)")
+	fs.StringVar(&e.TOTP, "totp", "", "URI otpauth:// ou segredo base32")
+	var g geracao
+	g.flags(fs)
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	e.Local, e.URLs, e.Tags = local, urls, tags
+	if len(extras) > 0 {
+		if e.Campos, err = campos(extras); err != nil {
+			return err
+		}
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if e.Senha, err = a.senhaEntrada(local, g); err != nil {
+		return err
+	}
+	if err := v.AddEntry(e); err != nil {
+		return err
+	}
+	if g.mostrar {
+		return a.saida(map[string]string{"local": local, "senha": e.Senha}, e.Senha+"\n")
+	}
+	return a.feito(map[string]string{"local": local}, "entrada "+local+" adicionada")
+}
+
+// entrada na saída de get: senha e segredo TOTP só com -show; as senhas
+// anteriores só pelo comando history e os anexos sem a chave
+type saidaEntrada struct {
+	vault.Entry
+	Senha     string             `json:"senha,omitempty"`
+	TOTP      string             `json:"totp,omitempty"`
+	Historico any                `json:"historico,omitempty"`
+	Codigo    string             `json:"codigo_totp,omitempty"`
+	Restante  int                `json:"restante_totp,omitempty"`
+	Anexos    []vault.Attachment `json:"anexos,omitempty"` // sem a chave
+}
+
+func (s saidaEntrada) texto() string {
+	var b strings.Builder
+	linha := func(nome, valor string) {
+		if valor != "" {
+			fmt.Fprintf(&b, "%-10s %s\n", nome+":", valor)
+		}
+	}
+	linha("local", s.Local)
+	linha("usuario", s.Usuario)
+	linha("senha", s.Senha)
+	for _, u := range s.URLs {
+		linha("url", u)
+	}
+	linha("tags", strings.Join(s.Tags, ", "))
+	nomes := make([]string, 0, len(s.Campos))
+	for k := range s.Campos {
+		nomes = append(nomes, k)
+	}
+	sort.Strings(nomes)
+	for _, k := range nomes {
+		linha(k, s.Campos[k])
+	}
+	if s.Codigo != "" {
+		linha("totp", fmt.Sprintf("%s (%ds)", s.Codigo, s.Restante))
+	}
+	for _, x := range s.Anexos {
+		linha("anexo", fmt.Sprintf("%s (%d bytes)", x.Nome, x.Tamanho))
+	}
+	linha("alterado", s.Alterado.Local().Format(time.DateTime))
+	if s.Notas != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.Notas)
+	}
+	return b.String()
+}
+
+func (a *app) cmdGet(args []string) error {
+	fs := a.flags("get", "[opções] <local>")
+	mostrar := fs.Bool("show", false, "inclui a senha, o segredo e o código TOTP")
+	soSenha := fs.Bool("password", false, "imprime só a senha (para scripts)")
+	soTOTP := fs.Bool("totp", false, "imprime só o código TOTP atual")
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	e, err := a.entrada(local)
+	if err != nil {
+		return err
+	}
+	var totp vault.TOTPConfig
+	if e.TOTP != "" && (*soTOTP || *mostrar) {
+		if totp, err = vault.ParseTOTP(e.TOTP); err != nil {
+			return err
+		}
+	}
+	switch {
+	case *soSenha:
+		_, err := fmt.Fprintln(a.out, e.Senha)
+		return err
+	case *soTOTP:
+		if e.TOTP == "" {
+			return fmt.Errorf("local %q não tem totp", local)
+		}
+		codigo, _ := totp.Code(time.Now())
+		_, err := fmt.Fprintln(a.out, codigo)
+		return err
+	}
+	s := saidaEntrada{Entry: e, Anexos: semChave(e.Anexos)}
+	if *mostrar {
+		s.Senha, s.TOTP = e.Senha, e.TOTP
+		if e.TOTP != "" {
+			s.Codigo, s.Restante = totp.Code(time.Now())
+		}
+	}
+	return a.saida(s, s.texto())
+}
+
+// item da saída de list
+type itemLista struct {
+	Local   string   `json:"local"`
+	Usuario string   `json:"usuario"`
+	URLs    []string `json:"urls,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func (a *app) cmdList(args []string) error {
+	fs := a.flags("list", "[opções]")
+	tag := fs.String("tag", "", "só entradas com esta tag")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	itens, err := a.itens(*tag)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, it := range itens {
+		fmt.Fprintln(&b, it.Local)
+	}
+	return a.saida(itens, b.String())
+}
+
+// entradas vivas em ordem de local, filtradas pela tag (se houver)
+func listar(v *vault.Vault, tag string) ([]itemLista, error) {
+	locais, err := v.ListLocais()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(locais)
+	itens := []itemLista{}
+	for _, l := range locais {
+		e, err := v.GetEntry(l)
+		if err != nil {
+			return nil, err
+		}
+		if tag != "" && !temTag(e.Tags, tag) {
+			continue
+		}
+		itens = append(itens, itemLista{Local: e.Local, Usuario: e.Usuario, URLs: e.URLs, Tags: e.Tags})
+	}
+	return itens, nil
+}
+
+// resultado da busca (sem senhas) e o total antes da paginação
+func buscar(v *vault.Vault, q vault.Query) ([]itemLista, int, error) {
+	r, err := v.Search(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	itens := []itemLista{}
+	for _, e := range r.Entradas {
+		itens = append(itens, itemLista{Local: e.Local, Usuario: e.Usuario, URLs: e.URLs, Tags: e.Tags})
+	}
+	return itens, r.Total, nil
+}
+
+func (a *app) cmdSearch(args []string) error {
+	fs := a.flags("search", "[opções] [texto]")
+	var tags lista
+	fuzzy := fs.Bool("fuzzy", false, "aceita o texto como subsequência (gthb acha github)")
+	dominio := fs.String("domain", "", "host ou URL: acha entradas do domínio, de um pai ou de um subdomínio")
+	fs.Var(&tags, "tag", "só entradas com esta tag (pode repetir)")
+	ordem := fs.String("sort", "relevancia", "ordem: relevancia, local, usuario, alterado ou senha")
+	desc := fs.Bool("desc", false, "ordem decrescente")
+	inicio := fs.Int("offset", 0, "pula os primeiros resultados")
+	limite := fs.Int("limit", 0, "máximo de resultados (0 = todos)")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 1 {
+		fs.Usage()
+		return errUso
+	}
+	q := vault.Query{
+		Fuzzy:   *fuzzy,
+		Dominio: *dominio,
+		Tags:    tags,
+		Ordem:   vault.SortField(*ordem),
+		Desc:    *desc,
+		Inicio:  *inicio,
+		Limite:  *limite,
+	}
+	if len(pos) == 1 {
+		q.Texto = pos[0]
+	}
+	itens, total, err := a.busca(q)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, it := range itens {
+		fmt.Fprintf(&b, "%s\t%s\n", it.Local, it.Usuario)
+	}
+	if len(itens) < total && !a.json {
+		fmt.Fprintf(a.errOut, "%d de %d resultados\n", len(itens), total)
+	}
+	return a.saida(map[string]any{"itens": itens, "total": total}, b.String())
+}
+
+func temTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *app) cmdUpdate(args []string) error {
+	fs := a.flags("update", "[opções] <local>")
+	var urls, tags, extras lista
+	usuario := fs.String("user", "", "novo usuário")
+	fs.Var(&urls, "url", "substitui as URLs (pode repetir)")
+	fs.Var(&tags, "tag", "substitui as tags (pode repetir)")
+	notas := fs.String("notes", "", "novas notas")
+	fs.Var(&extras, "field", "altera um campo livre nome=valor; nome= apaga (pode repetir)")
+	totp := fs.String("totp", "", "novo segredo TOTP; vazio remove")
+	novoLocal := fs.String("rename", "", "novo nome do local")
+	trocar := fs.Bool("password", false, "pergunta a nova senha")
+	var g geracao
+	g.flags(fs)
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	alterados := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		if !flagsComuns[f.Name] {
+			alterados[f.Name] = true
+		}
+	})
+	if len(alterados) == 0 {
+		return errors.New("nada a alterar")
+	}
+	novos, err := campos(extras)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	e, err := v.GetEntry(local)
+	if err != nil {
+		return err
+	}
+	if alterados["user"] {
+		e.Usuario = *usuario
+	}
+	if alterados["url"] {
+		e.URLs = urls
+	}
+	if alterados["tag"] {
+		e.Tags = tags
+	}
+	if alterados["notes"] {
+		e.Notas = *notas
+	}
+	if alterados["totp"] {
+		e.TOTP = *totp
+	}
+	if alterados["rename"] {
+		e.Local = *novoLocal
+	}
+	for k, valor := range novos {
+		if e.Campos == nil {
+			e.Campos = map[string]string{}
+		}
+		if valor == "" {
+			delete(e.Campos, k)
+		} else {
+			e.Campos[k] = valor
+		}
+	}
+	novaSenha := *trocar || g.gerar || g.frase
+	if novaSenha {
+		if e.Senha, err = a.senhaEntrada(e.Local, g); err != nil {
+			return err
+		}
+	}
+	if err := v.UpdateEntry(local, e); err != nil {
+		return err
+	}
+	if g.mostrar && novaSenha {
+		return a.saida(map[string]string{"local": e.Local, "senha": e.Senha}, e.Senha+"\n")
+	}
+	return a.feito(map[string]string{"local": e.Local}, "entrada "+e.Local+" alterada")
+}
+
+func (a *app) cmdRm(args []string) error {
+	fs := a.flags("rm", "<local>")
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if err := v.DeleteLocal(local); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"local": local}, "entrada "+local+" apagada")
+}
+
+func (a *app) cmdExport(args []string) error {
+	fs := a.flags("export", "[opções]")
+	formato := fs.String("format", "encrypted", "encrypted, bitwarden, keepass, 1password, chrome ou firefox")
+	saida := fs.String("out", "", "arquivo de saída (padrão: stdout)")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	exportar := func(w io.Writer) error { return v.Export(w, vault.Format(*formato)) }
+	if *formato == "encrypted" {
+		senha, err := a.novaSenha("Senha da exportação: ")
+		if err != nil {
+			return err
+		}
+		exportar = func(w io.Writer) error { return v.ExportEncrypted(w, senha) }
+	}
+	if *saida == "" {
+		return exportar(a.out)
+	}
+	f, err := os.OpenFile(*saida, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := exportar(f); err != nil {
+		f.Close()
+		os.Remove(*saida)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"arquivo": *saida}, "exportado para "+*saida)
+}
+
+var resolvers = map[string]vault.ConflictResolver{
+	"newest": vault.PreferNewest,
+	"ours":   vault.PreferOurs,
+	"theirs": vault.PreferTheirs,
+}
+
+func (a *app) cmdSync(args []string) error {
+	fs := a.flags("sync", "[opções] <outro-cofre>")
+	estrategia := fs.String("strategy", "newest", "conflitos: newest (mais recente), ours (este cofre) ou theirs (o outro)")
+	outro, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	resolver, ok := resolvers[*estrategia]
+	if !ok {
+		return fmt.Errorf("estratégia desconhecida: %q", *estrategia)
+	}
+	senha := ""
+	if a.chave == "" {
+		if senha, err = a.lerSenha("Senha-mestre: "); err != nil {
+			return err
+		}
+	}
+	v, err := a.abrirComo(senha)
+	if err != nil {
+		return err
+	}
+	senhaOutro, err := a.lerSenha("Senha-mestre de " + outro + " (Enter para a mesma): ")
+	if err != nil {
+		return err
+	}
+	if senhaOutro == "" {
+		senhaOutro = senha
+	}
+	alvo, err := a.abrirCofre(outro, func() (*vault.Vault, error) {
+		return vault.OpenVault(outro, senhaOutro, a.storage)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", outro, err)
+	}
+	rep, err := v.Sync(alvo, resolver)
+	if err != nil {
+		return err
+	}
+	conflitos := []string{}
+	for _, c := range rep.Conflitos {
+		conflitos = append(conflitos, c.Local)
+	}
+	resumo := func(c vault.SyncChanges) string {
+		return fmt.Sprintf("%d adicionadas, %d alteradas, %d apagadas", len(c.Adicionadas), len(c.Atualizadas), len(c.Apagadas))
+	}
+	texto := fmt.Sprintf("%s: %s\n%s: %s\n", a.cofre, resumo(rep.Origem), outro, resumo(rep.Destino))
+	if len(conflitos) > 0 {
+		texto += "conflitos: " + strings.Join(conflitos, ", ") + "\n"
+	}
+	return a.saida(map[string]any{"origem": rep.Origem, "destino": rep.Destino, "conflitos": conflitos}, texto)
+}
+
+func (a *app) cmdPasswd(args []string) error {
+	fs := a.flags("passwd", "[opções]")
+	kdf := fs.String("kdf", "", "troca também a derivação: argon2id ou pbkdf2")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	params := v.KDF()
+	if *kdf != "" {
+		if params, err = escolherKDF(*kdf); err != nil {
+			return err
+		}
+	}
+	senha, err := a.novaSenha("Nova senha-mestre: ")
+	if err != nil {
+		return err
+	}
+	if err := v.Rekey(senha, params); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"cofre": a.cofre}, "senha-mestre alterada")
+}
+
+func (a *app) cmdRecovery(args []string) error {
+	fs := a.flags("recovery", "[opções]")
+	rm := fs.Bool("rm", false, "apaga a chave de recuperação")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if *rm {
+		if err := v.RemoveRecoveryKey(); err != nil {
+			return err
+		}
+		return a.feito(map[string]string{"cofre": a.cofre}, "chave de recuperação apagada")
+	}
+	codigo, err := v.AddRecoveryKey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(a.errOut, "chave de recuperação nova (a anterior deixou de valer); guarde em lugar seguro:")
+	return a.saida(map[string]string{"cofre": a.cofre, "recuperacao": codigo}, codigo+"\n")
+}
+
+// divide a chave de dados em partes, uma por linha, para os custodiantes
+func (a *app) cmdShares(args []string) error {
+	fs := a.flags("shares", "[opções]")
+	k := fs.Int("k", 3, "partes necessárias para abrir")
+	n := fs.Int("n", 5, "total de partes")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	partes, err := v.SplitKey(*k, *n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.errOut, "%d partes, %d abrem o cofre (valem até a chave de dados mudar: passwd, member rm, member rotate); entregue cada uma a um custodiante:\n", *n, *k)
+	return a.saida(map[string]any{"cofre": a.cofre, "k": *k, "partes": partes}, strings.Join(partes, "\n")+"\n")
+}
+
+// abre com a chave de recuperação (ou com as partes da chave de dados)
+// e define a senha nova (num cofre compartilhado, a do membro de -member)
+func (a *app) cmdRecover(args []string) error {
+	fs := a.flags("recover", "[opções]")
+	porPartes := fs.Bool("shares", false, "pede as partes da chave de dados em vez da chave de recuperação")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	var abrir func() (*vault.Vault, error)
+	if *porPartes {
+		partes, err := a.lerPartes()
+		if err != nil {
+			return err
+		}
+		abrir = func() (*vault.Vault, error) {
+			return vault.OpenVaultWithShares(a.cofre, partes, a.storage)
+		}
+	} else {
+		codigo, err := a.lerSenha("Chave de recuperação: ")
+		if err != nil {
+			return err
+		}
+		abrir = func() (*vault.Vault, error) {
+			return vault.OpenVaultWithRecoveryKey(a.cofre, codigo, a.storage)
+		}
+	}
+	v, err := a.abrirCofre(a.cofre, abrir)
+	if err != nil {
+		return err
+	}
+	if v.Shared() && a.membro == "" {
+		return errors.New("cofre compartilhado: informe o membro com -member")
+	}
+	senha, err := a.novaSenha("Nova senha-mestre: ")
+	if err != nil {
+		return err
+	}
+	if v.Shared() {
+		err = v.ResetMemberPassword(a.membro, senha, vault.KDFParams{})
+	} else {
+		err = v.Rekey(senha, v.KDF())
+	}
+	if err != nil {
+		return err
+	}
+	msg := "senha-mestre redefinida"
+	if *porPartes {
+		msg += " (a chave de dados mudou: as partes deixaram de valer, gere outras com shares)"
+	}
+	return a.feito(map[string]string{"cofre": a.cofre}, msg)
+}
+
+// lê a primeira parte, que diz quantas são necessárias, e as demais
+func (a *app) lerPartes() ([]string, error) {
+	primeira, err := a.lerSenha("Parte 1: ")
+	if err != nil {
+		return nil, err
+	}
+	k, err := vault.ShareThreshold(primeira)
+	if err != nil {
+		return nil, err
+	}
+	partes := []string{primeira}
+	for i := 2; i <= k; i++ {
+		p, err := a.lerSenha(fmt.Sprintf("Parte %d de %d: ", i, k))
+		if err != nil {
+			return nil, err
+		}
+		partes = append(partes, p)
+	}
+	return partes, nil
+}
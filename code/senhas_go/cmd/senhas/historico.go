@@ -0,0 +1,119 @@
+// historico.go
+// Comandos history, restore e stale: senhas anteriores de uma entrada e
+// entradas com senha antiga (para relatórios de rotação).
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// senha anterior na saída de history: a senha só com -show
+type saidaHistorico struct {
+	Revisao int       `json:"revisao"`
+	Usuario string    `json:"usuario"`
+	Senha   string    `json:"senha,omitempty"`
+	Desde   time.Time `json:"desde"`
+	Ate     time.Time `json:"ate"`
+}
+
+func (a *app) cmdHistory(args []string) error {
+	fs := a.flags("history", "[opções] <local>")
+	mostrar := fs.Bool("show", false, "inclui as senhas")
+	local, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	hs, err := v.History(local)
+	if err != nil {
+		return err
+	}
+	res := []saidaHistorico{}
+	var b strings.Builder
+	for _, h := range hs {
+		s := saidaHistorico{Revisao: h.Revisao, Usuario: h.Usuario, Desde: h.Desde, Ate: h.Ate}
+		if *mostrar {
+			s.Senha = h.Senha
+		}
+		res = append(res, s)
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%s", s.Revisao, data(s.Desde), data(s.Ate), s.Usuario)
+		if s.Senha != "" {
+			fmt.Fprintf(&b, "\t%s", s.Senha)
+		}
+		b.WriteString("\n")
+	}
+	return a.saida(res, b.String())
+}
+
+func (a *app) cmdRestore(args []string) error {
+	fs := a.flags("restore", "[opções] <local> <revisão>")
+	local, num, err := parseDois(fs, args)
+	if err != nil {
+		return err
+	}
+	rev, err := strconv.Atoi(num)
+	if err != nil {
+		return fmt.Errorf("revisão inválida: %q", num)
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if err := v.Restore(local, rev); err != nil {
+		return err
+	}
+	return a.feito(map[string]any{"local": local, "revisao": rev},
+		fmt.Sprintf("entrada %s restaurada para a revisão %d", local, rev))
+}
+
+// entrada com senha antiga na saída de stale
+type itemIdade struct {
+	Local   string    `json:"local"`
+	Usuario string    `json:"usuario"`
+	Desde   time.Time `json:"desde"` // zero se a entrada não tem data
+	Dias    int       `json:"dias"`
+}
+
+func (a *app) cmdStale(args []string) error {
+	fs := a.flags("stale", "[opções]")
+	dias := fs.Int("days", 90, "idade mínima da senha, em dias")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	es, err := v.PasswordsOlderThan(time.Duration(*dias) * 24 * time.Hour)
+	if err != nil {
+		return err
+	}
+	itens := []itemIdade{}
+	var b strings.Builder
+	for _, e := range es {
+		it := itemIdade{Local: e.Local, Usuario: e.Usuario, Desde: e.PasswordDate()}
+		idade := "?"
+		if !it.Desde.IsZero() {
+			it.Dias = int(time.Since(it.Desde).Hours() / 24)
+			idade = strconv.Itoa(it.Dias)
+		}
+		itens = append(itens, it)
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", idade, it.Local, it.Usuario)
+	}
+	return a.saida(itens, b.String())
+}
+
+// data local para a saída em texto ("-" se não houver)
+func data(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,300 @@
+// main.go
+// Cliente de linha de comando do cofre de senhas.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+const uso = `uso: senhas [opções] <comando> [argumentos]
+
+comandos:
+  init                  cria um cofre novo
+  add <local>           adiciona uma entrada
+  get <local>           mostra uma entrada (a senha só com -show ou -password)
+  list                  lista os locais
+  search [texto]        busca por texto, domínio (-domain) ou tag, com ordem e paginação
+  update <local>        altera uma entrada
+  rm <local>            apaga uma entrada
+  history <local>       lista as senhas anteriores de uma entrada
+  restore <local> <rev> volta à senha de uma revisão do histórico
+  attach <subcomando>   anexos cifrados de uma entrada (add, list, get, rm)
+  stale                 lista as entradas com senha mais velha que -days (90)
+  export                exporta as entradas (texto claro ou cifrado)
+  sync <outro-cofre>    sincroniza com outro cofre
+  passwd                troca a senha-mestre
+  recovery              gera (ou com -rm apaga) a chave de recuperação
+  recover               define uma senha nova usando a chave de recuperação
+                        (ou, com -shares, as partes da chave de dados)
+  shares                divide a chave de dados em partes (-k de -n)
+  agent                 mantém o cofre aberto para get/list (como o ssh-agent)
+  member <subcomando>   membros de cofre compartilhado (list, add, rm, share, rotate, keygen)
+  audit                 confere e lista o log de auditoria (ou o liga com -enable)
+  serve                 API HTTP do cofre para serviços, com acesso por token
+  token <subcomando>    tokens dos clientes do serve (add, list, rm)
+
+opções (valem antes ou depois do comando):
+  -vault caminho        arquivo do cofre (padrão: $SENHAS_VAULT ou ~/.senhas.json)
+  -json                 saída em JSON
+  -password-stdin       lê as senhas da entrada padrão, uma por linha,
+                        começando pela senha-mestre (para scripts)
+  -member nome          membro do cofre compartilhado (padrão: $SENHAS_MEMBER)
+  -key arquivo          abre como o membro com a chave X25519 do arquivo, sem senha
+
+Use "senhas <comando> -h" para as opções de cada comando.
+`
+
+// errUso indica argumentos inválidos (a ajuda já foi impressa)
+var errUso = errors.New("argumentos inválidos")
+
+// estado de uma execução do cliente
+type app struct {
+	cofre      string
+	json       bool
+	senhaStdin bool
+	membro     string // -member
+	chave      string // -key: arquivo com a chave privada do membro
+	storage    vault.Storage
+	in         *bufio.Reader
+	out        io.Writer               // dados pedidos (entradas, listas, exportações)
+	errOut     io.Writer               // mensagens e perguntas
+	abertos    map[string]*vault.Vault // cofres usados, para lembrar a versão
+}
+
+var comandos = map[string]func(a *app, args []string) error{
+	"init":     (*app).cmdInit,
+	"add":      (*app).cmdAdd,
+	"get":      (*app).cmdGet,
+	"list":     (*app).cmdList,
+	"search":   (*app).cmdSearch,
+	"update":   (*app).cmdUpdate,
+	"rm":       (*app).cmdRm,
+	"history":  (*app).cmdHistory,
+	"restore":  (*app).cmdRestore,
+	"attach":   (*app).cmdAttach,
+	"stale":    (*app).cmdStale,
+	"export":   (*app).cmdExport,
+	"sync":     (*app).cmdSync,
+	"passwd":   (*app).cmdPasswd,
+	"recovery": (*app).cmdRecovery,
+	"recover":  (*app).cmdRecover,
+	"shares":   (*app).cmdShares,
+	"agent":    (*app).cmdAgent,
+	"member":   (*app).cmdMember,
+	"audit":    (*app).cmdAudit,
+	"serve":    (*app).cmdServe,
+	"token":    (*app).cmdToken,
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUso):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "senhas:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	a := &app{
+		cofre:   cofrePadrao(),
+		membro:  os.Getenv("SENHAS_MEMBER"),
+		storage: vault.FileStorage{Backups: 3},
+		in:      bufio.NewReader(stdin),
+		out:     stdout,
+		errOut:  stderr,
+	}
+	fs := a.flags("", "")
+	fs.Usage = func() { fmt.Fprint(stderr, uso) }
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUso
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUso
+	}
+	cmd, ok := comandos[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "comando desconhecido: %q\n\n", fs.Arg(0))
+		fs.Usage()
+		return errUso
+	}
+	err := cmd(a, fs.Args()[1:])
+	// a versão é lembrada mesmo se o comando falhou depois de gravar
+	if verr := a.lembrarVersoes(); err == nil {
+		err = verr
+	}
+	return err
+}
+
+// $SENHAS_VAULT ou ~/.senhas.json
+func cofrePadrao() string {
+	if p := os.Getenv("SENHAS_VAULT"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".senhas.json"
+	}
+	return filepath.Join(home, ".senhas.json")
+}
+
+// FlagSet de um comando, já com as opções comuns
+func (a *app) flags(nome, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("senhas "+nome, flag.ContinueOnError)
+	fs.SetOutput(a.errOut)
+	fs.StringVar(&a.cofre, "vault", a.cofre, "arquivo do cofre")
+	fs.BoolVar(&a.json, "json", a.json, "saída em JSON")
+	fs.BoolVar(&a.senhaStdin, "password-stdin", a.senhaStdin, "lê as senhas da entrada padrão, uma por linha")
+	fs.StringVar(&a.membro, "member", a.membro, "membro do cofre compartilhado")
+	fs.StringVar(&a.chave, "key", a.chave, "arquivo com a chave X25519 do membro")
+	fs.Usage = func() {
+		fmt.Fprintf(a.errOut, "uso: senhas %s %s\n\nopções:\n", nome, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// opções comuns a todos os comandos (não contam como alteração no update)
+var flagsComuns = map[string]bool{"vault": true, "json": true, "password-stdin": true, "member": true, "key": true}
+
+// aceita opções antes e depois dos argumentos ("get site -show");
+// tudo depois de "--" é argumento
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	pos := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			return nil, errUso
+		}
+		resto := fs.Args()
+		if n := len(args) - len(resto); n > 0 && args[n-1] == "--" {
+			return append(pos, resto...), nil
+		}
+		if len(resto) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, resto[0])
+		args = resto[1:]
+	}
+}
+
+// exige exatamente um argumento (o local ou o caminho)
+func parseUm(fs *flag.FlagSet, args []string) (string, error) {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return "", errUso
+	}
+	return pos[0], nil
+}
+
+// exige exatamente dois argumentos
+func parseDois(fs *flag.FlagSet, args []string) (string, string, error) {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return "", "", err
+	}
+	if len(pos) != 2 {
+		fs.Usage()
+		return "", "", errUso
+	}
+	return pos[0], pos[1], nil
+}
+
+// não aceita argumentos, só opções
+func parseNenhum(fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUso
+	}
+	return nil
+}
+
+// opção que pode se repetir (-url a -url b)
+type lista []string
+
+func (l *lista) String() string { return strings.Join(*l, ",") }
+
+func (l *lista) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// imprime dados em stdout: JSON com -json, senão o texto
+func (a *app) saida(dados any, texto string) error {
+	if a.json {
+		enc := json.NewEncoder(a.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dados)
+	}
+	_, err := io.WriteString(a.out, texto)
+	return err
+}
+
+// confirma uma operação: JSON em stdout com -json, senão mensagem em stderr
+func (a *app) feito(dados any, msg string) error {
+	if a.json {
+		return a.saida(dados, "")
+	}
+	_, err := fmt.Fprintln(a.errOut, msg)
+	return err
+}
+
+// pede a senha-mestre (a não ser com -key) e abre o cofre
+func (a *app) abrir() (*vault.Vault, error) {
+	senha := ""
+	if a.chave == "" {
+		var err error
+		if senha, err = a.lerSenha("Senha-mestre: "); err != nil {
+			return nil, err
+		}
+	}
+	return a.abrirComo(senha)
+}
+
+// abre o cofre com a senha, como o membro de -member, ou com a chave de -key
+func (a *app) abrirComo(senha string) (*vault.Vault, error) {
+	return a.abrirCofre(a.cofre, func() (*vault.Vault, error) {
+		switch {
+		case a.chave != "":
+			if a.membro == "" {
+				return nil, errors.New("-key exige -member")
+			}
+			priv, err := lerChave(a.chave)
+			if err != nil {
+				return nil, err
+			}
+			return vault.OpenVaultWithKey(a.cofre, a.membro, priv, a.storage)
+		case a.membro != "":
+			return vault.OpenVaultMember(a.cofre, a.membro, senha, a.storage)
+		}
+		return vault.OpenVault(a.cofre, senha, a.storage)
+	})
+}
@@ -0,0 +1,221 @@
+// membros.go
+// Comando member: membros de cofre compartilhado, por senha ou por chave
+// X25519, e geração do par de chaves de um membro.
+
+package main
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+const usoMember = `uso: senhas member <subcomando> [opções]
+
+subcomandos:
+  list                  lista os membros
+  add <nome>            inclui um membro por senha (ou por chave com -pubkey)
+  rm <nome>             remove um membro e troca a chave de dados
+  share <nome>          converte o cofre de senha única em compartilhado
+  rotate                troca a chave de dados
+  keygen -out arquivo   gera o par de chaves X25519 de um membro
+`
+
+var subMember = map[string]func(a *app, args []string) error{
+	"list":   (*app).memberList,
+	"add":    (*app).memberAdd,
+	"rm":     (*app).memberRm,
+	"share":  (*app).memberShare,
+	"rotate": (*app).memberRotate,
+	"keygen": (*app).memberKeygen,
+}
+
+func (a *app) cmdMember(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.errOut, usoMember)
+		return errUso
+	}
+	sub, ok := subMember[args[0]]
+	if !ok {
+		fmt.Fprintf(a.errOut, "subcomando desconhecido: %q\n\n%s", args[0], usoMember)
+		return errUso
+	}
+	return sub(a, args[1:])
+}
+
+func (a *app) memberList(args []string) error {
+	fs := a.flags("member list", "[opções]")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	membros := v.Members()
+	var b strings.Builder
+	for _, m := range membros {
+		tipo := "chave"
+		if m.Senha {
+			tipo = "senha"
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", m.Nome, tipo)
+	}
+	return a.saida(membros, b.String())
+}
+
+func (a *app) memberAdd(args []string) error {
+	fs := a.flags("member add", "[opções] <nome>")
+	pub := fs.String("pubkey", "", "chave pública X25519 (base64) de um membro por chave")
+	kdf := fs.String("kdf", "argon2id", "derivação da senha do membro: argon2id ou pbkdf2")
+	nome, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	params, err := escolherKDF(*kdf)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if *pub != "" {
+		chave, err := lerPublica(*pub)
+		if err != nil {
+			return err
+		}
+		if err := v.AddMemberKey(nome, chave); err != nil {
+			return err
+		}
+	} else {
+		senha, err := a.novaSenha("Senha de " + nome + ": ")
+		if err != nil {
+			return err
+		}
+		if err := v.AddMember(nome, senha, params); err != nil {
+			return err
+		}
+	}
+	return a.feito(map[string]string{"membro": nome}, "membro "+nome+" incluído")
+}
+
+func (a *app) memberRm(args []string) error {
+	fs := a.flags("member rm", "[opções] <nome>")
+	nome, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if err := v.RemoveMember(nome); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"membro": nome}, "membro "+nome+" removido; chave de dados trocada")
+}
+
+func (a *app) memberShare(args []string) error {
+	fs := a.flags("member share", "[opções] <nome>")
+	kdf := fs.String("kdf", "argon2id", "derivação da senha do membro: argon2id ou pbkdf2")
+	nome, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	params, err := escolherKDF(*kdf)
+	if err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	senha, err := a.novaSenha("Senha de " + nome + ": ")
+	if err != nil {
+		return err
+	}
+	if err := v.Share(nome, senha, params); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"membro": nome}, "cofre compartilhado; abra com -member "+nome)
+}
+
+func (a *app) memberRotate(args []string) error {
+	fs := a.flags("member rotate", "[opções]")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	if err := v.RotateKey(); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"cofre": a.cofre}, "chave de dados trocada")
+}
+
+// grava a chave privada (base64) em -out e imprime a pública
+func (a *app) memberKeygen(args []string) error {
+	fs := a.flags("member keygen", "-out arquivo")
+	saida := fs.String("out", "", "arquivo da chave privada (criado com permissão 0600)")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	if *saida == "" {
+		fs.Usage()
+		return errUso
+	}
+	priv, err := vault.GenerateMemberKey()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(*saida, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(priv.Bytes())); err != nil {
+		f.Close()
+		os.Remove(*saida)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	pub := base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes())
+	return a.saida(map[string]string{"arquivo": *saida, "publica": pub}, pub+"\n")
+}
+
+// lê a chave privada gravada por member keygen
+func lerChave(path string) (*ecdh.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chave, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(chave)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return priv, nil
+}
+
+func lerPublica(b64 string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("chave pública: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("chave pública: %w", err)
+	}
+	return pub, nil
+}
@@ -0,0 +1,67 @@
+// senha.go
+// Leitura de senhas: do terminal sem eco ou, em scripts, da entrada padrão.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// lê uma senha; com -password-stdin consome a próxima linha da entrada
+func (a *app) lerSenha(prompt string) (string, error) {
+	if a.senhaStdin {
+		linha, err := a.in.ReadString('\n')
+		if err != nil && (err != io.EOF || linha == "") {
+			return "", errors.New("senha não recebida na entrada padrão")
+		}
+		return strings.TrimRight(linha, "\r\n"), nil
+	}
+	return lerSenhaTTY(prompt)
+}
+
+// lê uma senha nova; no terminal pede confirmação
+func (a *app) novaSenha(prompt string) (string, error) {
+	senha, err := a.lerSenha(prompt)
+	if err != nil {
+		return "", err
+	}
+	if senha == "" {
+		return "", errors.New("senha vazia")
+	}
+	if a.senhaStdin {
+		return senha, nil
+	}
+	conf, err := lerSenhaTTY("Confirme: ")
+	if err != nil {
+		return "", err
+	}
+	if conf != senha {
+		return "", errors.New("as senhas não conferem")
+	}
+	return senha, nil
+}
+
+// usa /dev/tty para funcionar mesmo com a entrada padrão redirecionada
+func lerSenhaTTY(prompt string) (string, error) {
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		return lerSemEco(tty, tty, prompt)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return lerSemEco(os.Stdin, os.Stderr, prompt)
+	}
+	return "", errors.New("sem terminal para ler a senha; use -password-stdin")
+}
+
+func lerSemEco(f *os.File, eco io.Writer, prompt string) (string, error) {
+	fmt.Fprint(eco, prompt)
+	b, err := term.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(eco)
+	return string(b), err
+}
@@ -0,0 +1,196 @@
+// servidor.go
+// Comandos serve (API HTTP do cofre para serviços internos) e token
+// (tokens dos clientes da API, com escopo por local ou tag).
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/server"
+)
+
+const usoToken = `uso: senhas token <subcomando> [opções]
+
+subcomandos:
+  add <nome>            gera o token de um cliente (escopo com -local e -tag)
+  list                  lista os clientes e seus escopos
+  rm <nome>             revoga o token de um cliente
+`
+
+var subToken = map[string]func(a *app, args []string) error{
+	"add":  (*app).tokenAdd,
+	"list": (*app).tokenList,
+	"rm":   (*app).tokenRm,
+}
+
+// arquivo de tokens padrão, ao lado do cofre
+func (a *app) tokensPadrao() string {
+	return a.cofre + ".tokens.json"
+}
+
+func (a *app) cmdServe(args []string) error {
+	fs := a.flags("serve", "[opções]")
+	addr := fs.String("addr", "127.0.0.1:8420", "endereço de escuta")
+	tokens := fs.String("tokens", "", "arquivo de tokens (padrão: <cofre>.tokens.json)")
+	audit := fs.String("audit", "", "log de auditoria, JSON por linha (padrão: <cofre>.acessos.log)")
+	cert := fs.String("tls-cert", "", "certificado TLS (com -tls-key)")
+	chave := fs.String("tls-key", "", "chave privada TLS")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	if (*cert == "") != (*chave == "") {
+		return errors.New("-tls-cert e -tls-key vão juntos")
+	}
+	if *tokens == "" {
+		*tokens = a.tokensPadrao()
+	}
+	if *audit == "" {
+		*audit = a.cofre + ".acessos.log"
+	}
+	ts, err := server.LoadTokens(*tokens)
+	if err != nil {
+		return err
+	}
+	if len(ts) == 0 {
+		return fmt.Errorf("nenhum token em %s (use senhas token add)", *tokens)
+	}
+	log, err := os.OpenFile(*audit, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	v, err := a.abrir()
+	if err != nil {
+		return err
+	}
+	s, err := server.New(v, ts, log)
+	if err != nil {
+		v.Lock()
+		return err
+	}
+	defer s.Close()
+
+	hs := &http.Server{Addr: *addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	erros := make(chan error, 1)
+	go func() {
+		if *cert != "" {
+			erros <- hs.ListenAndServeTLS(*cert, *chave)
+		} else {
+			erros <- hs.ListenAndServe()
+		}
+	}()
+	sinais := make(chan os.Signal, 1)
+	signal.Notify(sinais, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sinais)
+
+	esquema := "http"
+	if *cert != "" {
+		esquema = "https"
+	}
+	fmt.Fprintf(a.errOut, "servidor em %s://%s (%d tokens, auditoria em %s)\n", esquema, *addr, len(ts), *audit)
+	select {
+	case err := <-erros:
+		return err
+	case sig := <-sinais:
+		fmt.Fprintln(a.errOut, "encerrando:", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return hs.Shutdown(ctx)
+}
+
+func (a *app) cmdToken(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.errOut, usoToken)
+		return errUso
+	}
+	sub, ok := subToken[args[0]]
+	if !ok {
+		fmt.Fprintf(a.errOut, "subcomando desconhecido: %q\n\n%s", args[0], usoToken)
+		return errUso
+	}
+	return sub(a, args[1:])
+}
+
+// o token só é mostrado aqui; o arquivo guarda o hash
+func (a *app) tokenAdd(args []string) error {
+	fs := a.flags("token add", "[opções] <nome>")
+	arquivo := fs.String("tokens", a.tokensPadrao(), "arquivo de tokens")
+	var locais, tags lista
+	fs.Var(&locais, "local", "local ou padrão (db-*) que o cliente acessa (repetível)")
+	fs.Var(&tags, "tag", "tag cujas entradas o cliente acessa (repetível)")
+	escrita := fs.Bool("write", false, "o cliente pode criar, alterar e apagar entradas")
+	nome, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	ts, err := server.LoadTokens(*arquivo)
+	if err != nil {
+		return err
+	}
+	segredo, t, err := server.NewToken(nome)
+	if err != nil {
+		return err
+	}
+	t.Locais, t.Tags, t.Escrita = locais, tags, *escrita
+	if err := server.SaveTokens(*arquivo, append(ts, t)); err != nil {
+		return err
+	}
+	return a.saida(map[string]string{"nome": nome, "token": segredo}, segredo+"\n")
+}
+
+func (a *app) tokenList(args []string) error {
+	fs := a.flags("token list", "[opções]")
+	arquivo := fs.String("tokens", a.tokensPadrao(), "arquivo de tokens")
+	if err := parseNenhum(fs, args); err != nil {
+		return err
+	}
+	ts, err := server.LoadTokens(*arquivo)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, t := range ts {
+		acesso := "leitura"
+		if t.Escrita {
+			acesso = "escrita"
+		}
+		fmt.Fprintf(&b, "%s\t%s\tlocais=%s\ttags=%s\n", t.Nome, acesso, strings.Join(t.Locais, ","), strings.Join(t.Tags, ","))
+	}
+	return a.saida(ts, b.String())
+}
+
+func (a *app) tokenRm(args []string) error {
+	fs := a.flags("token rm", "[opções] <nome>")
+	arquivo := fs.String("tokens", a.tokensPadrao(), "arquivo de tokens")
+	nome, err := parseUm(fs, args)
+	if err != nil {
+		return err
+	}
+	ts, err := server.LoadTokens(*arquivo)
+	if err != nil {
+		return err
+	}
+	resto := ts[:0]
+	for _, t := range ts {
+		if t.Nome != nome {
+			resto = append(resto, t)
+		}
+	}
+	if len(resto) == len(ts) {
+		return fmt.Errorf("token %q não encontrado", nome)
+	}
+	if err := server.SaveTokens(*arquivo, resto); err != nil {
+		return err
+	}
+	return a.feito(map[string]string{"nome": nome}, "token "+nome+" revogado (reinicie o serve)")
+}
@@ -0,0 +1,115 @@
+// versoes.go
+// Última versão vista de cada cofre, guardada fora dele (no diretório de
+// configuração do usuário), para perceber se alguém recolocou uma cópia
+// antiga do arquivo.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// ~/.config/senhas/versoes.json (ou o equivalente do sistema)
+func arquivoVersoes() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "senhas", "versoes.json"), nil
+}
+
+// caminho absoluto do cofre -> versão
+func lerVersoes() (map[string]uint64, error) {
+	m := map[string]uint64{}
+	path, err := arquivoVersoes()
+	if err != nil {
+		return m, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func chaveCofre(cofre string) string {
+	if abs, err := filepath.Abs(cofre); err == nil {
+		return abs
+	}
+	return cofre
+}
+
+// abre o cofre e exige ao menos a última versão vista neste computador
+func (a *app) abrirCofre(cofre string, abrir func() (*vault.Vault, error)) (*vault.Vault, error) {
+	versoes, err := lerVersoes()
+	if err != nil {
+		return nil, err
+	}
+	v, err := abrir()
+	if err != nil {
+		return nil, err
+	}
+	if min := versoes[chaveCofre(cofre)]; v.Version() < min {
+		v.Lock()
+		path, _ := arquivoVersoes()
+		return nil, fmt.Errorf("%w: versão %d, esperada ao menos %d\n(se você mesmo restaurou um backup, apague a linha do cofre em %s)",
+			vault.ErrRollback, v.Version(), min, path)
+	}
+	a.visto(cofre, v)
+	// em cofre compartilhado o ator é o membro
+	if a.membro == "" {
+		v.SetActor(atorLocal())
+	}
+	return v, nil
+}
+
+// registra o cofre para gravar a versão ao fim do comando
+func (a *app) visto(cofre string, v *vault.Vault) {
+	if a.abertos == nil {
+		a.abertos = map[string]*vault.Vault{}
+	}
+	a.abertos[chaveCofre(cofre)] = v
+}
+
+// grava a versão atual dos cofres usados no comando
+func (a *app) lembrarVersoes() error {
+	if len(a.abertos) == 0 {
+		return nil
+	}
+	path, err := arquivoVersoes()
+	if err != nil {
+		return nil
+	}
+	versoes, err := lerVersoes()
+	if err != nil {
+		return err
+	}
+	for k, v := range a.abertos {
+		versoes[k] = v.Version()
+	}
+	raw, err := json.MarshalIndent(versoes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
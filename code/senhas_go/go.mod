@@ -2,4 +2,11 @@ module github.com/cleutonsampaio/senhas
 
 go 1.23.2
 
-require golang.org/x/crypto v0.38.0
+require (
+	github.com/gorilla/mux v1.8.0
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.38.0
+	golang.org/x/term v0.32.0
+)
+
+require golang.org/x/sys v0.33.0 // indirect
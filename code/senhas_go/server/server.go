@@ -0,0 +1,354 @@
+// server.go
+// API HTTP/JSON do cofre para serviços internos: cada cliente se
+// identifica com um token (Authorization: Bearer) e só enxerga as entradas
+// do seu escopo. Toda leitura de credencial vai para o log de auditoria
+// antes da resposta.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+	"github.com/gorilla/mux"
+)
+
+// tamanho máximo do corpo de um PUT
+const maxCorpo = 1 << 20
+
+// AuditRecord é uma linha (JSON) do log de auditoria
+type AuditRecord struct {
+	Quando  time.Time `json:"quando"`
+	Cliente string    `json:"cliente,omitempty"` // nome do token; vazio se não autenticou
+	Op      string    `json:"op"`                // list, read, write, delete
+	Local   string    `json:"local,omitempty"`
+	Remoto  string    `json:"remoto"`
+	Status  int       `json:"status"`
+	Erro    string    `json:"erro,omitempty"` // erro interno; o cliente só recebe uma mensagem genérica
+}
+
+// Credential é a entrada como o servidor devolve e recebe (sem histórico
+// nem anexos)
+type Credential struct {
+	Local    string            `json:"local"`
+	Usuario  string            `json:"usuario"`
+	Senha    string            `json:"senha,omitempty"`
+	URLs     []string          `json:"urls,omitempty"`
+	Notas    string            `json:"notas,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Campos   map[string]string `json:"campos,omitempty"`
+	TOTP     string            `json:"totp,omitempty"`
+	Alterado time.Time         `json:"alterado"`
+	Revisao  int               `json:"revisao,omitempty"`
+}
+
+func credential(e vault.Entry) Credential {
+	return Credential{
+		Local: e.Local, Usuario: e.Usuario, Senha: e.Senha, URLs: e.URLs, Notas: e.Notas,
+		Tags: e.Tags, Campos: e.Campos, TOTP: e.TOTP, Alterado: e.Alterado, Revisao: e.Revisao,
+	}
+}
+
+// Server atende a API sobre um cofre aberto. O cofre é relido a cada
+// pedido, para ver o que outros processos gravaram.
+type Server struct {
+	mu     sync.Mutex
+	v      *vault.Vault // nil depois de Close
+	tokens []Token
+
+	muAudit sync.Mutex
+	audit   io.Writer
+
+	router *mux.Router
+}
+
+// New monta o servidor. As leituras e gravações são registradas em audit
+// (JSON, uma por linha).
+func New(v *vault.Vault, tokens []Token, audit io.Writer) (*Server, error) {
+	if err := checkTokens(tokens); err != nil {
+		return nil, err
+	}
+	s := &Server{v: v, tokens: tokens, audit: audit}
+	r := mux.NewRouter()
+	// locais com "/" chegam como %2F
+	r.UseEncodedPath()
+	r.HandleFunc("/v1/entries", s.autenticado(s.listar)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/entries/{local}", s.autenticado(s.ler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/entries/{local}", s.autenticado(s.gravar)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/entries/{local}", s.autenticado(s.apagar)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}).Methods(http.MethodGet)
+	s.router = r
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Close tranca o cofre; os pedidos seguintes recebem 503
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v != nil {
+		s.v.Lock()
+		s.v = nil
+	}
+}
+
+// handler já com o token do cliente e o cofre relido (sob s.mu)
+type handler func(w http.ResponseWriter, r *http.Request, t Token, v *vault.Vault)
+
+func (s *Server) autenticado(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segredo, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		t, achou := findToken(s.tokens, strings.TrimSpace(segredo))
+		if !ok || !achou {
+			s.registrar(r, Token{}, opDe(r), local(r), http.StatusUnauthorized)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="senhas"`)
+			writeError(w, http.StatusUnauthorized, "token ausente ou inválido")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.v == nil {
+			writeError(w, http.StatusServiceUnavailable, "cofre trancado")
+			return
+		}
+		if err := s.v.Reload(); err != nil {
+			// o erro do armazenamento (caminhos, backend) fica só no log
+			s.registrarErro(r, t, opDe(r), local(r), http.StatusServiceUnavailable, err)
+			writeError(w, http.StatusServiceUnavailable, "cofre indisponível")
+			return
+		}
+		// com a auditoria do cofre ligada, o cliente é o ator
+		s.v.SetActor(t.Nome)
+		h(w, r, t, s.v)
+	}
+}
+
+func (s *Server) listar(w http.ResponseWriter, r *http.Request, t Token, v *vault.Vault) {
+	q := vault.Query{Ordem: vault.SortLocal}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		q.Tags = []string{tag}
+	}
+	res, err := v.Search(q)
+	if err != nil {
+		s.falha(w, r, t, "list", "", err)
+		return
+	}
+	itens := []Credential{}
+	for _, e := range res.Entradas {
+		if t.allows(e) {
+			c := credential(e)
+			c.Senha, c.TOTP, c.Notas, c.Campos = "", "", "", nil
+			itens = append(itens, c)
+		}
+	}
+	s.registrar(r, t, "list", "", http.StatusOK)
+	writeJSON(w, http.StatusOK, itens)
+}
+
+func (s *Server) ler(w http.ResponseWriter, r *http.Request, t Token, v *vault.Vault) {
+	l := local(r)
+	e, err := entrada(v, l)
+	if err == nil && !t.allows(e) {
+		// fora do escopo é o mesmo que não existir
+		err = vault.ErrNotFound
+	}
+	if err == nil {
+		// só agora a leitura conta para a auditoria do cofre
+		e, err = v.GetEntry(l)
+	}
+	if err != nil {
+		s.falha(w, r, t, "read", l, err)
+		return
+	}
+	// sem registro no log, a senha não sai
+	if err := s.registrar(r, t, "read", l, http.StatusOK); err != nil {
+		writeError(w, http.StatusInternalServerError, "log de auditoria indisponível")
+		return
+	}
+	writeJSON(w, http.StatusOK, credential(e))
+}
+
+// cria ou substitui a entrada; o conteúdo novo também precisa estar no
+// escopo, para o cliente não perder de vista (nem criar) entradas alheias
+func (s *Server) gravar(w http.ResponseWriter, r *http.Request, t Token, v *vault.Vault) {
+	l := local(r)
+	if !t.Escrita {
+		s.registrar(r, t, "write", l, http.StatusForbidden)
+		writeError(w, http.StatusForbidden, "token só de leitura")
+		return
+	}
+	var c Credential
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCorpo))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		s.registrar(r, t, "write", l, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "corpo inválido: "+err.Error())
+		return
+	}
+	if c.Local == "" {
+		c.Local = l
+	}
+	antiga, err := entrada(v, l)
+	existe := err == nil
+	if errors.Is(err, vault.ErrNotFound) {
+		err = nil
+	}
+	if err != nil {
+		s.falha(w, r, t, "write", l, err)
+		return
+	}
+	nova := vault.Entry{
+		Local: c.Local, Usuario: c.Usuario, Senha: c.Senha, URLs: c.URLs, Notas: c.Notas,
+		Tags: c.Tags, Campos: c.Campos, TOTP: c.TOTP,
+	}
+	foraDoEscopo := (existe && !t.allows(antiga)) || !t.allows(nova)
+	if !foraDoEscopo && nova.Local != l {
+		// renomear (ou criar) sobre um nome alheio não pode revelar que ele
+		// existe: responde como qualquer nome fora do escopo
+		outra, err := entrada(v, nova.Local)
+		if err != nil && !errors.Is(err, vault.ErrNotFound) {
+			s.falha(w, r, t, "write", l, err)
+			return
+		}
+		foraDoEscopo = err == nil && !t.allows(outra)
+	}
+	if foraDoEscopo {
+		s.registrar(r, t, "write", l, http.StatusForbidden)
+		writeError(w, http.StatusForbidden, "entrada fora do escopo do token")
+		return
+	}
+	status := http.StatusOK
+	if existe {
+		err = v.UpdateEntry(l, nova)
+	} else {
+		err = v.AddEntry(nova)
+		status = http.StatusCreated
+	}
+	if err != nil {
+		s.falha(w, r, t, "write", l, err)
+		return
+	}
+	e, err := entrada(v, nova.Local)
+	if err != nil {
+		s.falha(w, r, t, "write", l, err)
+		return
+	}
+	s.registrar(r, t, "write", l, status)
+	c = credential(e)
+	c.Senha = ""
+	writeJSON(w, status, c)
+}
+
+func (s *Server) apagar(w http.ResponseWriter, r *http.Request, t Token, v *vault.Vault) {
+	l := local(r)
+	if !t.Escrita {
+		s.registrar(r, t, "delete", l, http.StatusForbidden)
+		writeError(w, http.StatusForbidden, "token só de leitura")
+		return
+	}
+	e, err := entrada(v, l)
+	if err == nil && !t.allows(e) {
+		err = vault.ErrNotFound
+	}
+	if err == nil {
+		err = v.DeleteLocal(l)
+	}
+	if err != nil {
+		s.falha(w, r, t, "delete", l, err)
+		return
+	}
+	s.registrar(r, t, "delete", l, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// entrada viva do local, para conferir o escopo sem contar como leitura
+// na auditoria do cofre
+func entrada(v *vault.Vault, l string) (vault.Entry, error) {
+	return v.LookupEntry(l)
+}
+
+// responde o erro do cofre com o status correspondente e registra. O
+// texto de erros internos (armazenamento, cofre corrompido) só vai para o
+// log; o cliente recebe uma mensagem genérica.
+func (s *Server) falha(w http.ResponseWriter, r *http.Request, t Token, op, l string, err error) {
+	status, msg := http.StatusInternalServerError, "erro interno do cofre"
+	switch {
+	case errors.Is(err, vault.ErrNotFound):
+		status, msg = http.StatusNotFound, "entrada não encontrada"
+	case errors.Is(err, vault.ErrDuplicate):
+		status, msg = http.StatusConflict, err.Error()
+	case errors.Is(err, vault.ErrLocked):
+		status, msg = http.StatusServiceUnavailable, "cofre trancado"
+	}
+	s.registrarErro(r, t, op, l, status, err)
+	writeError(w, status, msg)
+}
+
+// grava uma linha no log de auditoria
+func (s *Server) registrar(r *http.Request, t Token, op, l string, status int) error {
+	return s.registrarErro(r, t, op, l, status, nil)
+}
+
+// como registrar, guardando também o erro interno que levou ao status
+func (s *Server) registrarErro(r *http.Request, t Token, op, l string, status int, err error) error {
+	rec := AuditRecord{Quando: time.Now().UTC(), Cliente: t.Nome, Op: op, Local: l, Remoto: remoto(r), Status: status}
+	if err != nil {
+		rec.Erro = err.Error()
+	}
+	s.muAudit.Lock()
+	defer s.muAudit.Unlock()
+	return json.NewEncoder(s.audit).Encode(rec)
+}
+
+// local do caminho, já decodificado
+func local(r *http.Request) string {
+	l := mux.Vars(r)["local"]
+	if d, err := url.PathUnescape(l); err == nil {
+		return d
+	}
+	return l
+}
+
+func opDe(r *http.Request) string {
+	switch r.Method {
+	case http.MethodPut:
+		return "write"
+	case http.MethodDelete:
+		return "delete"
+	}
+	if local(r) == "" {
+		return "list"
+	}
+	return "read"
+}
+
+func remoto(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+	return r.RemoteAddr
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"erro": msg})
+}
@@ -0,0 +1,301 @@
+// server_test.go
+
+/*
+Testes do servidor HTTP: autenticação, escopo por local e por tag,
+leitura e escrita, e o log de auditoria
+*/
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/server"
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+var kdfRapido = vault.KDFParams{Algoritmo: vault.KDFPBKDF2, Iteracoes: 1000}
+
+type ambiente struct {
+	v      *vault.Vault
+	path   string
+	srv    *httptest.Server
+	audit  *bytes.Buffer
+	tokens map[string]string // nome -> segredo
+}
+
+func novoAmbiente(t *testing.T) *ambiente {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", vault.FileStorage{}, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []vault.Entry{
+		{Local: "db-pedidos", Usuario: "app", Senha: "pg1"},
+		{Local: "db-estoque", Usuario: "app", Senha: "pg2"},
+		{Local: "smtp", Usuario: "mailer", Senha: "m1", Tags: []string{"email"}},
+		{Local: "admin/root", Usuario: "root", Senha: "r00t"},
+	} {
+		if err := v.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	amb := &ambiente{v: v, path: path, audit: &bytes.Buffer{}, tokens: map[string]string{}}
+	var ts []server.Token
+	for _, tk := range []server.Token{
+		{Nome: "pedidos", Locais: []string{"db-pedidos"}},
+		{Nome: "ops", Locais: []string{"db-*"}, Tags: []string{"EMAIL"}, Escrita: true},
+		{Nome: "admin", Locais: []string{"*/*"}},
+	} {
+		segredo, novo, err := server.NewToken(tk.Nome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tk.Hash = novo.Hash
+		ts = append(ts, tk)
+		amb.tokens[tk.Nome] = segredo
+	}
+	s, err := server.New(v, ts, amb.audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amb.srv = httptest.NewServer(s)
+	t.Cleanup(func() {
+		amb.srv.Close()
+		s.Close()
+	})
+	return amb
+}
+
+// faz o pedido como o cliente e devolve o status e o corpo
+func (amb *ambiente) pedir(t *testing.T, cliente, metodo, caminho, corpo string) (int, string) {
+	t.Helper()
+	var body io.Reader
+	if corpo != "" {
+		body = strings.NewReader(corpo)
+	}
+	req, err := http.NewRequest(metodo, amb.srv.URL+caminho, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cliente != "" {
+		req.Header.Set("Authorization", "Bearer "+amb.tokens[cliente])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func (amb *ambiente) registros(t *testing.T) []server.AuditRecord {
+	t.Helper()
+	var rs []server.AuditRecord
+	dec := json.NewDecoder(bytes.NewReader(amb.audit.Bytes()))
+	for dec.More() {
+		var r server.AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestServidorLeitura(t *testing.T) {
+	amb := novoAmbiente(t)
+
+	if st, _ := amb.pedir(t, "", "GET", "/v1/entries/db-pedidos", ""); st != http.StatusUnauthorized {
+		t.Fatalf("sem token: %d", st)
+	}
+	amb.tokens["falso"] = "snh_nao-existe"
+	if st, _ := amb.pedir(t, "falso", "GET", "/v1/entries/db-pedidos", ""); st != http.StatusUnauthorized {
+		t.Fatalf("token falso: %d", st)
+	}
+
+	st, corpo := amb.pedir(t, "pedidos", "GET", "/v1/entries/db-pedidos", "")
+	var c server.Credential
+	if err := json.Unmarshal([]byte(corpo), &c); err != nil || st != http.StatusOK || c.Senha != "pg1" || c.Usuario != "app" {
+		t.Fatalf("leitura: %d %s", st, corpo)
+	}
+	// fora do escopo parece inexistente
+	if st, corpo := amb.pedir(t, "pedidos", "GET", "/v1/entries/db-estoque", ""); st != http.StatusNotFound || strings.Contains(corpo, "pg2") {
+		t.Fatalf("fora do escopo: %d %s", st, corpo)
+	}
+	if st, _ := amb.pedir(t, "admin", "GET", "/v1/entries/admin%2Froot", ""); st != http.StatusOK {
+		t.Fatalf("local com barra: %d", st)
+	}
+
+	st, corpo = amb.pedir(t, "ops", "GET", "/v1/entries", "")
+	var itens []server.Credential
+	if err := json.Unmarshal([]byte(corpo), &itens); err != nil || st != http.StatusOK {
+		t.Fatalf("list: %d %s", st, corpo)
+	}
+	if len(itens) != 3 || itens[0].Local != "db-estoque" || itens[2].Local != "smtp" || strings.Contains(corpo, "pg1") {
+		t.Fatalf("list do ops: %s", corpo)
+	}
+	if _, corpo := amb.pedir(t, "ops", "GET", "/v1/entries?tag=email", ""); !strings.Contains(corpo, "smtp") || strings.Contains(corpo, "db-") {
+		t.Fatalf("list por tag: %s", corpo)
+	}
+
+	rs := amb.registros(t)
+	if len(rs) != 7 {
+		t.Fatalf("registros: %+v", rs)
+	}
+	if r := rs[2]; r.Cliente != "pedidos" || r.Op != "read" || r.Local != "db-pedidos" || r.Status != http.StatusOK || r.Remoto == "" {
+		t.Fatalf("registro da leitura: %+v", r)
+	}
+	if r := rs[0]; r.Cliente != "" || r.Status != http.StatusUnauthorized {
+		t.Fatalf("registro sem token: %+v", r)
+	}
+	if r := rs[3]; r.Cliente != "pedidos" || r.Local != "db-estoque" || r.Status != http.StatusNotFound {
+		t.Fatalf("registro fora do escopo: %+v", r)
+	}
+}
+
+func TestServidorEscrita(t *testing.T) {
+	amb := novoAmbiente(t)
+
+	if st, _ := amb.pedir(t, "pedidos", "PUT", "/v1/entries/db-pedidos", `{"usuario":"app","senha":"x"}`); st != http.StatusForbidden {
+		t.Fatalf("token só de leitura gravou: %d", st)
+	}
+	if st, _ := amb.pedir(t, "ops", "PUT", "/v1/entries/db-pedidos", `{"usuario":"app","senha":"nova"}`); st != http.StatusOK {
+		t.Fatalf("update: %d", st)
+	}
+	if _, corpo := amb.pedir(t, "pedidos", "GET", "/v1/entries/db-pedidos", ""); !strings.Contains(corpo, `"senha":"nova"`) {
+		t.Fatalf("leitura após update: %s", corpo)
+	}
+	if st, corpo := amb.pedir(t, "ops", "PUT", "/v1/entries/smtp2", `{"usuario":"m","senha":"s","tags":["email"]}`); st != http.StatusCreated || strings.Contains(corpo, `"senha"`) {
+		t.Fatalf("criação: %d %s", st, corpo)
+	}
+
+	// não cria nem move entradas para fora do próprio escopo
+	if st, _ := amb.pedir(t, "ops", "PUT", "/v1/entries/ftp", `{"usuario":"x"}`); st != http.StatusForbidden {
+		t.Fatalf("criou fora do escopo: %d", st)
+	}
+	if st, _ := amb.pedir(t, "ops", "PUT", "/v1/entries/smtp", `{"usuario":"m"}`); st != http.StatusForbidden {
+		t.Fatalf("tirou a tag do escopo: %d", st)
+	}
+	if st, _ := amb.pedir(t, "ops", "PUT", "/v1/entries/db-x", `{"campo":1}`); st != http.StatusBadRequest {
+		t.Fatalf("corpo inválido: %d", st)
+	}
+
+	if st, _ := amb.pedir(t, "ops", "DELETE", "/v1/entries/admin%2Froot", ""); st != http.StatusNotFound {
+		t.Fatalf("apagou fora do escopo: %d", st)
+	}
+	if st, _ := amb.pedir(t, "ops", "DELETE", "/v1/entries/db-estoque", ""); st != http.StatusNoContent {
+		t.Fatalf("delete: %d", st)
+	}
+	if st, _ := amb.pedir(t, "ops", "GET", "/v1/entries/db-estoque", ""); st != http.StatusNotFound {
+		t.Fatalf("leitura após delete: %d", st)
+	}
+
+	ops := map[string]int{}
+	for _, r := range amb.registros(t) {
+		ops[r.Op]++
+	}
+	if ops["write"] != 6 || ops["delete"] != 2 || ops["read"] != 2 {
+		t.Fatalf("operações registradas: %v", ops)
+	}
+}
+
+// um nome fora do escopo responde igual, exista ou não
+func TestServidorEscritaNomeAlheio(t *testing.T) {
+	amb := novoAmbiente(t)
+	if err := amb.v.AddEntry(vault.Entry{Local: "ftp", Usuario: "f", Senha: "f1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ caminho, corpo string }{
+		{"/v1/entries/db-pedidos", `{"local":"ftp","usuario":"app","tags":["email"]}`},      // renomear sobre o nome
+		{"/v1/entries/db-novo", `{"local":"ftp","usuario":"app","tags":["email"]}`},         // criar com o nome
+		{"/v1/entries/db-pedidos", `{"local":"ftp-inexistente","usuario":"app","tags":[]}`}, // fora do escopo, não existe
+	} {
+		st, corpo := amb.pedir(t, "ops", "PUT", c.caminho, c.corpo)
+		if st != http.StatusForbidden || !strings.Contains(corpo, "fora do escopo") {
+			t.Fatalf("PUT %s %s: %d %s", c.caminho, c.corpo, st, corpo)
+		}
+	}
+	if _, p, err := amb.v.GetCredenciais("ftp"); err != nil || p != "f1" {
+		t.Fatalf("entrada alheia alterada: %q %v", p, err)
+	}
+	// dentro do escopo, o nome repetido ainda é conflito
+	if st, _ := amb.pedir(t, "ops", "PUT", "/v1/entries/db-pedidos", `{"local":"db-estoque","usuario":"app"}`); st != http.StatusConflict {
+		t.Fatalf("nome repetido no escopo: %d", st)
+	}
+}
+
+// o erro do armazenamento vai para o log, não para o cliente
+func TestServidorCofreIndisponivel(t *testing.T) {
+	amb := novoAmbiente(t)
+	if err := os.WriteFile(amb.path, []byte("{quebrado"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	st, corpo := amb.pedir(t, "pedidos", "GET", "/v1/entries/db-pedidos", "")
+	if st != http.StatusServiceUnavailable || strings.Contains(corpo, amb.path) || strings.Contains(corpo, "corrompido") {
+		t.Fatalf("cofre indisponível: %d %s", st, corpo)
+	}
+	rs := amb.registros(t)
+	if r := rs[len(rs)-1]; r.Status != http.StatusServiceUnavailable || r.Cliente != "pedidos" || r.Erro == "" {
+		t.Fatalf("registro do erro: %+v", r)
+	}
+}
+
+// com a auditoria do cofre ligada, o cliente aparece como ator e só as
+// leituras entregues contam
+func TestServidorAuditoriaDoCofre(t *testing.T) {
+	amb := novoAmbiente(t)
+	if err := amb.v.EnableAuditLog(); err != nil {
+		t.Fatal(err)
+	}
+	amb.pedir(t, "pedidos", "GET", "/v1/entries/db-estoque", "")
+	amb.pedir(t, "pedidos", "GET", "/v1/entries/db-pedidos", "")
+	amb.pedir(t, "ops", "PUT", "/v1/entries/db-estoque", `{"usuario":"app","senha":"novo"}`)
+	recs, err := amb.v.VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Op != vault.AuditRead || recs[0].Ator != "pedidos" || recs[1].Op != vault.AuditUpdate || recs[1].Ator != "ops" {
+		t.Fatalf("registros do cofre: %+v", recs)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	segredo, tk, err := server.NewToken("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(segredo, "snh_") || strings.Contains(tk.Hash, segredo) {
+		t.Fatalf("token %q, hash %q", segredo, tk.Hash)
+	}
+	arquivo := filepath.Join(t.TempDir(), "tokens.json")
+	if ts, err := server.LoadTokens(arquivo); err != nil || len(ts) != 0 {
+		t.Fatalf("arquivo inexistente: %v %v", ts, err)
+	}
+	if err := server.SaveTokens(arquivo, []server.Token{tk}); err == nil {
+		t.Fatal("token sem escopo aceito")
+	}
+	tk.Tags = []string{"ci"}
+	if err := server.SaveTokens(arquivo, []server.Token{tk, tk}); err == nil {
+		t.Fatal("token repetido aceito")
+	}
+	if err := server.SaveTokens(arquivo, []server.Token{tk}); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := server.LoadTokens(arquivo)
+	if err != nil || len(ts) != 1 || ts[0].Hash != tk.Hash {
+		t.Fatalf("LoadTokens: %+v %v", ts, err)
+	}
+	if _, err := server.New(nil, []server.Token{{Nome: "x", Hash: "abc", Tags: []string{"t"}}}, io.Discard); err == nil {
+		t.Fatal("hash inválido aceito")
+	}
+}
@@ -0,0 +1,152 @@
+// tokens.go
+// Tokens dos clientes do servidor: cada um tem um nome (que vai para o
+// log de auditoria), o escopo de entradas que enxerga e se pode gravar.
+// O arquivo de tokens guarda só o SHA-256 de cada token.
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// prefixo dos tokens gerados, para achá-los em configs e logs
+const prefixoToken = "snh_"
+
+// Token é um cliente do servidor e o que ele pode acessar. Uma entrada
+// está no escopo se o local casa com algum padrão de Locais (path.Match:
+// "db-*"; "*" vale para todas) ou se tem alguma das Tags.
+type Token struct {
+	Nome    string   `json:"nome"`
+	Hash    string   `json:"hash"` // SHA-256 do token, em hex
+	Locais  []string `json:"locais,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Escrita bool     `json:"escrita,omitempty"` // pode criar, alterar e apagar entradas
+}
+
+// NewToken gera um token aleatório para o cliente nome. O segredo é
+// mostrado uma única vez; o Token retornado guarda só o hash.
+func NewToken(nome string) (segredo string, t Token, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", Token{}, err
+	}
+	segredo = prefixoToken + base64.RawURLEncoding.EncodeToString(b)
+	return segredo, Token{Nome: nome, Hash: hashToken(segredo)}, nil
+}
+
+func hashToken(segredo string) string {
+	h := sha256.Sum256([]byte(segredo))
+	return hex.EncodeToString(h[:])
+}
+
+// confere o escopo e o hash
+func (t Token) validate() error {
+	if t.Nome == "" {
+		return errors.New("token sem nome")
+	}
+	if h, err := hex.DecodeString(t.Hash); err != nil || len(h) != sha256.Size {
+		return fmt.Errorf("token %s: hash inválido", t.Nome)
+	}
+	for _, p := range t.Locais {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("token %s: padrão inválido %q", t.Nome, p)
+		}
+	}
+	if len(t.Locais) == 0 && len(t.Tags) == 0 {
+		return fmt.Errorf("token %s: escopo vazio (use -local ou -tag)", t.Nome)
+	}
+	return nil
+}
+
+// a entrada está no escopo do token?
+func (t Token) allows(e vault.Entry) bool {
+	for _, p := range t.Locais {
+		if ok, _ := path.Match(p, e.Local); ok {
+			return true
+		}
+	}
+	for _, tag := range t.Tags {
+		for _, et := range e.Tags {
+			if strings.EqualFold(tag, et) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// token dono do segredo, comparando todos os hashes em tempo constante
+func findToken(ts []Token, segredo string) (Token, bool) {
+	h, _ := hex.DecodeString(hashToken(segredo))
+	var achado Token
+	ok := false
+	for _, t := range ts {
+		th, _ := hex.DecodeString(t.Hash)
+		if subtle.ConstantTimeCompare(h, th) == 1 {
+			achado, ok = t, true
+		}
+	}
+	return achado, ok
+}
+
+// LoadTokens lê o arquivo de tokens (um arquivo inexistente é uma lista vazia)
+func LoadTokens(arquivo string) ([]Token, error) {
+	raw, err := os.ReadFile(arquivo)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Token{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ts []Token
+	if err := json.Unmarshal(raw, &ts); err != nil {
+		return nil, fmt.Errorf("%s: %w", arquivo, err)
+	}
+	if err := checkTokens(ts); err != nil {
+		return nil, fmt.Errorf("%s: %w", arquivo, err)
+	}
+	return ts, nil
+}
+
+// SaveTokens grava o arquivo de tokens, legível só pelo dono
+func SaveTokens(arquivo string, ts []Token) error {
+	if err := checkTokens(ts); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := arquivo + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, arquivo)
+}
+
+// tokens válidos e com nomes únicos
+func checkTokens(ts []Token) error {
+	nomes := map[string]bool{}
+	for _, t := range ts {
+		if err := t.validate(); err != nil {
+			return err
+		}
+		if nomes[t.Nome] {
+			return fmt.Errorf("token %s repetido", t.Nome)
+		}
+		nomes[t.Nome] = true
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+// attachment.go
+// Anexos binários das entradas (chaves SSH, certificados, PDFs). Cada anexo
+// é cifrado com uma chave AES-256 própria e gravado no Storage como um blob
+// separado; a chave e os metadados ficam no payload cifrado da entrada, ou
+// seja, embrulhados pela chave do cofre. Rekey não precisa tocar nos blobs.
+//
+// Formato do blob (em base64, para caber em qualquer backend): 1 byte de
+// versão, 7 bytes de prefixo aleatório do nonce e segmentos AES-GCM de até
+// 64 KiB. O nonce de cada segmento é prefixo || contador || último, então
+// segmentos trocados de ordem, repetidos ou cortados no fim não abrem.
+
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxAttachmentSize é o tamanho máximo de um anexo, em bytes. AddAttachment
+// retorna ErrTooLarge acima dele.
+var MaxAttachmentSize int64 = 10 << 20
+
+const (
+	anexoVersao   = 1
+	anexoSegmento = 64 << 10
+)
+
+// Attachment descreve um anexo de uma entrada
+type Attachment struct {
+	ID      string    `json:"id"`
+	Nome    string    `json:"nome"`
+	Tipo    string    `json:"tipo,omitempty"` // MIME, pela extensão do nome
+	Tamanho int64     `json:"tamanho"`
+	SHA256  string    `json:"sha256"` // do conteúdo em claro, em hexa
+	Criado  time.Time `json:"criado"`
+	// chave AES-256 do blob (base64); Attachments e GetAttachment não a retornam
+	Chave string `json:"chave,omitempty"`
+}
+
+// caminho do blob do anexo no Storage, ao lado do cofre
+func (v *Vault) attachmentPath(id string) string {
+	return v.filePath + ".anexo-" + id
+}
+
+// AddAttachment cifra o conteúdo de r e o anexa à entrada de local com o
+// nome dado (ErrDuplicate se a entrada já tem um anexo com esse nome)
+func (v *Vault) AddAttachment(local, nome string, r io.Reader) (Attachment, error) {
+	if v.Locked() {
+		return Attachment{}, ErrLocked
+	}
+	nome = strings.TrimSpace(nome)
+	if nome == "" {
+		return Attachment{}, errors.New("nome do anexo vazio")
+	}
+	pos, e, err := v.liveEntry(local)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if _, ok := findAttachment(e, nome); ok {
+		return Attachment{}, duplicate(local + "/" + nome)
+	}
+
+	id := make([]byte, 16)
+	key := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Attachment{}, err
+	}
+	if _, err := rand.Read(key); err != nil {
+		return Attachment{}, err
+	}
+	a := Attachment{
+		ID:     hex.EncodeToString(id),
+		Nome:   nome,
+		Tipo:   mime.TypeByExtension(filepath.Ext(nome)),
+		Criado: time.Now().UTC(),
+	}
+	path := v.attachmentPath(a.ID)
+	selar := func(w io.Writer) error {
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		n, soma, err := sealAttachment(enc, key, a.ID, r)
+		if err != nil {
+			return err
+		}
+		a.Tamanho, a.SHA256 = n, hex.EncodeToString(soma)
+		return enc.Close()
+	}
+	pr, pw := io.Pipe()
+	feito := make(chan struct{})
+	go func() {
+		pw.CloseWithError(selar(pw))
+		close(feito)
+	}()
+	err = v.saveBlob(path, pr)
+	pr.CloseWithError(err) // destrava selar se a gravação parou antes do fim
+	<-feito
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	a.Chave = base64.StdEncoding.EncodeToString(key)
+	e.Anexos = append(e.Anexos, a)
+	if err := v.touchEntry(pos, e); err != nil {
+		v.removeBlobs([]Attachment{a})
+		return Attachment{}, err
+	}
+	a.Chave = ""
+	return a, nil
+}
+
+// Attachments lista os anexos da entrada de local
+func (v *Vault) Attachments(local string) ([]Attachment, error) {
+	_, e, err := v.liveEntry(local)
+	if err != nil {
+		return nil, err
+	}
+	res := []Attachment{}
+	for _, a := range e.Anexos {
+		a.Chave = ""
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// GetAttachment decifra o anexo nome da entrada de local e o escreve em w.
+// O conteúdo sai em fluxo; se o blob estiver adulterado ou truncado, o
+// erro (ErrCorrupted) vem depois de parte dele já ter sido escrita, e o
+// que foi escrito deve ser descartado.
+func (v *Vault) GetAttachment(local, nome string, w io.Writer) (Attachment, error) {
+	if v.Locked() {
+		return Attachment{}, ErrLocked
+	}
+	pos, e, err := v.liveEntry(local)
+	if err != nil {
+		return Attachment{}, err
+	}
+	a, ok := findAttachment(e, nome)
+	if !ok {
+		return Attachment{}, notFound(local + "/" + nome)
+	}
+	if err := v.audit(AuditRead, v.file.Entradas[pos].ID); err != nil {
+		return Attachment{}, err
+	}
+	key, err := base64.StdEncoding.DecodeString(a.Chave)
+	if err != nil || len(key) != 32 {
+		return Attachment{}, corrupted("chave do anexo", fmt.Errorf("%s: %v", nome, err))
+	}
+	rc, err := v.openBlob(v.attachmentPath(a.ID))
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer rc.Close()
+	n, soma, err := openAttachment(w, key, a.ID, base64.NewDecoder(base64.StdEncoding, rc))
+	if err != nil {
+		return Attachment{}, err
+	}
+	if n != a.Tamanho || hex.EncodeToString(soma) != a.SHA256 {
+		return Attachment{}, corrupted("anexo "+nome, errors.New("tamanho ou sha256 não confere"))
+	}
+	a.Chave = ""
+	return a, nil
+}
+
+// RemoveAttachment tira o anexo da entrada e apaga o blob, se o Storage
+// souber apagar (RemovableStorage). Sem a chave, que sai do cofre, um blob
+// que sobrar não pode mais ser decifrado.
+func (v *Vault) RemoveAttachment(local, nome string) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	pos, e, err := v.liveEntry(local)
+	if err != nil {
+		return err
+	}
+	a, ok := findAttachment(e, nome)
+	if !ok {
+		return notFound(local + "/" + nome)
+	}
+	resto := []Attachment{}
+	for _, x := range e.Anexos {
+		if x.ID != a.ID {
+			resto = append(resto, x)
+		}
+	}
+	e.Anexos = resto
+	if err := v.touchEntry(pos, e); err != nil {
+		return err
+	}
+	v.removeBlobs([]Attachment{a})
+	return nil
+}
+
+// posição e conteúdo da entrada viva de local
+func (v *Vault) liveEntry(local string) (int, Entry, error) {
+	pos, err := v.position(local)
+	if err != nil {
+		return -1, Entry{}, err
+	}
+	e, err := v.decryptEntry(v.file.Entradas[pos])
+	return pos, e, err
+}
+
+// regrava a entrada como nova revisão e persiste, com o registro de auditoria
+func (v *Vault) touchEntry(pos int, e Entry) error {
+	eid, err := entryID(v.file.Entradas[pos])
+	if err != nil {
+		return err
+	}
+	antes := v.file.Entradas[pos]
+	e.Revisao++
+	e.Alterado = time.Now().UTC()
+	if err := v.putEntry(pos, eid, e); err != nil {
+		return err
+	}
+	err = v.audit(AuditUpdate, v.file.Entradas[pos].ID)
+	if err == nil {
+		err = v.persist()
+	}
+	if err != nil {
+		v.file.Entradas[pos] = antes
+		return err
+	}
+	return nil
+}
+
+func findAttachment(e Entry, nome string) (Attachment, bool) {
+	for _, a := range e.Anexos {
+		if a.Nome == nome {
+			return a, true
+		}
+	}
+	return Attachment{}, false
+}
+
+// apaga os blobs (melhor esforço: o cofre já não os referencia)
+func (v *Vault) removeBlobs(as []Attachment) {
+	rs, ok := v.backend.(RemovableStorage)
+	if !ok {
+		return
+	}
+	for _, a := range as {
+		rs.Remove(v.attachmentPath(a.ID))
+	}
+}
+
+// copia de origem os blobs dos anexos de e que v ainda não tem (Sync).
+// Os blobs vão cifrados: a chave viaja no payload da entrada.
+func (v *Vault) copyBlobs(origem *Vault, e Entry, tem []Attachment) error {
+	ja := map[string]bool{}
+	for _, a := range tem {
+		ja[a.ID] = true
+	}
+	for _, a := range e.Anexos {
+		if ja[a.ID] {
+			continue
+		}
+		rc, err := origem.openBlob(origem.attachmentPath(a.ID))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // já faltava na origem; GetAttachment acusa
+		}
+		if err != nil {
+			return err
+		}
+		err = v.saveBlob(v.attachmentPath(a.ID), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grava o blob em fluxo, se o Storage souber, ou de uma vez com Save
+func (v *Vault) saveBlob(path string, r io.Reader) error {
+	if ss, ok := v.backend.(StreamStorage); ok {
+		return ss.SaveStream(path, r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return v.backend.Save(path, data)
+}
+
+// lê o blob em fluxo, se o Storage souber, ou de uma vez com Load
+func (v *Vault) openBlob(path string) (io.ReadCloser, error) {
+	if ss, ok := v.backend.(StreamStorage); ok {
+		return ss.LoadStream(path)
+	}
+	data, err := v.backend.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// nonce do segmento i: prefixo (7) || contador (4) || último (1)
+func segmentNonce(prefixo []byte, i uint32, ultimo bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefixo)
+	binary.BigEndian.PutUint32(nonce[7:], i)
+	if ultimo {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func attachmentAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cifra r em w em segmentos; retorna o tamanho e o SHA-256 do conteúdo
+func sealAttachment(w io.Writer, key []byte, id string, r io.Reader) (int64, []byte, error) {
+	aead, err := attachmentAEAD(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	cab := make([]byte, 8)
+	cab[0] = anexoVersao
+	if _, err := rand.Read(cab[1:]); err != nil {
+		return 0, nil, err
+	}
+	if _, err := w.Write(cab); err != nil {
+		return 0, nil, err
+	}
+	soma := sha256.New()
+	br := bufio.NewReaderSize(r, anexoSegmento+1)
+	buf := make([]byte, anexoSegmento)
+	var total int64
+	for i := uint32(0); ; i++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, nil, err
+		}
+		total += int64(n)
+		if total > MaxAttachmentSize {
+			return 0, nil, fmt.Errorf("%w: mais de %d bytes", ErrTooLarge, MaxAttachmentSize)
+		}
+		soma.Write(buf[:n])
+		ultimo := n < anexoSegmento
+		if !ultimo {
+			if _, perr := br.Peek(1); perr == io.EOF {
+				ultimo = true
+			}
+		}
+		if i == ^uint32(0) && !ultimo {
+			return 0, nil, ErrTooLarge
+		}
+		ct := aead.Seal(nil, segmentNonce(cab[1:], i, ultimo), buf[:n], []byte(id))
+		if _, err := w.Write(ct); err != nil {
+			return 0, nil, err
+		}
+		if ultimo {
+			return total, soma.Sum(nil), nil
+		}
+	}
+}
+
+// decifra o blob de r em w, conferindo cada segmento
+func openAttachment(w io.Writer, key []byte, id string, r io.Reader) (int64, []byte, error) {
+	aead, err := attachmentAEAD(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	br := bufio.NewReaderSize(r, anexoSegmento+aead.Overhead()+1)
+	cab := make([]byte, 8)
+	if _, err := io.ReadFull(br, cab); err != nil {
+		return 0, nil, corrupted("anexo", err)
+	}
+	if cab[0] != anexoVersao {
+		return 0, nil, corrupted("anexo", fmt.Errorf("versão %d", cab[0]))
+	}
+	soma := sha256.New()
+	buf := make([]byte, anexoSegmento+aead.Overhead())
+	var total int64
+	for i := uint32(0); ; i++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, nil, corrupted("anexo", err)
+		}
+		ultimo := n < len(buf)
+		if !ultimo {
+			if _, perr := br.Peek(1); perr == io.EOF {
+				ultimo = true
+			}
+		}
+		plain, err := aead.Open(buf[:0], segmentNonce(cab[1:], i, ultimo), buf[:n], []byte(id))
+		if err != nil {
+			return 0, nil, corrupted("anexo", fmt.Errorf("segmento %d: %w", i, err))
+		}
+		soma.Write(plain)
+		total += int64(len(plain))
+		if _, err := w.Write(plain); err != nil {
+			return 0, nil, err
+		}
+		if ultimo {
+			return total, soma.Sum(nil), nil
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// attachment_test.go
+
+/*
+Testes de anexos: ida e volta em vários tamanhos, blob separado do cofre,
+adulteração e truncamento, limite de tamanho, Rekey, remoção e Sync
+*/
+package vault_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// blobs de anexos gravados ao lado do cofre
+func blobs(t *testing.T, path string) []string {
+	t.Helper()
+	bs, err := filepath.Glob(path + ".anexo-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func cofreComAnexo(t *testing.T, conteudo []byte) (*vault.Vault, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("servidor", "root", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.AddAttachment("servidor", "id_ed25519", bytes.NewReader(conteudo)); err != nil {
+		t.Fatal(err)
+	}
+	return v, path
+}
+
+func TestAnexos(t *testing.T) {
+	for _, n := range []int{0, 1, 64 << 10, 64<<10 + 1, 200<<10 + 7} {
+		conteudo := make([]byte, n)
+		rand.Read(conteudo)
+		_, path := cofreComAnexo(t, conteudo)
+
+		v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		a, err := v2.GetAttachment("servidor", "id_ed25519", &buf)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(buf.Bytes(), conteudo) || a.Tamanho != int64(n) || a.Chave != "" {
+			t.Fatalf("%d bytes: voltaram %d, %+v", n, buf.Len(), a)
+		}
+		// o conteúdo não entra no JSON do cofre
+		if info, _ := os.Stat(path); n > 64<<10 && info.Size() > int64(n/4) {
+			t.Fatalf("%d bytes: cofre com %d bytes", n, info.Size())
+		}
+		if len(blobs(t, path)) != 1 {
+			t.Fatalf("blobs %v", blobs(t, path))
+		}
+	}
+}
+
+func TestAnexoOperacoes(t *testing.T) {
+	conteudo := []byte("-----BEGIN CERTIFICATE-----\nMIIB...\n-----END CERTIFICATE-----\n")
+	v, path := cofreComAnexo(t, conteudo)
+	if _, err := v.AddAttachment("servidor", "id_ed25519", strings.NewReader("x")); !errors.Is(err, vault.ErrDuplicate) {
+		t.Fatalf("nome repetido: %v", err)
+	}
+	if _, err := v.AddAttachment("nenhum", "a.pem", strings.NewReader("x")); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("entrada inexistente: %v", err)
+	}
+	a, err := v.AddAttachment("servidor", "cert.pem", bytes.NewReader(conteudo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err := v.Attachments("servidor")
+	if err != nil || len(as) != 2 || as[1].Nome != "cert.pem" || as[1].ID != a.ID || as[1].Chave != "" {
+		t.Fatalf("Attachments: %+v %v", as, err)
+	}
+
+	// limite de tamanho: nada fica gravado
+	antes := vault.MaxAttachmentSize
+	vault.MaxAttachmentSize = 100 << 10
+	_, err = v.AddAttachment("servidor", "grande.pdf", bytes.NewReader(make([]byte, 100<<10+1)))
+	vault.MaxAttachmentSize = antes
+	if !errors.Is(err, vault.ErrTooLarge) {
+		t.Fatalf("anexo grande: %v", err)
+	}
+	if len(blobs(t, path)) != 2 {
+		t.Fatalf("sobrou blob do anexo recusado: %v", blobs(t, path))
+	}
+
+	// Rekey troca a chave do cofre sem tocar nos blobs
+	if err := v.Rekey("Nova", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Nova", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := v2.GetAttachment("servidor", "cert.pem", &buf); err != nil || buf.String() != string(conteudo) {
+		t.Fatalf("anexo após Rekey: %q %v", buf.String(), err)
+	}
+
+	// o anexo acompanha alterações e renomeação da entrada
+	e, _ := v2.GetEntry("servidor")
+	e.Local, e.Anexos = "srv", nil
+	if err := v2.UpdateEntry("servidor", e); err != nil {
+		t.Fatal(err)
+	}
+	if as, _ := v2.Attachments("srv"); len(as) != 2 {
+		t.Fatalf("anexos após renomear: %+v", as)
+	}
+
+	if err := v2.RemoveAttachment("srv", "cert.pem"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.RemoveAttachment("srv", "cert.pem"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("remover de novo: %v", err)
+	}
+	if len(blobs(t, path)) != 1 {
+		t.Fatalf("blob removido ficou: %v", blobs(t, path))
+	}
+	if err := v2.DeleteLocal("srv"); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs(t, path)) != 0 {
+		t.Fatalf("blob de entrada apagada ficou: %v", blobs(t, path))
+	}
+}
+
+func TestAnexoAdulterado(t *testing.T) {
+	conteudo := make([]byte, 150<<10)
+	rand.Read(conteudo)
+	casos := map[string]func(bin []byte) []byte{
+		"byte trocado":      func(bin []byte) []byte { bin[len(bin)/2] ^= 1; return bin },
+		"último segmento":   func(bin []byte) []byte { return bin[:8+2*(64<<10+16)] },
+		"segmento repetido": func(bin []byte) []byte { return append(append([]byte{}, bin[:8+64<<10+16]...), bin[8:]...) },
+		"vazio":             func(bin []byte) []byte { return nil },
+	}
+	for nome, mexer := range casos {
+		t.Run(nome, func(t *testing.T) {
+			v, path := cofreComAnexo(t, conteudo)
+			blob := blobs(t, path)[0]
+			raw, _ := os.ReadFile(blob)
+			bin, err := base64.StdEncoding.DecodeString(string(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			os.WriteFile(blob, []byte(base64.StdEncoding.EncodeToString(mexer(bin))), 0600)
+			if _, err := v.GetAttachment("servidor", "id_ed25519", &bytes.Buffer{}); !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("esperado ErrCorrupted, achou %v", err)
+			}
+		})
+	}
+
+	// blob de outro anexo no lugar: a chave não abre
+	v, path := cofreComAnexo(t, conteudo)
+	_, outro := cofreComAnexo(t, conteudo)
+	raw, _ := os.ReadFile(blobs(t, outro)[0])
+	os.WriteFile(blobs(t, path)[0], raw, 0600)
+	if _, err := v.GetAttachment("servidor", "id_ed25519", &bytes.Buffer{}); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("blob trocado: %v", err)
+	}
+}
+
+func TestSyncAnexos(t *testing.T) {
+	a, b, _, pb := doisCofres(t)
+	if err := a.AddLocal("servidor", "root", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AddAttachment("servidor", "id_ed25519", strings.NewReader("chave")); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+	if len(blobs(t, pb)) != 1 {
+		t.Fatalf("blob não copiado: %v", blobs(t, pb))
+	}
+	var buf bytes.Buffer
+	if _, err := b.GetAttachment("servidor", "id_ed25519", &buf); err != nil || buf.String() != "chave" {
+		t.Fatalf("anexo no outro cofre: %q %v", buf.String(), err)
+	}
+
+	// a remoção de um lado apaga o blob do outro também
+	if err := a.DeleteLocal("servidor"); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+	if len(blobs(t, pb)) != 0 {
+		t.Fatalf("blob órfão no outro cofre: %v", blobs(t, pb))
+	}
+}
+
+func TestSyncAnexoRemovido(t *testing.T) {
+	a, b, _, pb := doisCofres(t)
+	a.AddLocal("servidor", "root", "x")
+	a.AddAttachment("servidor", "id_ed25519", strings.NewReader("chave"))
+	a.AddAttachment("servidor", "cert.pem", strings.NewReader("certificado"))
+	sincronizar(t, a, b, nil)
+	if err := a.RemoveAttachment("servidor", "id_ed25519"); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+	if len(blobs(t, pb)) != 1 {
+		t.Fatalf("blobs no outro cofre: %v", blobs(t, pb))
+	}
+	var buf bytes.Buffer
+	if _, err := b.GetAttachment("servidor", "cert.pem", &buf); err != nil || buf.String() != "certificado" {
+		t.Fatalf("anexo que ficou: %q %v", buf.String(), err)
+	}
+}
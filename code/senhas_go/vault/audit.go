@@ -0,0 +1,495 @@
+// audit.go
+// Log de auditoria do cofre: cada leitura de credencial, exportação e
+// alteração vira um registro, acrescentado pelo Storage ao lado do cofre
+// (path + ".auditoria"), uma linha JSON por registro. Os registros são
+// encadeados por HMAC-SHA256, com uma chave que só quem abre o cofre tem.
+// O topo da cadeia vai, a cada registro, para path + ".auditoria.topo"
+// (com HMAC) e, a cada gravação do cofre, para o cabeçalho (coberto pelo
+// MAC), então remover, alterar ou reordenar registros, inclusive os do
+// fim, é detectado por VerifyAuditLog.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// AuditOp é a operação de um registro de auditoria
+type AuditOp string
+
+const (
+	AuditRead   AuditOp = "leitura"    // GetEntry, GetCredenciais, GetPassword, History, GetAttachment
+	AuditExport AuditOp = "exportacao" // ExportClear, Export, ExportEncrypted
+	AuditAdd    AuditOp = "inclusao"
+	AuditUpdate AuditOp = "alteracao"
+	AuditDelete AuditOp = "remocao"
+	AuditImport AuditOp = "importacao" // Import, ImportEncrypted
+	AuditSync   AuditOp = "sincronia"  // Sync, nos dois cofres
+	AuditScan   AuditOp = "analise"    // Audit (senhas fracas, comuns e reutilizadas)
+)
+
+// AuditRecord é um registro do log de auditoria. A entrada é identificada
+// pelo ID, não pelo local, para o log não revelar os nomes (ver LocalByID).
+type AuditRecord struct {
+	Seq      uint64    `json:"seq"` // começa em 1, sem buracos
+	Quando   time.Time `json:"quando"`
+	Op       AuditOp   `json:"op"`
+	Entrada  string    `json:"entrada,omitempty"` // ID da entrada; vazio na exportação
+	Ator     string    `json:"ator,omitempty"`    // ver SetActor
+	Anterior string    `json:"anterior"`          // HMAC do registro anterior
+	Hash     string    `json:"hash"`              // HMAC do registro
+}
+
+// topo da cadeia de auditoria gravado no cabeçalho; a presença liga o log.
+// A chave da cadeia é aleatória e vai cifrada com a chave do cofre,
+// recifrada a cada troca de chave, para a cadeia continuar valendo depois
+// de Rekey.
+type auditHead struct {
+	Seq   uint64 `json:"seq"`
+	Hash  string `json:"hash,omitempty"`
+	IV    string `json:"iv"`
+	Chave string `json:"chave"`
+}
+
+// topo da cadeia gravado ao lado do log a cada registro. O HMAC impede
+// montar um topo para um log cortado a partir dos registros que sobraram;
+// só repor uma cópia antiga do arquivo passa, e o cabeçalho pega isso
+// até a última gravação do cofre.
+type auditTop struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+// quantas vezes o registro é tentado de novo se outro processo gravou
+// no log ao mesmo tempo (Storage sem AppendStorage)
+const auditRetries = 5
+
+// EnableAuditLog liga o log de auditoria. A marca fica no cabeçalho, coberta
+// pelo MAC: quem não tem a chave não desliga o log sem ser notado, e
+// todo processo que abrir o cofre passa a registrar.
+func (v *Vault) EnableAuditLog() error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if v.AuditLogEnabled() {
+		return nil
+	}
+	chave := make([]byte, 32)
+	if _, err := rand.Read(chave); err != nil {
+		return err
+	}
+	defer wipe(chave)
+	topo := &auditHead{}
+	if err := topo.wrap(v.file.Cabecalho.ID, v.key, chave); err != nil {
+		return err
+	}
+	v.file.Cabecalho.Auditoria = topo
+	if err := v.persist(); err != nil {
+		v.file.Cabecalho.Auditoria = nil
+		return err
+	}
+	return nil
+}
+
+// AuditLogEnabled indica se o cofre registra as operações
+func (v *Vault) AuditLogEnabled() bool {
+	return v.file.Cabecalho.Auditoria != nil
+}
+
+// SetActor define quem aparece como ator nos registros seguintes (o
+// usuário do sistema, o cliente de um servidor). Em cofre compartilhado
+// o padrão é o membro que abriu.
+func (v *Vault) SetActor(ator string) {
+	v.ator = ator
+}
+
+func (v *Vault) actor() string {
+	if v.ator != "" {
+		return v.ator
+	}
+	return v.membro
+}
+
+func (v *Vault) auditPath() string {
+	return v.filePath + ".auditoria"
+}
+
+func (v *Vault) auditTopPath() string {
+	return v.auditPath() + ".topo"
+}
+
+// VerifyAuditLog lê o log inteiro e confere a sequência, o encadeamento dos
+// HMACs, o topo gravado ao lado do log e o gravado no cabeçalho. Retorna
+// os registros, do mais antigo para o mais novo, ou ErrCorrupted se algum
+// foi alterado, removido ou reordenado. Quem repõe uma cópia antiga do log
+// junto com a do topo só é pego pelo cabeçalho, que acompanha as gravações
+// do cofre, não cada leitura.
+func (v *Vault) VerifyAuditLog() ([]AuditRecord, error) {
+	if !v.AuditLogEnabled() {
+		return nil, errors.New("auditoria desligada neste cofre (ver EnableAuditLog)")
+	}
+	k, err := v.auditKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(k)
+	raw, _, err := v.loadAudit()
+	if err != nil {
+		return nil, err
+	}
+	recs := []AuditRecord{}
+	anterior := auditGenesis(k, v.file.Cabecalho.ID)
+	for i, linha := range bytes.Split(raw, []byte("\n")) {
+		if len(bytes.TrimSpace(linha)) == 0 {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(linha, &r); err != nil {
+			return nil, corrupted("auditoria", fmt.Errorf("linha %d: %w", i+1, err))
+		}
+		switch {
+		case r.Seq != uint64(len(recs))+1:
+			return nil, corrupted("auditoria", fmt.Errorf("registro %d fora de sequência (esperado %d)", r.Seq, len(recs)+1))
+		case r.Anterior != anterior:
+			return nil, corrupted("auditoria", fmt.Errorf("registro %d não encadeia no anterior", r.Seq))
+		case !hmac.Equal([]byte(r.Hash), []byte(r.digest(k))):
+			return nil, corrupted("auditoria", fmt.Errorf("registro %d alterado", r.Seq))
+		}
+		anterior = r.Hash
+		recs = append(recs, r)
+	}
+	topo, err := v.loadAuditTop(k)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAuditTop(recs, topo.Seq, topo.Hash, "o topo do log"); err != nil {
+		return nil, err
+	}
+	cab := v.file.Cabecalho.Auditoria
+	if err := checkAuditTop(recs, cab.Seq, cab.Hash, "o cabeçalho"); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// o topo (seq, hash) tem de ser um dos registros do log. Pode ficar atrás
+// do último se a gravação do topo falhou depois da do registro.
+func checkAuditTop(recs []AuditRecord, seq uint64, hash, onde string) error {
+	if seq > uint64(len(recs)) {
+		return corrupted("auditoria", fmt.Errorf("%s registra %d registros, o log tem %d", onde, seq, len(recs)))
+	}
+	if seq > 0 && recs[seq-1].Hash != hash {
+		return corrupted("auditoria", fmt.Errorf("registro %d não confere com %s", seq, onde))
+	}
+	return nil
+}
+
+// LocalByID retorna o local da entrada com o ID dado, viva ou apagada
+// (para mostrar os registros de auditoria). Não é registrada.
+func (v *Vault) LocalByID(id string) (string, error) {
+	for _, e := range v.file.Entradas {
+		if e.ID != id {
+			continue
+		}
+		plain, err := v.decryptEntry(e)
+		if err != nil {
+			return "", err
+		}
+		return plain.Local, nil
+	}
+	return "", notFound(id)
+}
+
+// ------------------ internos ------------------
+
+// registra a operação sobre a entrada de ID eid, se o log estiver ligado.
+// Quem lê credenciais só as entrega se o registro foi gravado. Quem altera
+// o cofre registra antes de persist, que leva o topo com o registro para o
+// cabeçalho: se o log falha, nada é gravado; se a gravação do cofre falha
+// depois, sobra no log o registro de uma alteração que não aconteceu. O
+// log pode ter registros a mais, nunca a menos.
+func (v *Vault) audit(op AuditOp, eid string) error {
+	if !v.AuditLogEnabled() {
+		return nil
+	}
+	k, err := v.auditKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(k)
+	id := v.file.Cabecalho.ID
+	next := func(ultima []byte) ([]byte, []byte, error) {
+		r := AuditRecord{Seq: 1, Quando: time.Now().UTC(), Op: op, Entrada: eid, Ator: v.actor(), Anterior: auditGenesis(k, id)}
+		if len(ultima) > 0 {
+			var u AuditRecord
+			if err := json.Unmarshal(ultima, &u); err != nil {
+				return nil, nil, corrupted("auditoria", fmt.Errorf("último registro: %w", err))
+			}
+			r.Seq, r.Anterior = u.Seq+1, u.Hash
+		}
+		if err := v.checkAuditEnd(k, r.Seq-1, r.Anterior); err != nil {
+			return nil, nil, err
+		}
+		r.Hash = r.digest(k)
+		linha, err := json.Marshal(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		topo, err := json.Marshal(auditTop{Seq: r.Seq, Hash: r.Hash, MAC: auditTopMAC(k, id, r.Seq, r.Hash)})
+		return linha, topo, err
+	}
+	if as, ok := v.backend.(AppendStorage); ok {
+		err = as.AppendLine(v.auditPath(), v.auditTopPath(), next)
+	} else {
+		err = v.rewriteAudit(next)
+	}
+	if err != nil {
+		return fmt.Errorf("auditoria: %w", err)
+	}
+	return nil
+}
+
+// antes de acrescentar: o log termina no registro seq (0 se vazio) de
+// hash dado, e nem o topo gravado ao lado nem o do cabeçalho podem estar
+// adiante dele, senão o registro novo esconderia um corte do fim
+func (v *Vault) checkAuditEnd(k []byte, seq uint64, hash string) error {
+	t, err := v.loadAuditTop(k)
+	if err != nil {
+		return err
+	}
+	cab := v.file.Cabecalho.Auditoria
+	for _, topo := range []struct {
+		seq        uint64
+		hash, onde string
+	}{{t.Seq, t.Hash, "o topo do log"}, {cab.Seq, cab.Hash, "o cabeçalho"}} {
+		if topo.seq > seq {
+			return corrupted("auditoria", fmt.Errorf("%s registra %d registros, o log tem %d", topo.onde, topo.seq, seq))
+		}
+		if topo.seq == seq && seq > 0 && topo.hash != hash {
+			return corrupted("auditoria", fmt.Errorf("registro %d não confere com %s", seq, topo.onde))
+		}
+	}
+	return nil
+}
+
+// sem AppendStorage: relê o log, regrava com o registro novo (com
+// VersionedStorage, repete se outro processo gravou junto) e grava o topo
+func (v *Vault) rewriteAudit(next func(ultima []byte) ([]byte, []byte, error)) error {
+	for tentativa := 0; ; tentativa++ {
+		raw, version, err := v.loadAudit()
+		if err != nil {
+			return err
+		}
+		linha, topo, err := next(lastRawLine(raw))
+		if err != nil {
+			return err
+		}
+		novo := append(append(raw[:len(raw):len(raw)], linha...), '\n')
+		err = v.saveAudit(novo, version)
+		if errors.Is(err, ErrConflict) && tentativa < auditRetries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return v.backend.Save(v.auditTopPath(), topo)
+	}
+}
+
+// audit da entrada viva do local
+func (v *Vault) auditLocal(op AuditOp, local string) error {
+	if !v.AuditLogEnabled() {
+		return nil
+	}
+	pos, err := v.position(local)
+	if err != nil {
+		return err
+	}
+	return v.audit(op, v.file.Entradas[pos].ID)
+}
+
+// topo atual do log, para o cabeçalho (chamado por persist). O topo não
+// anda para trás: um log cortado desde a última gravação é recusado.
+func (v *Vault) refreshAuditHead() error {
+	k, err := v.auditKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(k)
+	t, err := v.loadAuditTop(k)
+	if err != nil {
+		return err
+	}
+	topo := *v.file.Cabecalho.Auditoria
+	if t.Seq < topo.Seq {
+		return corrupted("auditoria", fmt.Errorf("o topo do log voltou de %d para %d registros", topo.Seq, t.Seq))
+	}
+	topo.Seq, topo.Hash = t.Seq, t.Hash
+	v.file.Cabecalho.Auditoria = &topo
+	return nil
+}
+
+// topo gravado ao lado do log, com o HMAC conferido; sem arquivo, o log
+// está vazio
+func (v *Vault) loadAuditTop(k []byte) (auditTop, error) {
+	raw, err := v.backend.Load(v.auditTopPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return auditTop{}, nil
+	}
+	if err != nil {
+		return auditTop{}, err
+	}
+	var t auditTop
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return auditTop{}, corrupted("topo da auditoria", err)
+	}
+	if !hmac.Equal([]byte(t.MAC), []byte(auditTopMAC(k, v.file.Cabecalho.ID, t.Seq, t.Hash))) {
+		return auditTop{}, corrupted("auditoria", errors.New("topo do log alterado"))
+	}
+	return t, nil
+}
+
+// cifra a chave da cadeia com a chave do cofre
+func (a *auditHead) wrap(id string, kenc, chave []byte) error {
+	iv, ct, err := gcmSeal(kenc, chave, auditAAD(id))
+	if err != nil {
+		return err
+	}
+	a.IV, a.Chave = base64.StdEncoding.EncodeToString(iv), base64.StdEncoding.EncodeToString(ct)
+	return nil
+}
+
+func (a *auditHead) unwrap(id string, kenc []byte) ([]byte, error) {
+	iv, err := base64.StdEncoding.DecodeString(a.IV)
+	if err != nil {
+		return nil, corrupted("auditoria", err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(a.Chave)
+	if err != nil {
+		return nil, corrupted("auditoria", err)
+	}
+	chave, err := gcmOpen(kenc, iv, ct, auditAAD(id))
+	if err != nil {
+		return nil, corrupted("auditoria", fmt.Errorf("chave do log: %w", err))
+	}
+	return chave, nil
+}
+
+func auditAAD(id string) []byte {
+	return []byte(id + "\x00auditoria")
+}
+
+// chave do HMAC da cadeia, derivada da chave do log; quem chama zera
+func (v *Vault) auditKey() ([]byte, error) {
+	if v.Locked() {
+		return nil, ErrLocked
+	}
+	chave, err := v.file.Cabecalho.Auditoria.unwrap(v.file.Cabecalho.ID, v.key)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(chave)
+	k := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, chave, nil, []byte("auditoria")), k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// refaz o envelope da chave do log para a chave de cifra nova
+func (v *Vault) rewrapAudit(cab *header, kenc []byte) error {
+	if !v.AuditLogEnabled() {
+		cab.Auditoria = nil
+		return nil
+	}
+	chave, err := v.file.Cabecalho.Auditoria.unwrap(v.file.Cabecalho.ID, v.key)
+	if err != nil {
+		return err
+	}
+	defer wipe(chave)
+	topo := *v.file.Cabecalho.Auditoria
+	if err := topo.wrap(cab.ID, kenc, chave); err != nil {
+		return err
+	}
+	cab.Auditoria = &topo
+	return nil
+}
+
+// log inexistente é log vazio
+func (v *Vault) loadAudit() ([]byte, string, error) {
+	var (
+		raw     []byte
+		version string
+		err     error
+	)
+	if vs, ok := v.backend.(VersionedStorage); ok {
+		raw, version, err = vs.LoadVersion(v.auditPath())
+	} else {
+		raw, err = v.backend.Load(v.auditPath())
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	}
+	return raw, version, err
+}
+
+func (v *Vault) saveAudit(data []byte, version string) error {
+	if vs, ok := v.backend.(VersionedStorage); ok {
+		_, err := vs.SaveVersion(v.auditPath(), data, version)
+		return err
+	}
+	return v.backend.Save(v.auditPath(), data)
+}
+
+// última linha não vazia do log (nil se vazio)
+func lastRawLine(raw []byte) []byte {
+	raw = bytes.TrimRight(raw, "\n\r\t ")
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw[bytes.LastIndexByte(raw, '\n')+1:]
+}
+
+// HMAC que inicia a cadeia: amarra o log ao cofre
+func auditGenesis(k []byte, id string) string {
+	h := hmac.New(sha256.New, k)
+	macCampo(h, "SENHAS_AUDIT_V2")
+	macCampo(h, id)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HMAC do topo gravado ao lado do log
+func auditTopMAC(k []byte, id string, seq uint64, hash string) string {
+	h := hmac.New(sha256.New, k)
+	macCampo(h, "SENHAS_AUDIT_TOPO")
+	macCampo(h, id)
+	macNumero(h, seq)
+	macCampo(h, hash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HMAC do registro sobre todos os campos, menos o próprio hash
+func (r AuditRecord) digest(k []byte) string {
+	h := hmac.New(sha256.New, k)
+	macNumero(h, r.Seq)
+	macCampo(h, r.Quando.UTC().Format(time.RFC3339Nano))
+	macCampo(h, string(r.Op))
+	macCampo(h, r.Entrada)
+	macCampo(h, r.Ator)
+	macCampo(h, r.Anterior)
+	return hex.EncodeToString(h.Sum(nil))
+}
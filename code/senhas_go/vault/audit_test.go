@@ -0,0 +1,343 @@
+// audit_test.go
+
+/*
+Testes do log de auditoria: operações registradas com ator e ID da
+entrada, e detecção de registros alterados, removidos ou reordenados
+*/
+package vault_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func cofreAuditado(t *testing.T) (*vault.Vault, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// antes de ligar nada é registrado
+	if err := v.AddLocal("banco", "ana", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.EnableAuditLog(); err != nil {
+		t.Fatal(err)
+	}
+	v.SetActor("ana@notebook")
+	return v, path
+}
+
+func TestAuditoria(t *testing.T) {
+	v, path := cofreAuditado(t)
+	if _, _, err := v.GetCredenciais("banco"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("email", "ana", "s2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.UpdateLocal("email", "ana", "s3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.ExportClear(); err != nil {
+		t.Fatal(err)
+	}
+	v.SetActor("servidor")
+	if err := v.DeleteLocal("banco"); err != nil {
+		t.Fatal(err)
+	}
+
+	// outro processo abre o cofre e continua a cadeia
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v2.AuditLogEnabled() {
+		t.Fatal("auditoria desligada ao reabrir")
+	}
+	if _, err := v2.GetEntry("email"); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := v2.VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, r := range recs {
+		local := ""
+		if r.Entrada != "" {
+			if local, err = v2.LocalByID(r.Entrada); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ops = append(ops, string(r.Op)+":"+local+":"+r.Ator)
+	}
+	quer := "leitura:banco:ana@notebook inclusao:email:ana@notebook alteracao:email:ana@notebook exportacao::ana@notebook remocao:banco:servidor leitura:email:"
+	if strings.Join(ops, " ") != quer {
+		t.Fatalf("registros:\n%s\nesperado:\n%s", strings.Join(ops, " "), quer)
+	}
+
+	// o log guarda IDs, não os nomes
+	raw, _ := os.ReadFile(path + ".auditoria")
+	if bytes.Contains(raw, []byte("banco")) || bytes.Contains(raw, []byte("s1")) {
+		t.Fatalf("log revela a entrada:\n%s", raw)
+	}
+
+	// Rekey mantém o log ligado e o topo
+	if err := v2.Rekey("Nova", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	v3, err := vault.OpenVault(path, "Nova", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs, err := v3.VerifyAuditLog(); err != nil || len(recs) != 6 {
+		t.Fatalf("após Rekey: %d registros, %v", len(recs), err)
+	}
+}
+
+func TestAuditoriaAdulterada(t *testing.T) {
+	casos := map[string]func(linhas []string) []string{
+		"registro alterado": func(l []string) []string {
+			l[1] = strings.Replace(l[1], "ana@notebook", "outro", 1)
+			return l
+		},
+		"registro removido": func(l []string) []string { return append(l[:1], l[2:]...) },
+		"registros trocados": func(l []string) []string {
+			l[1], l[2] = l[2], l[1]
+			return l
+		},
+		// o topo gravado no cabeçalho pega o corte do fim
+		"fim cortado": func(l []string) []string { return l[:2] },
+		"log apagado": func(l []string) []string { return nil },
+	}
+	for nome, mexer := range casos {
+		t.Run(nome, func(t *testing.T) {
+			v, path := cofreAuditado(t)
+			for i := 0; i < 3; i++ {
+				if _, err := v.GetEntry("banco"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// grava o cofre: o topo (3 registros) vai para o cabeçalho
+			if err := v.AddLocal("email", "ana", "x"); err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := os.ReadFile(path + ".auditoria")
+			linhas := strings.Split(strings.TrimSpace(string(raw)), "\n")
+			novo := strings.Join(mexer(linhas), "\n")
+			if novo != "" {
+				novo += "\n"
+			}
+			os.WriteFile(path+".auditoria", []byte(novo), 0o600)
+			if _, err := v.VerifyAuditLog(); !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("esperado ErrCorrupted, achou %v", err)
+			}
+		})
+	}
+
+	// desligar a auditoria editando o cabeçalho quebra o MAC
+	_, path := cofreAuditado(t)
+	raw, _ := os.ReadFile(path)
+	var vf map[string]any
+	if err := json.Unmarshal(raw, &vf); err != nil {
+		t.Fatal(err)
+	}
+	delete(vf["cabecalho"].(map[string]any), "auditoria")
+	raw, _ = json.Marshal(vf)
+	os.WriteFile(path, raw, 0o600)
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("cabeçalho sem auditoria: %v", err)
+	}
+}
+
+// hash do registro sem chave, como faria quem só tem acesso ao arquivo
+func hashSemChave(r vault.AuditRecord) string {
+	h := sha256.New()
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], r.Seq)
+	h.Write(n[:])
+	for _, s := range []string{r.Quando.UTC().Format(time.RFC3339Nano), string(r.Op), r.Entrada, r.Ator, r.Anterior} {
+		binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestAuditoriaForjada(t *testing.T) {
+	v, path := cofreAuditado(t)
+	if err := v.AddLocal("email", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	// leituras depois da última gravação ainda não estão no cabeçalho
+	for i := 0; i < 2; i++ {
+		if _, err := v.GetEntry("banco"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, _ := os.ReadFile(path + ".auditoria")
+	linhas := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	var r vault.AuditRecord
+	if err := json.Unmarshal([]byte(linhas[len(linhas)-1]), &r); err != nil {
+		t.Fatal(err)
+	}
+	// troca o ator e refaz o hash: sem a chave do cofre não confere
+	r.Ator = "outro"
+	r.Hash = hashSemChave(r)
+	b, _ := json.Marshal(r)
+	linhas[len(linhas)-1] = string(b)
+	os.WriteFile(path+".auditoria", []byte(strings.Join(linhas, "\n")+"\n"), 0o600)
+	if _, err := v.VerifyAuditLog(); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("registro forjado: esperado ErrCorrupted, achou %v", err)
+	}
+}
+
+// leituras feitas depois da última gravação do cofre também estão presas
+// ao topo gravado ao lado do log
+func TestAuditoriaFimCortadoSemGravacao(t *testing.T) {
+	v, path := cofreAuditado(t)
+	if err := v.AddLocal("email", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := v.GetEntry("banco"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, _ := os.ReadFile(path + ".auditoria")
+	linhas := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	os.WriteFile(path+".auditoria", []byte(strings.Join(linhas[:len(linhas)-1], "\n")+"\n"), 0o600)
+	if _, err := v.VerifyAuditLog(); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("fim cortado: esperado ErrCorrupted, achou %v", err)
+	}
+	// um registro novo não esconde o corte
+	if _, err := v.GetEntry("banco"); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("leitura com log cortado: esperado ErrCorrupted, achou %v", err)
+	}
+
+	// um topo montado com o último registro que sobrou não tem o HMAC certo
+	var r vault.AuditRecord
+	if err := json.Unmarshal([]byte(linhas[len(linhas)-2]), &r); err != nil {
+		t.Fatal(err)
+	}
+	topo, _ := json.Marshal(map[string]any{"seq": r.Seq, "hash": r.Hash, "mac": hashSemChave(r)})
+	os.WriteFile(path+".auditoria.topo", topo, 0o600)
+	if _, err := v.VerifyAuditLog(); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("topo forjado: esperado ErrCorrupted, achou %v", err)
+	}
+	// nem a gravação seguinte do cofre aceita o log cortado
+	if err := v.AddLocal("outro", "ana", "y"); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("gravação com log cortado: esperado ErrCorrupted, achou %v", err)
+	}
+}
+
+// o log só cresce: as leituras não regravam nem fazem backup dele
+func TestAuditoriaAcrescenta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	st := vault.FileStorage{Backups: 3}
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", st, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("banco", "ana", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.EnableAuditLog(); err != nil {
+		t.Fatal(err)
+	}
+	var antes []byte
+	for i := 0; i < 3; i++ {
+		antes, _ = os.ReadFile(path + ".auditoria")
+		if _, err := v.GetEntry("banco"); err != nil {
+			t.Fatal(err)
+		}
+		depois, _ := os.ReadFile(path + ".auditoria")
+		if !bytes.HasPrefix(depois, antes) || bytes.Count(depois, []byte("\n")) != i+1 {
+			t.Fatalf("leitura %d não só acrescentou ao log:\n%s", i, depois)
+		}
+	}
+	if _, err := os.Stat(path + ".auditoria.1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("backup do log: %v", err)
+	}
+	if recs, err := v.VerifyAuditLog(); err != nil || len(recs) != 3 {
+		t.Fatalf("%d registros, %v", len(recs), err)
+	}
+}
+
+// Sync, Import e Audit decifram todas as senhas: também são registrados
+func TestAuditoriaCobertura(t *testing.T) {
+	v, _ := cofreAuditado(t)
+	if _, err := v.Audit(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := v.ExportEncrypted(&buf, "exporta"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.ImportEncrypted(&buf, "exporta"); err != nil {
+		t.Fatal(err)
+	}
+	outro, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "outro.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Sync(outro, nil); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := v.VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, r := range recs {
+		ops = append(ops, string(r.Op))
+	}
+	if quer := "analise exportacao importacao sincronia"; strings.Join(ops, " ") != quer {
+		t.Fatalf("registros: %s, esperado %s", strings.Join(ops, " "), quer)
+	}
+}
+
+// a alteração só é gravada junto com o registro dela
+func TestAuditoriaFalhaNaoGrava(t *testing.T) {
+	v, path := cofreAuditado(t)
+	if err := v.AddLocal("email", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	// o log vira um diretório: nenhum registro pode ser gravado
+	os.Remove(path + ".auditoria")
+	if err := os.Mkdir(path+".auditoria", 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("novo", "ana", "y"); err == nil {
+		t.Fatal("AddLocal gravou sem registro")
+	}
+	if err := v.UpdateLocal("email", "ana", "z"); err == nil {
+		t.Fatal("UpdateLocal gravou sem registro")
+	}
+	if err := v.DeleteLocal("banco"); err == nil {
+		t.Fatal("DeleteLocal gravou sem registro")
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := locais(t, v2); strings.Join(got, " ") != "banco email" {
+		t.Fatalf("locais gravados: %v", got)
+	}
+	if got := locais(t, v); strings.Join(got, " ") != "banco email" {
+		t.Fatalf("locais em memória: %v", got)
+	}
+}
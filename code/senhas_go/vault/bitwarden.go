@@ -0,0 +1,177 @@
+// bitwarden.go
+// Exportação/importação no JSON não cifrado do Bitwarden.
+
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type bwFile struct {
+	Encrypted bool       `json:"encrypted"`
+	Folders   []bwFolder `json:"folders"`
+	Items     []bwItem   `json:"items"`
+}
+
+type bwFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bwItem struct {
+	ID           string     `json:"id"`
+	FolderID     *string    `json:"folderId"`
+	Type         int        `json:"type"` // 1 login, 2 nota segura, 3 cartão, 4 identidade
+	Name         string     `json:"name"`
+	Notes        *string    `json:"notes"`
+	Favorite     bool       `json:"favorite"`
+	Fields       []bwField  `json:"fields,omitempty"`
+	Login        *bwLogin   `json:"login,omitempty"`
+	CreationDate *time.Time `json:"creationDate,omitempty"`
+	RevisionDate *time.Time `json:"revisionDate,omitempty"`
+}
+
+type bwField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"` // 0 texto, 1 oculto
+}
+
+type bwLogin struct {
+	URIs     []bwURI `json:"uris,omitempty"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	TOTP     *string `json:"totp"`
+}
+
+type bwURI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// ponteiro para string, nil se vazia (o Bitwarden usa null)
+func strPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func strVal(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// UUID v4 aleatório, no formato do Bitwarden
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// a primeira tag vira pasta (o Bitwarden não tem tags)
+func exportBitwarden(w io.Writer, es []Entry) error {
+	f := bwFile{Folders: []bwFolder{}, Items: []bwItem{}}
+	pastas := map[string]string{}
+	for _, e := range es {
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		item := bwItem{
+			ID:    id,
+			Type:  1,
+			Name:  e.Local,
+			Notes: strPtr(e.Notas),
+			Login: &bwLogin{
+				Username: strPtr(e.Usuario),
+				Password: strPtr(e.Senha),
+				TOTP:     strPtr(e.TOTP),
+			},
+		}
+		if !e.Criado.IsZero() {
+			item.CreationDate, item.RevisionDate = &e.Criado, &e.Alterado
+		}
+		for _, u := range e.URLs {
+			item.Login.URIs = append(item.Login.URIs, bwURI{URI: u})
+		}
+		nomes := make([]string, 0, len(e.Campos))
+		for k := range e.Campos {
+			nomes = append(nomes, k)
+		}
+		sort.Strings(nomes)
+		for _, k := range nomes {
+			item.Fields = append(item.Fields, bwField{Name: k, Value: e.Campos[k]})
+		}
+		if len(e.Tags) > 0 {
+			pid, ok := pastas[e.Tags[0]]
+			if !ok {
+				if pid, err = newUUID(); err != nil {
+					return err
+				}
+				pastas[e.Tags[0]] = pid
+				f.Folders = append(f.Folders, bwFolder{ID: pid, Name: e.Tags[0]})
+			}
+			item.FolderID = &pid
+		}
+		f.Items = append(f.Items, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+func importBitwarden(r io.Reader) ([]Entry, error) {
+	var f bwFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.Encrypted {
+		return nil, errors.New("exportação cifrada do Bitwarden não é suportada; exporte em JSON não cifrado")
+	}
+	pastas := map[string]string{}
+	for _, p := range f.Folders {
+		pastas[p.ID] = p.Name
+	}
+	es := []Entry{}
+	for _, it := range f.Items {
+		e := Entry{Local: it.Name, Notas: strVal(it.Notes)}
+		if it.Login != nil {
+			e.Usuario = strVal(it.Login.Username)
+			e.Senha = strVal(it.Login.Password)
+			e.TOTP = strVal(it.Login.TOTP)
+			for _, u := range it.Login.URIs {
+				e.URLs = append(e.URLs, u.URI)
+			}
+		}
+		for _, c := range it.Fields {
+			if e.Campos == nil {
+				e.Campos = map[string]string{}
+			}
+			e.Campos[c.Name] = c.Value
+		}
+		if it.FolderID != nil && pastas[*it.FolderID] != "" {
+			e.Tags = []string{pastas[*it.FolderID]}
+		}
+		if it.CreationDate != nil {
+			e.Criado = it.CreationDate.UTC()
+		}
+		if it.RevisionDate != nil {
+			e.Alterado = it.RevisionDate.UTC()
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
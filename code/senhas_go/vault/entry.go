@@ -0,0 +1,340 @@
+// entry.go
+// Esquema das entradas decifradas e versionamento do payload cifrado.
+
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Entry é o conteúdo decifrado de uma entrada do cofre
+type Entry struct {
+	Local    string            `json:"local"`
+	Usuario  string            `json:"usuario"`
+	Senha    string            `json:"senha"`
+	URLs     []string          `json:"urls,omitempty"`
+	Notas    string            `json:"notas,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Campos   map[string]string `json:"campos,omitempty"` // campos livres
+	TOTP     string            `json:"totp,omitempty"`   // URI otpauth:// ou segredo base32
+	Criado   time.Time         `json:"criado"`
+	Alterado time.Time         `json:"alterado"`
+	Revisao  int               `json:"revisao,omitempty"`  // incrementada a cada alteração
+	Removido bool              `json:"removido,omitempty"` // lápide: entrada apagada (para Sync)
+	// quando o usuário/senha atual passou a valer (ver PasswordDate)
+	SenhaAlterada time.Time         `json:"senha_alterada"`
+	Historico     []PasswordVersion `json:"historico,omitempty"` // senhas anteriores
+	Anexos        []Attachment      `json:"anexos,omitempty"`    // ver AddAttachment
+}
+
+// versão atual do payload cifrado. Payloads sem "v" são da versão 1:
+// só local, usuario e senha, sem datas.
+const payloadVersion = 2
+
+type payload struct {
+	Versao int `json:"v"`
+	Entry
+}
+
+// serializa a entrada no formato de payload atual
+func encodePayload(e Entry) ([]byte, error) {
+	return json.Marshal(payload{Versao: payloadVersion, Entry: e})
+}
+
+// interpreta o JSON decifrado de uma entrada, de qualquer versão
+func parsePayload(plain []byte) (Entry, error) {
+	var p payload
+	if err := json.Unmarshal(plain, &p); err != nil {
+		return Entry{}, corrupted("payload", err)
+	}
+	if p.Versao > payloadVersion {
+		return Entry{}, fmt.Errorf("versão de payload não suportada: %d", p.Versao)
+	}
+	return p.Entry, nil
+}
+
+// valida os campos obrigatórios e o segredo totp
+func (e Entry) validate() error {
+	if e.Local == "" {
+		return errors.New("local vazio")
+	}
+	if e.TOTP != "" {
+		if _, err := ParseTOTP(e.TOTP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cifra a entrada com o ID dado e calcula o índice de busca
+func (v *Vault) sealPayload(eid []byte, e Entry) (entry, error) {
+	if v.Locked() {
+		return entry{}, ErrLocked
+	}
+	plain, err := encodePayload(e)
+	if err != nil {
+		return entry{}, err
+	}
+	ne, err := sealEntry(v.key, eid, plain)
+	if err != nil {
+		return entry{}, err
+	}
+	ne.Indice = indexTag(v.idxKey, e.Local)
+	return ne, nil
+}
+
+// ID binário de uma entrada cifrada
+func entryID(e entry) ([]byte, error) {
+	id, err := base64.StdEncoding.DecodeString(e.ID)
+	if err != nil {
+		return nil, corrupted("id da entrada", err)
+	}
+	return id, nil
+}
+
+// grava e na posição pos (ou acrescenta, se pos < 0) com o ID dado, sem persistir
+func (v *Vault) putEntry(pos int, eid []byte, e Entry) error {
+	ne, err := v.sealPayload(eid, e)
+	if err != nil {
+		return err
+	}
+	if pos < 0 {
+		if v.index != nil {
+			v.index[ne.Indice] = append(v.index[ne.Indice], len(v.file.Entradas))
+		}
+		v.file.Entradas = append(v.file.Entradas, ne)
+		return nil
+	}
+	v.file.Entradas[pos] = ne
+	v.index = nil
+	return nil
+}
+
+// acrescenta a entrada sem persistir (ErrDuplicate se o local já existe).
+// Se houver uma lápide para o local, reaproveita o lugar e o ID dela para o
+// Sync enxergar a mesma entrada. O Sync passa em id o ID que a entrada tem
+// no outro cofre, para ela ser a mesma nos dois.
+func (v *Vault) addEntry(e Entry, id string) error {
+	e.Removido = false
+	e.Revisao = 1
+	pos, antiga, ok, err := v.find(e.Local)
+	if err != nil {
+		return err
+	}
+	if ok && !antiga.Removido {
+		return duplicate(e.Local)
+	}
+	var eid []byte
+	switch {
+	case id != "" && !v.hasID(id):
+		if eid, err = base64.StdEncoding.DecodeString(id); err != nil {
+			return corrupted("id da entrada", err)
+		}
+		if ok {
+			e.Revisao = antiga.Revisao + 1
+		}
+	case ok:
+		if eid, err = entryID(v.file.Entradas[pos]); err != nil {
+			return err
+		}
+		e.Revisao = antiga.Revisao + 1
+	default:
+		eid = make([]byte, 16)
+		if _, err := rand.Read(eid); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		pos = -1
+	}
+	return v.putEntry(pos, eid, e)
+}
+
+// alguma entrada (viva ou lápide) já tem o ID?
+func (v *Vault) hasID(id string) bool {
+	for _, e := range v.file.Entradas {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// troca a entrada da posição pos por uma lápide, sem persistir
+func (v *Vault) tombstone(pos int) error {
+	antiga, err := v.decryptEntry(v.file.Entradas[pos])
+	if err != nil {
+		return err
+	}
+	eid, err := entryID(v.file.Entradas[pos])
+	if err != nil {
+		return err
+	}
+	return v.putEntry(pos, eid, Entry{
+		Local:    antiga.Local,
+		Criado:   antiga.Criado,
+		Alterado: time.Now().UTC(),
+		Revisao:  antiga.Revisao + 1,
+		Removido: true,
+	})
+}
+
+// AddEntry cria uma nova entrada. Datas zeradas recebem o horário atual.
+// Retorna ErrDuplicate se já existe uma entrada viva para o local.
+func (v *Vault) AddEntry(e Entry) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	agora := time.Now().UTC()
+	if e.Criado.IsZero() {
+		e.Criado = agora
+	}
+	if e.Alterado.IsZero() {
+		e.Alterado = agora
+	}
+	antes := v.saveState()
+	err := v.addEntry(e, "")
+	if err == nil {
+		err = v.auditLocal(AuditAdd, e.Local)
+	}
+	if err == nil {
+		err = v.persist()
+	}
+	if err != nil {
+		v.restoreState(antes)
+		return err
+	}
+	return nil
+}
+
+// posição da (primeira) entrada viva do local, ou ErrNotFound
+func (v *Vault) position(local string) (int, error) {
+	pos, err := v.lookup(local)
+	if err != nil {
+		return -1, err
+	}
+	if len(pos) == 0 {
+		return -1, notFound(local)
+	}
+	return pos[0], nil
+}
+
+// GetEntry retorna a entrada completa de um local (uma leitura, para a
+// auditoria)
+func (v *Vault) GetEntry(local string) (Entry, error) {
+	pos, e, err := v.getEntry(local)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := v.audit(AuditRead, v.file.Entradas[pos].ID); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// LookupEntry acha a entrada do local exato sem contar como leitura na
+// auditoria: para conferir escopo ou existência antes de ler. Vem sem
+// senha, TOTP e senhas do histórico; para os segredos use GetEntry.
+func (v *Vault) LookupEntry(local string) (Entry, error) {
+	_, e, err := v.getEntry(local)
+	if err != nil {
+		return Entry{}, err
+	}
+	return e.withoutSecrets(), nil
+}
+
+// GetEntry sem registro de auditoria, para uso interno
+func (v *Vault) getEntry(local string) (int, Entry, error) {
+	pos, err := v.position(local)
+	if err != nil {
+		return -1, Entry{}, err
+	}
+	e, err := v.decryptEntry(v.file.Entradas[pos])
+	return pos, e, err
+}
+
+// UpdateEntry substitui o conteúdo da entrada de local por e, mantendo o ID,
+// a data de criação, os anexos e o histórico; se o usuário ou a senha mudaram, os
+// anteriores vão para o histórico (ver History). Se e.Local for diferente de local, renomeia:
+// a entrada continua a mesma (ID, histórico e anexos), só a tag do índice muda.
+func (v *Vault) UpdateEntry(local string, e Entry) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	pos, err := v.position(local)
+	if err != nil {
+		return err
+	}
+	antiga, err := v.decryptEntry(v.file.Entradas[pos])
+	if err != nil {
+		return err
+	}
+	if e.Local != local {
+		if existe, err := v.lookup(e.Local); err != nil {
+			return err
+		} else if len(existe) > 0 {
+			return duplicate(e.Local)
+		}
+	}
+	e.Criado = antiga.Criado
+	e.Alterado = time.Now().UTC()
+	e.keepHistory(antiga, e.Alterado)
+	e.Anexos = antiga.Anexos
+
+	eid, err := entryID(v.file.Entradas[pos])
+	if err != nil {
+		return err
+	}
+	e.Removido = false
+	e.Revisao = antiga.Revisao + 1
+	antes := v.saveState()
+	if err := v.putEntry(pos, eid, e); err != nil {
+		return err
+	}
+	err = v.audit(AuditUpdate, v.file.Entradas[pos].ID)
+	if err == nil {
+		err = v.persist()
+	}
+	if err != nil {
+		v.restoreState(antes)
+		return err
+	}
+	return nil
+}
+
+// cópia da entrada sem os segredos (senha, totp e senhas do histórico),
+// para consultas que não contam como leitura na auditoria
+func (e Entry) withoutSecrets() Entry {
+	e.Senha, e.TOTP = "", ""
+	if len(e.Historico) > 0 {
+		h := make([]PasswordVersion, len(e.Historico))
+		for i, p := range e.Historico {
+			p.Senha = ""
+			h[i] = p
+		}
+		e.Historico = h
+	}
+	return e
+}
+
+// entradas vivas decifradas, ordenadas por local
+func (v *Vault) entries() ([]Entry, error) {
+	res := []Entry{}
+	for _, e := range v.file.Entradas {
+		plain, err := v.decryptEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		if !plain.Removido {
+			res = append(res, plain)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Local < res[j].Local })
+	return res, nil
+}
@@ -0,0 +1,230 @@
+// entry_test.go
+
+/*
+Testes do esquema rico de entradas (Entry) e compatibilidade com payload v1
+*/
+package vault_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// copia um cofre de testdata para um diretório temporário
+func copiarFixture(t *testing.T, nome string) string {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", nome))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), nome)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEntryCompleta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vault.Entry{
+		Local:   "github",
+		Usuario: "cleuton",
+		Senha:   "s3nh4",
+		URLs:    []string{"https://github.com/login"},
+		Notas:   "conta pessoal",
+		Tags:    []string{"dev", "pessoal"},
+		Campos:  map[string]string{"pin": "1234"},
+		TOTP:    "JBSWY3DPEHPK3PXP",
+	}
+	if err := v.AddEntry(e); err != nil {
+		t.Fatal(err)
+	}
+
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v2.GetEntry("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Criado.IsZero() || got.Alterado.IsZero() {
+		t.Fatal("datas não preenchidas")
+	}
+	if got.Revisao != 1 {
+		t.Fatalf("revisão inicial esperada 1, achou %d", got.Revisao)
+	}
+	e.Criado, e.Alterado, e.Revisao = got.Criado, got.Alterado, got.Revisao
+	if !reflect.DeepEqual(got, e) {
+		t.Fatalf("entrada diferente:\n%+v\n%+v", got, e)
+	}
+
+	// métodos antigos continuam funcionando sobre a entrada rica
+	if u, p, err := v2.GetCredenciais("github"); err != nil || u != "cleuton" || p != "s3nh4" {
+		t.Fatal("GetCredenciais falhou em entrada rica")
+	}
+	if err := v2.UpdateLocal("github", "cleuton", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	got2, _ := v2.GetEntry("github")
+	if got2.Senha != "nova" || got2.Notas != "conta pessoal" || len(got2.Tags) != 2 {
+		t.Fatalf("UpdateLocal perdeu campos: %+v", got2)
+	}
+	if !got2.Criado.Equal(got.Criado) {
+		t.Fatal("UpdateLocal alterou a data de criação")
+	}
+}
+
+func TestUpdateEntryRenomeia(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("antigo", "user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.UpdateLocal("antigo", "user", "pass2"); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := v.GetEntry("antigo")
+	e.Local = "novo"
+	e.Notas = "renomeado"
+	if err := v.UpdateEntry("antigo", e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.GetEntry("antigo"); err == nil {
+		t.Fatal("nome antigo ainda encontrado")
+	}
+	got, err := v.GetEntry("novo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Notas != "renomeado" || got.Alterado.Before(got.Criado) {
+		t.Fatalf("renomeação incorreta: %+v", got)
+	}
+	// a entrada é a mesma: o histórico vem junto
+	if h, err := v.History("novo"); err != nil || len(h) != 1 || h[0].Senha != "pass" {
+		t.Fatalf("histórico depois de renomear: %+v %v", h, err)
+	}
+	if err := v.UpdateEntry("inexistente", e); err == nil {
+		t.Fatal("UpdateEntry aceitou local inexistente")
+	}
+}
+
+// se a gravação falha, a alteração em memória é desfeita e pode ser repetida
+func TestEntryGravacaoFalha(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v1, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddLocal("siteB", "userB", "passB"); err != nil {
+		t.Fatal(err)
+	}
+
+	// v1 está desatualizado: toda gravação dá conflito
+	for i := 0; i < 2; i++ {
+		if err := v1.AddLocal("siteC", "userC", "passC"); !errors.Is(err, vault.ErrConflict) {
+			t.Fatalf("AddLocal %d: esperado ErrConflict, achou %v", i, err)
+		}
+	}
+	if err := v1.UpdateLocal("siteA", "userA", "outra"); !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("UpdateLocal: esperado ErrConflict, achou %v", err)
+	}
+	if err := v1.UpdateEntry("siteA", vault.Entry{Local: "siteD", Senha: "x"}); !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("UpdateEntry renomeando: esperado ErrConflict, achou %v", err)
+	}
+	if locais, _ := v1.ListLocais(); !reflect.DeepEqual(locais, []string{"siteA"}) {
+		t.Fatalf("alterações não gravadas ficaram em memória: %v", locais)
+	}
+	if _, p, err := v1.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("senha não gravada ficou em memória: %q %v", p, err)
+	}
+
+	// depois de recarregar, a mesma operação funciona
+	if err := v1.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	if locais, _ := v1.ListLocais(); !reflect.DeepEqual(locais, []string{"siteA", "siteB", "siteC"}) {
+		t.Fatalf("locais após Reload: %v", locais)
+	}
+}
+
+func TestPayloadV1(t *testing.T) {
+	// cofre gravado pela primeira versão da biblioteca (pbkdf2, payload v1)
+	path := copiarFixture(t, "cofre_v1.json")
+	v, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := v.GetEntry("siteA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Usuario != "userA" || e.Senha != "passA" || !e.Criado.IsZero() {
+		t.Fatalf("payload v1 interpretado errado: %+v", e)
+	}
+	// atualizar grava no formato novo sem perder nada
+	e.Tags = []string{"migrado"}
+	if err := v.UpdateEntry("siteA", e); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e2, err := v2.GetEntry("siteA"); err != nil || e2.Tags[0] != "migrado" {
+		t.Fatalf("atualização de entrada v1 falhou: %+v %v", e2, err)
+	}
+	if _, p, err := v2.GetCredenciais("siteB"); err != nil || p != "passB" {
+		t.Fatal("entrada v1 intocada não abriu")
+	}
+}
+
+func TestLookupEntry(t *testing.T) {
+	v, _ := cofreAuditado(t)
+	if err := v.AddEntry(vault.Entry{Local: "github", Usuario: "ana", Senha: "s3nh4", TOTP: "JBSWY3DPEHPK3PXP", Tags: []string{"dev"}}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := v.LookupEntry("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Usuario != "ana" || !reflect.DeepEqual(e.Tags, []string{"dev"}) || e.Senha != "" || e.TOTP != "" {
+		t.Fatalf("entrada: %+v", e)
+	}
+	// só o local exato, não o que contém o texto
+	for _, l := range []string{"git", "GitHub", "github.com"} {
+		if _, err := v.LookupEntry(l); !errors.Is(err, vault.ErrNotFound) {
+			t.Fatalf("%q: esperado ErrNotFound, achou %v", l, err)
+		}
+	}
+	// não conta como leitura: só a inclusão está no log
+	recs, err := v.VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Op != vault.AuditAdd {
+		t.Fatalf("registros: %+v", recs)
+	}
+}
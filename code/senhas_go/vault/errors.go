@@ -0,0 +1,60 @@
+// errors.go
+// Erros do pacote, para comparar com errors.Is.
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrWrongPassword: a senha-mestre não confere com o cabeçalho do cofre
+	ErrWrongPassword = errors.New("senha-mestre incorreta")
+
+	// ErrNotFound: não há entrada viva para o local
+	ErrNotFound = errors.New("local não encontrado")
+
+	// ErrDuplicate: já existe uma entrada viva para o local
+	ErrDuplicate = errors.New("local já existe")
+
+	// ErrCorrupted: o conteúdo gravado é inválido (JSON, base64, IV, tag
+	// de autenticação...). A senha estava certa, mas os dados não fecham.
+	ErrCorrupted = errors.New("cofre corrompido")
+
+	// ErrRollback: o cofre gravado é mais antigo que a versão já vista
+	// (alguém recolocou uma cópia anterior do arquivo)
+	ErrRollback = errors.New("cofre voltou a uma versão anterior")
+
+	// ErrInvalidRecoveryKey: o código digitado não é uma chave de
+	// recuperação (erro de digitação: a soma de verificação não confere)
+	ErrInvalidRecoveryKey = errors.New("chave de recuperação inválida")
+
+	// ErrInvalidShare: uma parte da chave de dados tem erro de digitação,
+	// é de outra divisão ou de uma chave que o cofre não usa mais, ou
+	// faltam partes para reconstruir a chave
+	ErrInvalidShare = errors.New("parte de chave inválida")
+
+	// ErrConflict indica que o cofre mudou no armazenamento desde que foi
+	// aberto (outro processo gravou antes). Reabra o cofre e repita a operação.
+	ErrConflict = errors.New("cofre alterado por outro processo")
+
+	// ErrTooLarge indica anexo maior que MaxAttachmentSize
+	ErrTooLarge = errors.New("anexo grande demais")
+
+	// ErrLocked indica que o cofre foi trancado com Lock e as chaves já não existem
+	ErrLocked = errors.New("cofre trancado")
+)
+
+func notFound(local string) error {
+	return fmt.Errorf("%w: %q", ErrNotFound, local)
+}
+
+func duplicate(local string) error {
+	return fmt.Errorf("%w: %q", ErrDuplicate, local)
+}
+
+// marca err como corrupção, dizendo em que parte do cofre
+func corrupted(onde string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrCorrupted, onde, err)
+}
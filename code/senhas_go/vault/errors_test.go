@@ -0,0 +1,246 @@
+// errors_test.go
+
+/*
+Testes dos erros tipados e da leitura de cofres corrompidos
+*/
+package vault_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// storage em memória: um único cofre, sem tocar o disco. Com falha
+// definida, Save não grava e retorna o erro.
+type memStorage struct {
+	dados []byte
+	falha error
+}
+
+func (m *memStorage) Save(path string, data []byte) error {
+	if m.falha != nil {
+		return m.falha
+	}
+	m.dados = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memStorage) Load(path string) ([]byte, error) {
+	if m.dados == nil {
+		return nil, fmt.Errorf("mem %s: %w", path, fs.ErrNotExist)
+	}
+	return m.dados, nil
+}
+
+// cofre pequeno e barato, serializado
+func cofreSerializado(t testing.TB) []byte {
+	t.Helper()
+	st := &memStorage{}
+	v, err := vault.CreateVaultWithKDF("cofre.json", "Senha123", st, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []string{"siteA", "siteB"} {
+		if err := v.AddLocal(l, "user", "pass-"+l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st.dados
+}
+
+func TestErrosTipados(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteB", "userB", "passB"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := vault.OpenVault(path, "errada", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha errada: %v", err)
+	}
+	if _, err := vault.OpenVault(path+".nada", "Senha123", storageTeste); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("cofre inexistente: %v", err)
+	}
+	if _, _, err := v.GetCredenciais("nada"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("GetCredenciais: %v", err)
+	}
+	if _, err := v.GetEntry("nada"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("GetEntry: %v", err)
+	}
+	if err := v.UpdateLocal("nada", "u", "p"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("UpdateLocal: %v", err)
+	}
+	if err := v.DeleteLocal("nada"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("DeleteLocal: %v", err)
+	}
+	if err := v.AddLocal("siteA", "outro", "x"); !errors.Is(err, vault.ErrDuplicate) {
+		t.Fatalf("AddLocal duplicado: %v", err)
+	}
+	if err := v.UpdateEntry("siteB", vault.Entry{Local: "siteA"}); !errors.Is(err, vault.ErrDuplicate) {
+		t.Fatalf("renomear para local existente: %v", err)
+	}
+
+	// local apagado pode ser criado de novo
+	if err := v.DeleteLocal("siteA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA2"); err != nil {
+		t.Fatal(err)
+	}
+
+	v.Lock()
+	if _, err := v.ListLocais(); !errors.Is(err, vault.ErrLocked) {
+		t.Fatalf("cofre trancado: %v", err)
+	}
+}
+
+func TestCofreCorrompido(t *testing.T) {
+	// altera um campo do cabeçalho
+	cabecalho := func(campo string, valor interface{}) func(map[string]json.RawMessage, []map[string]interface{}) {
+		return func(doc map[string]json.RawMessage, _ []map[string]interface{}) {
+			mudarCabecalho(doc, campo, valor)
+		}
+	}
+	// altera um campo da primeira entrada de um cofre anterior ao MAC;
+	// sem o MAC o erro só aparece ao decifrar
+	entrada := func(campo string, f func(string) string) func(map[string]json.RawMessage, []map[string]interface{}) {
+		return func(_ map[string]json.RawMessage, es []map[string]interface{}) {
+			es[0][campo] = f(es[0][campo].(string))
+		}
+	}
+	legado, err := os.ReadFile(filepath.Join("testdata", "cofre_v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverteByte := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		b[len(b)/2] ^= 0x01
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	casos := []struct {
+		nome    string
+		bruto   func([]byte) []byte // altera os bytes do arquivo
+		altera  func(map[string]json.RawMessage, []map[string]interface{})
+		naLista bool // o erro só aparece ao decifrar as entradas
+	}{
+		{nome: "json inválido", bruto: func(b []byte) []byte { return []byte("{cofre") }},
+		{nome: "arquivo truncado", bruto: func(b []byte) []byte { return b[:len(b)/2] }},
+		{nome: "arquivo vazio", bruto: func(b []byte) []byte { return []byte{} }},
+		{nome: "salt em base64 inválido", altera: cabecalho("salt", "não é base64!")},
+		{nome: "salt vazio", altera: cabecalho("salt", "")},
+		{nome: "tag curta", altera: cabecalho("tag_check", "AAAA")},
+		{nome: "kdf desconhecido", altera: cabecalho("kdf", map[string]interface{}{"algoritmo": "md5"})},
+		{nome: "argon2 sem memória", altera: cabecalho("kdf", map[string]interface{}{"algoritmo": "argon2id", "tempo": 1, "paralelismo": 1})},
+		{nome: "iv em base64 inválido", altera: entrada("iv", func(string) string { return "@@" }), naLista: true},
+		{nome: "iv curto", altera: entrada("iv", func(string) string { return "AAAA" }), naLista: true},
+		{nome: "cipher em base64 inválido", altera: entrada("cipher", func(string) string { return "%%%" }), naLista: true},
+		{nome: "cipher alterado", altera: entrada("cipher", inverteByte), naLista: true},
+		{nome: "cipher vazio", altera: entrada("cipher", func(string) string { return "" }), naLista: true},
+		{nome: "id trocado", altera: entrada("id", func(string) string { return "AAAAAAAAAAAAAAAAAAAAAA==" }), naLista: true},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cofre.json")
+			base := cofreSerializado(t)
+			if c.naLista {
+				base = legado
+			}
+			if err := os.WriteFile(path, base, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if c.altera != nil {
+				doc, es := lerCofre(t, path)
+				c.altera(doc, es)
+				gravarCofre(t, path, doc, es)
+			}
+			if c.bruto != nil {
+				raw, _ := os.ReadFile(path)
+				os.WriteFile(path, c.bruto(raw), 0600)
+			}
+
+			v, err := vault.OpenVault(path, "Senha123", storageTeste)
+			if !c.naLista {
+				if !errors.Is(err, vault.ErrCorrupted) {
+					t.Fatalf("OpenVault: esperado ErrCorrupted, achou %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenVault: %v", err)
+			}
+			if _, err := v.ListLocais(); !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("ListLocais: esperado ErrCorrupted, achou %v", err)
+			}
+		})
+	}
+}
+
+// o fuzzing altera o arquivo do cofre; OpenVault e a leitura das entradas
+// não podem entrar em pânico nem devolver erros fora dos tipados
+func FuzzOpenVault(f *testing.F) {
+	valido := cofreSerializado(f)
+	f.Add(valido)
+	f.Add([]byte("{}"))
+	f.Add([]byte(`{"cabecalho":{"salt":"AAAA","tag_check":""},"entradas":[{}]}`))
+	if raw, err := os.ReadFile(filepath.Join("testdata", "cofre_v1.json")); err == nil {
+		f.Add(raw)
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		if caro(raw) {
+			t.Skip("derivação cara demais para o fuzzing")
+		}
+		v, err := vault.OpenVault("cofre.json", "Senha123", &memStorage{dados: raw})
+		if err != nil {
+			if !errors.Is(err, vault.ErrCorrupted) && !errors.Is(err, vault.ErrWrongPassword) {
+				t.Fatalf("OpenVault: erro não tipado: %v", err)
+			}
+			return
+		}
+		locais, err := v.ListLocais()
+		if err != nil {
+			if !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("ListLocais: erro não tipado: %v", err)
+			}
+			return
+		}
+		// o índice em disco é só uma dica: adulterado, o local some da busca
+		for _, l := range locais {
+			if _, err := v.GetEntry(l); err != nil && !errors.Is(err, vault.ErrNotFound) && !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("GetEntry(%q): erro não tipado: %v", l, err)
+			}
+		}
+	})
+}
+
+// evita derivações lentas que o fuzzing pode gerar mexendo no cabeçalho
+func caro(raw []byte) bool {
+	var doc struct {
+		Cabecalho struct {
+			Iter int              `json:"iteracoes"`
+			KDF  *vault.KDFParams `json:"kdf"`
+		} `json:"cabecalho"`
+	}
+	if json.Unmarshal(raw, &doc) != nil {
+		return false
+	}
+	if k := doc.Cabecalho.KDF; k != nil {
+		return k.Iteracoes > 200000 || k.Memoria > 64*1024 || k.Tempo > 3
+	}
+	return doc.Cabecalho.Iter > 200000
+}
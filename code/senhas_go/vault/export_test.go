@@ -0,0 +1,38 @@
+// export_test.go
+// Acesso dos testes externos (vault_test) a detalhes internos do pacote.
+
+package vault
+
+// KeyBuffer retorna a área das chaves do cofre aberto e se ela está
+// travada na RAM (nil se o cofre está trancado)
+func KeyBuffer(v *Vault) ([]byte, bool) {
+	if v.chaves == nil {
+		return nil, false
+	}
+	return v.chaves.buf, v.chaves.travada
+}
+
+// SplitSecret e CombineSecret expõem o Shamir sem o formato das partes;
+// a parte i tem x = i+1
+func SplitSecret(segredo []byte, k, n int) ([][]byte, error) {
+	return splitSecret(segredo, k, n)
+}
+
+func CombineSecret(xs []byte, ys [][]byte) []byte {
+	ss := make([]share, len(xs))
+	for i := range xs {
+		ss[i] = share{x: xs[i], y: ys[i]}
+	}
+	return combineShares(ss)
+}
+
+// CorruptMember estraga o salt do membro (por senha) e grava o cofre com
+// o MAC em dia, como faria um cliente com defeito
+func CorruptMember(v *Vault, nome string) error {
+	for i, m := range v.file.Cabecalho.Membros {
+		if m.Nome == nome {
+			v.file.Cabecalho.Membros[i].Salt = "não é base64"
+		}
+	}
+	return v.persist()
+}
@@ -0,0 +1,160 @@
+// exportcrypt.go
+// Exportação cifrada com uma senha própria, independente da senha-mestre.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	exportFormato = "senhas_go-export"
+	exportVersao  = 2
+)
+
+// arquivo da exportação cifrada: lista de Entry em JSON, cifrada com
+// AES-GCM sob uma chave derivada (Argon2id) da senha da exportação. A
+// partir da v2 a tag confere a senha antes de abrir o texto cifrado, como
+// no cabeçalho do cofre; a v1 não tem tag.
+type encryptedExport struct {
+	Formato string    `json:"formato"`
+	Versao  int       `json:"versao"`
+	KDF     KDFParams `json:"kdf"`
+	Salt    string    `json:"salt"`
+	Tag     string    `json:"tag,omitempty"`
+	IV      string    `json:"iv"`
+	Cipher  string    `json:"cipher"`
+}
+
+// AAD amarra o texto cifrado ao formato e à versão
+func exportAAD(versao int) []byte {
+	return []byte(fmt.Sprintf("%s-v%d", exportFormato, versao))
+}
+
+// ExportEncrypted grava todas as entradas cifradas com a senha informada
+func (v *Vault) ExportEncrypted(w io.Writer, senha string) error {
+	if senha == "" {
+		return errors.New("senha da exportação vazia")
+	}
+	es, err := v.entries()
+	if err != nil {
+		return err
+	}
+	if err := v.audit(AuditExport, ""); err != nil {
+		return err
+	}
+	for i := range es {
+		es[i].Anexos = nil // anexos ficam de fora: os blobs não vão junto
+	}
+	plain, err := json.Marshal(es)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	kdf := DefaultKDF
+	kauth, key, err := deriveKeys([]byte(senha), salt, kdf)
+	if err != nil {
+		return err
+	}
+	defer wipe(kauth)
+	defer wipe(key)
+	iv, ct, err := gcmSeal(key, plain, exportAAD(exportVersao))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(encryptedExport{
+		Formato: exportFormato,
+		Versao:  exportVersao,
+		KDF:     kdf,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Tag:     base64.StdEncoding.EncodeToString(exportTag(kauth)),
+		IV:      base64.StdEncoding.EncodeToString(iv),
+		Cipher:  base64.StdEncoding.EncodeToString(ct),
+	})
+}
+
+// ImportEncrypted lê uma exportação cifrada e acrescenta as entradas ao
+// cofre. Senha errada retorna ErrWrongPassword e arquivo alterado ou
+// inválido, ErrCorrupted (nas exportações v1, sem tag, as duas falhas
+// são indistinguíveis e saem como ErrWrongPassword).
+func (v *Vault) ImportEncrypted(r io.Reader, senha string) (ImportReport, error) {
+	var x encryptedExport
+	if err := json.NewDecoder(r).Decode(&x); err != nil {
+		return ImportReport{}, corrupted("exportação", err)
+	}
+	if x.Formato != exportFormato || x.Versao < 1 || x.Versao > exportVersao {
+		return ImportReport{}, fmt.Errorf("exportação não suportada: %s v%d", x.Formato, x.Versao)
+	}
+	salt, err := base64.StdEncoding.DecodeString(x.Salt)
+	if err != nil {
+		return ImportReport{}, corrupted("salt da exportação", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(x.IV)
+	if err != nil {
+		return ImportReport{}, corrupted("iv da exportação", err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(x.Cipher)
+	if err != nil {
+		return ImportReport{}, corrupted("exportação", err)
+	}
+	if len(iv) != 12 {
+		return ImportReport{}, corrupted("iv da exportação", fmt.Errorf("tamanho %d", len(iv)))
+	}
+	key, err := x.key(senha, salt)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer wipe(key)
+	plain, err := gcmOpen(key, iv, ct, exportAAD(x.Versao))
+	if err != nil {
+		if x.Versao == 1 {
+			return ImportReport{}, fmt.Errorf("%w (ou exportação v1 corrompida)", ErrWrongPassword)
+		}
+		return ImportReport{}, corrupted("exportação", err)
+	}
+	var es []Entry
+	if err := json.Unmarshal(plain, &es); err != nil {
+		return ImportReport{}, corrupted("exportação", err)
+	}
+	return v.importEntries(es)
+}
+
+// tag que confere a senha da exportação
+func exportTag(kauth []byte) []byte {
+	return tagWithLabel(kauth, "CHECK_EXPORT_V2")
+}
+
+// deriva a chave de cifra da exportação, conferindo a senha pela tag (v2)
+func (x encryptedExport) key(senha string, salt []byte) ([]byte, error) {
+	if err := x.KDF.validate(); err != nil {
+		return nil, corrupted("kdf da exportação", err)
+	}
+	if x.Versao == 1 {
+		return x.KDF.masterKey([]byte(senha), salt)
+	}
+	tag, err := base64.StdEncoding.DecodeString(x.Tag)
+	if err != nil {
+		return nil, corrupted("tag da exportação", err)
+	}
+	kauth, key, err := deriveKeys([]byte(senha), salt, x.KDF)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kauth)
+	if !hmac.Equal(tag, exportTag(kauth)) {
+		wipe(key)
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
@@ -0,0 +1,249 @@
+// filestorage.go
+// Storage local em arquivo: gravação atômica, backups e trava entre processos.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStorage grava o cofre em disco com permissão 0600.
+// Cada gravação vai para um arquivo temporário, recebe fsync e só então
+// substitui o original via rename, de modo que uma queda no meio da escrita
+// nunca deixa o cofre pela metade. Backups > 0 mantém as N versões
+// anteriores em path.1 (mais recente) ... path.N.
+//
+// A trava (flock em path.lock) cobre só a conferência de versão e a
+// escrita de SaveVersion, não o intervalo desde a leitura: o cofre fica
+// aberto em memória, e quem gravou no meio tempo faz persist retornar
+// ErrConflict. O log de auditoria, que vários processos alteram, é
+// acrescentado por AppendLine com a leitura do fim e a escrita sob a
+// mesma trava.
+type FileStorage struct {
+	Backups int
+}
+
+// Save grava sem verificar versão (sobrescreve o que houver)
+func (f FileStorage) Save(path string, data []byte) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return f.write(path, data)
+}
+
+func (f FileStorage) Load(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// LoadVersion retorna o conteúdo e sua versão (SHA-256 em hexa)
+func (f FileStorage) LoadVersion(path string) ([]byte, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, fileVersion(data), nil
+}
+
+// SaveVersion grava somente se o arquivo em disco ainda estiver na versão
+// informada; version "" exige que o arquivo não exista.
+// A verificação e a escrita acontecem sob a mesma trava (flock); a
+// leitura da versão, em LoadVersion, fica fora dela.
+func (f FileStorage) SaveVersion(path string, data []byte, version string) (string, error) {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	atual := ""
+	cur, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		atual = fileVersion(cur)
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", err
+	}
+	if atual != version {
+		return "", ErrConflict
+	}
+	if err := f.write(path, data); err != nil {
+		return "", err
+	}
+	return fileVersion(data), nil
+}
+
+// rotaciona backups e substitui o arquivo de forma atômica
+func (f FileStorage) write(path string, data []byte) error {
+	if f.Backups > 0 {
+		if err := f.rotate(path); err != nil {
+			return err
+		}
+	}
+	return writeAtomic(path, data)
+}
+
+// path.N-1 -> path.N, ..., path -> path.1 (o original é copiado, não movido)
+func (f FileStorage) rotate(path string) error {
+	cur, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := f.Backups - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return writeAtomic(backupPath(path, 1), cur)
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// SaveStream grava o conteúdo de r de forma atômica, sem backups (usado
+// pelos blobs de anexos, que nunca são reescritos)
+func (f FileStorage) SaveStream(path string, r io.Reader) error {
+	return writeAtomicFrom(path, r)
+}
+
+func (f FileStorage) LoadStream(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// AppendLine acrescenta ao fim de path com O_APPEND e fsync, sem backups;
+// só o fim do arquivo é lido, para achar a última linha. O topo é
+// substituído de forma atômica depois, ainda sob a trava de path.
+func (f FileStorage) AppendLine(path, topo string, next func(ultima []byte) ([]byte, []byte, error)) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	ultima, err := lastLine(fh)
+	if err != nil {
+		return err
+	}
+	linha, conteudo, err := next(ultima)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Write(append(linha[:len(linha):len(linha)], '\n')); err != nil {
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		return err
+	}
+	return writeAtomic(topo, conteudo)
+}
+
+// última linha não vazia do arquivo, lida de trás para frente em blocos
+func lastLine(fh *os.File) ([]byte, error) {
+	info, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	for pos := info.Size(); pos > 0; {
+		n := min(pos, 4096)
+		pos -= n
+		bloco := make([]byte, n)
+		if _, err := fh.ReadAt(bloco, pos); err != nil {
+			return nil, err
+		}
+		buf = append(bloco, buf...)
+		resto := bytes.TrimRight(buf, "\n\r\t ")
+		if i := bytes.LastIndexByte(resto, '\n'); i >= 0 {
+			return resto[i+1:], nil
+		}
+		if pos == 0 && len(resto) > 0 {
+			return resto, nil
+		}
+	}
+	return nil, nil
+}
+
+// Remove apaga o arquivo (e os backups, se houver)
+func (f FileStorage) Remove(path string) error {
+	for i := 1; i <= f.Backups; i++ {
+		if err := os.Remove(backupPath(path, i)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// grava em arquivo temporário no mesmo diretório, fsync e rename
+func writeAtomic(path string, data []byte) error {
+	return writeAtomicFrom(path, bytes.NewReader(data))
+}
+
+func writeAtomicFrom(path string, r io.Reader) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if err := tmp.Chmod(0600); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	ok = true
+	syncDir(dir)
+	return nil
+}
+
+// fsync do diretório para o rename sobreviver a uma queda (melhor esforço)
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+func fileVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,224 @@
+// filestorage_test.go
+
+/*
+Testes do FileStorage: gravação atômica, backups e detecção de conflito
+*/
+package vault_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestFileStorageBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cofre.json")
+	st := vault.FileStorage{Backups: 2}
+
+	for _, s := range []string{"v1", "v2", "v3", "v4"} {
+		if err := st.Save(path, []byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	esperado := map[string]string{
+		path:        "v4",
+		path + ".1": "v3",
+		path + ".2": "v2",
+	}
+	for p, conteudo := range esperado {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != conteudo {
+			t.Fatalf("%s: esperado %q, achou %q", p, conteudo, b)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("backup além do limite não foi descartado")
+	}
+
+	// nenhum temporário pode sobrar no diretório
+	arqs, _ := os.ReadDir(dir)
+	for _, a := range arqs {
+		if strings.Contains(a.Name(), ".tmp-") {
+			t.Fatalf("arquivo temporário esquecido: %s", a.Name())
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("permissão esperada 0600, achou %v", info.Mode().Perm())
+	}
+}
+
+func TestFileStorageConflito(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	if _, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+
+	// dois "processos" abrem o mesmo cofre
+	v1, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddLocal("siteB", "userB", "passB"); !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("esperado ErrConflict, achou %v", err)
+	}
+
+	// a entrada do primeiro continua no disco
+	v3, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v3.GetCredenciais("siteA"); err != nil {
+		t.Fatal("entrada de v1 foi sobrescrita")
+	}
+}
+
+func TestFileStorageConcorrente(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	st := vault.FileStorage{}
+	if err := st.Save(path, []byte("base")); err != nil {
+		t.Fatal(err)
+	}
+	_, ver, err := st.LoadVersion(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// várias gravações partindo da mesma versão: só uma pode vencer
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok, conflitos := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := st.SaveVersion(path, []byte{byte('a' + i)}, ver)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case errors.Is(err, vault.ErrConflict):
+				conflitos++
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if ok != 1 || conflitos != 9 {
+		t.Fatalf("esperado 1 gravação e 9 conflitos, achou %d e %d", ok, conflitos)
+	}
+}
+
+// a leitura do fim e o acréscimo ficam sob a mesma trava: ninguém
+// continua de uma última linha que outro já continuou
+func TestFileStorageAppendConcorrente(t *testing.T) {
+	dir := t.TempDir()
+	path, topo := filepath.Join(dir, "log"), filepath.Join(dir, "log.topo")
+	st := vault.FileStorage{Backups: 2}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := st.AppendLine(path, topo, func(ultima []byte) ([]byte, []byte, error) {
+				n := 0
+				if ultima != nil {
+					n, _ = strconv.Atoi(string(ultima))
+				}
+				linha := []byte(strconv.Itoa(n + 1))
+				return linha, linha, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	raw, _ := os.ReadFile(path)
+	linhas := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	for i, l := range linhas {
+		if l != strconv.Itoa(i+1) {
+			t.Fatalf("linha %d: %q\n%s", i+1, l, raw)
+		}
+	}
+	if len(linhas) != 20 {
+		t.Fatalf("%d linhas", len(linhas))
+	}
+	if b, _ := os.ReadFile(topo); string(b) != "20" {
+		t.Fatalf("topo: %q", b)
+	}
+	if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("backup do log: %v", err)
+	}
+}
+
+func TestReloadELock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v1, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+
+	// v1 continua aberto e passa a ver a gravação de v2 sem a senha
+	if err := v1.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := v1.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("Reload não trouxe a entrada: %q %v", p, err)
+	}
+	if err := v1.AddLocal("siteB", "userB", "passB"); err != nil {
+		t.Fatalf("gravação depois do Reload: %v", err)
+	}
+
+	// com a senha trocada as chaves em memória não servem mais
+	if err := v2.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.Rekey("Outra", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.Reload(); err == nil {
+		t.Fatal("Reload aceitou cofre com outra senha")
+	}
+
+	v2.Lock()
+	if !v2.Locked() {
+		t.Fatal("cofre não ficou trancado")
+	}
+	if _, err := v2.GetEntry("siteA"); err == nil {
+		t.Fatal("cofre trancado ainda decifra")
+	}
+	if err := v2.Reload(); !errors.Is(err, vault.ErrLocked) {
+		t.Fatalf("esperado ErrLocked, achou %v", err)
+	}
+}
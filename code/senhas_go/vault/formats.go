@@ -0,0 +1,352 @@
+// formats.go
+// Importação e exportação em formatos de outros gerenciadores de senhas.
+
+package vault
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format identifica um formato de importação/exportação
+type Format string
+
+const (
+	FormatBitwarden Format = "bitwarden" // JSON não cifrado do Bitwarden
+	FormatKeePass   Format = "keepass"   // XML do KeePass 2.x
+	Format1Password Format = "1password" // CSV do 1Password
+	FormatChrome    Format = "chrome"    // CSV do Chrome/Edge
+	FormatFirefox   Format = "firefox"   // CSV do Firefox
+)
+
+// ImportReport é o resultado de uma importação
+type ImportReport struct {
+	Importadas []string          // locais criados
+	Renomeadas map[string]string // nome original -> local criado, quando já existia
+	Ignoradas  []string          // itens sem nome ou idênticos a uma entrada existente
+}
+
+// Export grava todas as entradas em texto claro no formato escolhido
+func (v *Vault) Export(w io.Writer, f Format) error {
+	es, err := v.entries()
+	if err != nil {
+		return err
+	}
+	if err := v.audit(AuditExport, ""); err != nil {
+		return err
+	}
+	switch f {
+	case FormatBitwarden:
+		return exportBitwarden(w, es)
+	case FormatKeePass:
+		return exportKeePass(w, es)
+	case Format1Password, FormatChrome, FormatFirefox:
+		return exportCSV(w, csvFormats[f], es)
+	}
+	return fmt.Errorf("formato desconhecido: %q", f)
+}
+
+// Import lê entradas no formato escolhido e as acrescenta ao cofre.
+// Locais que já existem ganham outro nome ("site (usuario)", "site (2)").
+func (v *Vault) Import(r io.Reader, f Format) (ImportReport, error) {
+	var (
+		es  []Entry
+		err error
+	)
+	switch f {
+	case FormatBitwarden:
+		es, err = importBitwarden(r)
+	case FormatKeePass:
+		es, err = importKeePass(r)
+	case Format1Password, FormatChrome, FormatFirefox:
+		es, err = importCSV(r, csvFormats[f])
+	default:
+		err = fmt.Errorf("formato desconhecido: %q", f)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+	return v.importEntries(es)
+}
+
+// acrescenta as entradas com uma única gravação no final; se algo falha,
+// nenhuma fica em memória
+func (v *Vault) importEntries(es []Entry) (ImportReport, error) {
+	antes := v.saveState()
+	rep, err := v.addImported(es)
+	if err == nil {
+		// addImported decifrou as entradas existentes para comparar
+		err = v.audit(AuditImport, "")
+	}
+	if err == nil && len(rep.Importadas) > 0 {
+		err = v.persist()
+	}
+	if err != nil {
+		v.restoreState(antes)
+	}
+	return rep, err
+}
+
+// acrescenta as entradas importadas, sem persistir
+func (v *Vault) addImported(es []Entry) (ImportReport, error) {
+	rep := ImportReport{Renomeadas: map[string]string{}}
+	agora := time.Now().UTC()
+	for _, e := range es {
+		e.Local = strings.TrimSpace(e.Local)
+		e.Anexos = nil // os blobs não vêm na exportação
+		if e.Local == "" {
+			rep.Ignoradas = append(rep.Ignoradas, e.Usuario)
+			continue
+		}
+		_, atual, err := v.getEntry(e.Local)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return rep, err
+		}
+		if err == nil && sameContent(atual, e) {
+			rep.Ignoradas = append(rep.Ignoradas, e.Local)
+			continue
+		}
+		if e.TOTP != "" {
+			if _, err := ParseTOTP(e.TOTP); err != nil {
+				// segredo em formato desconhecido: não se perde, vira campo livre
+				if e.Campos == nil {
+					e.Campos = map[string]string{}
+				}
+				e.Campos["totp"] = e.TOTP
+				e.TOTP = ""
+			}
+		}
+		original := e.Local
+		if e.Local, err = v.uniqueLocal(e.Local, e.Usuario); err != nil {
+			return rep, err
+		}
+		if e.Local != original {
+			rep.Renomeadas[original] = e.Local
+		}
+		if e.Criado.IsZero() {
+			e.Criado = agora
+		}
+		if e.Alterado.IsZero() {
+			e.Alterado = e.Criado
+		}
+		if err := v.addEntry(e, ""); err != nil {
+			return rep, err
+		}
+		rep.Importadas = append(rep.Importadas, e.Local)
+	}
+	return rep, nil
+}
+
+// nome livre para o local: o próprio, "local (usuario)" ou "local (N)"
+func (v *Vault) uniqueLocal(local, usuario string) (string, error) {
+	candidatos := []string{local}
+	if usuario != "" {
+		candidatos = append(candidatos, local+" ("+usuario+")")
+	}
+	for i := 2; ; i++ {
+		for _, c := range candidatos {
+			pos, err := v.lookup(c)
+			if err != nil {
+				return "", err
+			}
+			if len(pos) == 0 {
+				return c, nil
+			}
+		}
+		candidatos = []string{local + " (" + strconv.Itoa(i) + ")"}
+	}
+}
+
+// ------------------ CSV ------------------
+
+// colunas de um formato CSV: cabeçalho exportado e apelidos aceitos na importação
+type csvFormat struct {
+	cabecalho []string
+	campo     func(e Entry, coluna string) string
+	apelidos  map[string]string // coluna (minúscula) -> campo da Entry
+}
+
+var csvFormats = map[Format]csvFormat{
+	Format1Password: {
+		cabecalho: []string{"Title", "Website", "Username", "Password", "OTPAuth", "Favorite", "Archived", "Tags", "Notes"},
+		campo: func(e Entry, c string) string {
+			switch c {
+			case "Title":
+				return e.Local
+			case "Website":
+				return firstURL(e)
+			case "Username":
+				return e.Usuario
+			case "Password":
+				return e.Senha
+			case "OTPAuth":
+				return e.TOTP
+			case "Favorite", "Archived":
+				return "false"
+			case "Tags":
+				return strings.Join(e.Tags, ";")
+			case "Notes":
+				return e.Notas
+			}
+			return ""
+		},
+		apelidos: map[string]string{
+			"title": "local", "website": "url", "url": "url", "username": "usuario",
+			"password": "senha", "otpauth": "totp", "tags": "tags", "notes": "notas",
+		},
+	},
+	FormatChrome: {
+		cabecalho: []string{"name", "url", "username", "password", "note"},
+		campo: func(e Entry, c string) string {
+			switch c {
+			case "name":
+				return e.Local
+			case "url":
+				return firstURL(e)
+			case "username":
+				return e.Usuario
+			case "password":
+				return e.Senha
+			case "note":
+				return e.Notas
+			}
+			return ""
+		},
+		apelidos: map[string]string{
+			"name": "local", "url": "url", "username": "usuario", "password": "senha",
+			"note": "notas", "notes": "notas",
+		},
+	},
+	FormatFirefox: {
+		cabecalho: []string{"url", "username", "password", "httpRealm", "formActionOrigin", "guid", "timeCreated", "timeLastUsed", "timePasswordChanged"},
+		campo: func(e Entry, c string) string {
+			switch c {
+			case "url":
+				if u := firstURL(e); u != "" {
+					return u
+				}
+				return "https://" + e.Local
+			case "username":
+				return e.Usuario
+			case "password":
+				return e.Senha
+			case "timeCreated":
+				return strconv.FormatInt(e.Criado.UnixMilli(), 10)
+			case "timePasswordChanged":
+				return strconv.FormatInt(e.Alterado.UnixMilli(), 10)
+			}
+			return ""
+		},
+		apelidos: map[string]string{
+			"url": "url", "username": "usuario", "password": "senha",
+			"timecreated": "criado", "timepasswordchanged": "alterado",
+		},
+	},
+}
+
+func firstURL(e Entry) string {
+	if len(e.URLs) > 0 {
+		return e.URLs[0]
+	}
+	return ""
+}
+
+func exportCSV(w io.Writer, f csvFormat, es []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(f.cabecalho); err != nil {
+		return err
+	}
+	for _, e := range es {
+		linha := make([]string, len(f.cabecalho))
+		for i, c := range f.cabecalho {
+			linha[i] = f.campo(e, c)
+		}
+		if err := cw.Write(linha); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func importCSV(r io.Reader, f csvFormat) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	linhas, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(linhas) == 0 {
+		return nil, nil
+	}
+	colunas := make([]string, len(linhas[0]))
+	for i, c := range linhas[0] {
+		colunas[i] = f.apelidos[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(c, "\ufeff")))]
+	}
+	es := []Entry{}
+	for _, linha := range linhas[1:] {
+		e := Entry{}
+		for i, valor := range linha {
+			if i >= len(colunas) || valor == "" {
+				continue
+			}
+			switch colunas[i] {
+			case "local":
+				e.Local = valor
+			case "url":
+				e.URLs = []string{valor}
+			case "usuario":
+				e.Usuario = valor
+			case "senha":
+				e.Senha = valor
+			case "totp":
+				e.TOTP = valor
+			case "notas":
+				e.Notas = valor
+			case "tags":
+				e.Tags = splitTags(valor)
+			case "criado", "alterado":
+				ms, err := strconv.ParseInt(valor, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("data inválida %q: %w", valor, err)
+				}
+				if colunas[i] == "criado" {
+					e.Criado = time.UnixMilli(ms).UTC()
+				} else {
+					e.Alterado = time.UnixMilli(ms).UTC()
+				}
+			}
+		}
+		if e.Local == "" && len(e.URLs) > 0 {
+			e.Local = hostOf(e.URLs[0])
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// tags separadas por ";" ou ","
+func splitTags(s string) []string {
+	res := []string{}
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// host de uma URL ("https://www.exemplo.com/login" -> "www.exemplo.com")
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	return u.Hostname()
+}
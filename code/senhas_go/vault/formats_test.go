@@ -0,0 +1,266 @@
+// formats_test.go
+
+/*
+Testes de importação e exportação (Bitwarden, KeePass, CSVs e exportação cifrada)
+*/
+package vault_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+var entradasExemplo = []vault.Entry{
+	{
+		Local:   "github.com",
+		Usuario: "cleuton",
+		Senha:   "s3nh4,com\"aspas\"",
+		URLs:    []string{"https://github.com/login", "https://gist.github.com"},
+		Notas:   "conta pessoal\nsegunda linha",
+		Tags:    []string{"dev"},
+		Campos:  map[string]string{"pin": "1234", "pergunta": "azul"},
+		TOTP:    "otpauth://totp/GitHub:cleuton?secret=JBSWY3DPEHPK3PXP&issuer=GitHub",
+		Criado:  time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+	},
+	{
+		Local:    "example.com",
+		Usuario:  "alice",
+		Senha:    "<xml&chars>",
+		URLs:     []string{"https://example.com"},
+		Criado:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Alterado: time.Date(2024, 2, 2, 3, 4, 5, 0, time.UTC),
+	},
+}
+
+func cofreComExemplos(t *testing.T) *vault.Vault {
+	t.Helper()
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "origem.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entradasExemplo {
+		if err := v.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+func cofreVazio(t *testing.T) *vault.Vault {
+	t.Helper()
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "destino.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// mantém só os campos que o formato consegue representar
+type filtro func(e vault.Entry) vault.Entry
+
+func comparar(t *testing.T, v *vault.Vault, f filtro) {
+	t.Helper()
+	for _, esperado := range entradasExemplo {
+		got, err := v.GetEntry(esperado.Local)
+		if err != nil {
+			t.Fatalf("%s: %v", esperado.Local, err)
+		}
+		esperado, got = f(esperado), f(got)
+		if !reflect.DeepEqual(esperado, got) {
+			t.Errorf("entrada diferente após ida e volta:\nesperado %+v\nachou    %+v", esperado, got)
+		}
+	}
+}
+
+func TestRoundTripFormatos(t *testing.T) {
+	basico := func(e vault.Entry) vault.Entry {
+		return vault.Entry{Local: e.Local, Usuario: e.Usuario, Senha: e.Senha, URLs: e.URLs[:1]}
+	}
+	casos := []struct {
+		formato vault.Format
+		filtro  filtro
+	}{
+		{vault.FormatBitwarden, func(e vault.Entry) vault.Entry {
+			e.Revisao, e.Alterado = 0, time.Time{}
+			return e
+		}},
+		{vault.FormatKeePass, func(e vault.Entry) vault.Entry {
+			e.Revisao, e.Alterado = 0, time.Time{}
+			return e
+		}},
+		{vault.Format1Password, func(e vault.Entry) vault.Entry {
+			b := basico(e)
+			b.TOTP, b.Tags, b.Notas = e.TOTP, e.Tags, e.Notas
+			return b
+		}},
+		{vault.FormatChrome, func(e vault.Entry) vault.Entry {
+			b := basico(e)
+			b.Notas = e.Notas
+			return b
+		}},
+		{vault.FormatFirefox, func(e vault.Entry) vault.Entry {
+			b := basico(e)
+			b.Criado = e.Criado
+			return b
+		}},
+	}
+	origem := cofreComExemplos(t)
+	for _, c := range casos {
+		t.Run(string(c.formato), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := origem.Export(&buf, c.formato); err != nil {
+				t.Fatal(err)
+			}
+			destino := cofreVazio(t)
+			rep, err := destino.Import(bytes.NewReader(buf.Bytes()), c.formato)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rep.Importadas) != len(entradasExemplo) {
+				t.Fatalf("importadas %v", rep.Importadas)
+			}
+			comparar(t, destino, c.filtro)
+
+			// importar de novo não duplica entradas idênticas
+			rep, err = destino.Import(bytes.NewReader(buf.Bytes()), c.formato)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rep.Importadas) != 0 || len(rep.Ignoradas) != len(entradasExemplo) {
+				t.Fatalf("reimportação duplicou entradas: %+v", rep)
+			}
+		})
+	}
+}
+
+func TestImportNomesRepetidos(t *testing.T) {
+	// exportação do Firefox com duas contas no mesmo site
+	csv := "url,username,password,httpRealm,formActionOrigin,guid,timeCreated,timeLastUsed,timePasswordChanged\n" +
+		"https://login.exemplo.com,ana,a1,,https://login.exemplo.com,{1},1700000000000,,1700000000000\n" +
+		"https://login.exemplo.com,bia,b2,,https://login.exemplo.com,{2},1700000000000,,1700000000000\n" +
+		",semsite,x,,,{3},,,\n"
+	v := cofreVazio(t)
+	rep, err := v.Import(strings.NewReader(csv), vault.FormatFirefox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rep.Importadas, []string{"login.exemplo.com", "login.exemplo.com (bia)"}) {
+		t.Fatalf("importadas %v", rep.Importadas)
+	}
+	if rep.Renomeadas["login.exemplo.com"] != "login.exemplo.com (bia)" || len(rep.Ignoradas) != 1 {
+		t.Fatalf("relatório inesperado: %+v", rep)
+	}
+	if _, p, _ := v.GetCredenciais("login.exemplo.com (bia)"); p != "b2" {
+		t.Fatal("segunda conta não importada")
+	}
+}
+
+// importação que não grava não deixa entradas em memória para a próxima
+// gravação levar junto
+func TestImportGravacaoFalha(t *testing.T) {
+	st := &memStorage{}
+	v, err := vault.CreateVaultWithKDF("cofre.json", "Senha123", st, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := "url,username,password,httpRealm,formActionOrigin,guid,timeCreated,timeLastUsed,timePasswordChanged\n" +
+		"https://login.exemplo.com,ana,a1,,,{1},,,\n"
+	st.falha = errors.New("disco cheio")
+	if _, err := v.Import(strings.NewReader(csv), vault.FormatFirefox); !errors.Is(err, st.falha) {
+		t.Fatalf("esperado erro de gravação, achou %v", err)
+	}
+	st.falha = nil
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if ls := locais(t, v); !reflect.DeepEqual(ls, []string{"siteA"}) {
+		t.Fatalf("importação não gravada foi levada junto: %v", ls)
+	}
+}
+
+func TestImportKeePassGrupos(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Root>
+		<Group>
+			<Name>Database</Name>
+			<Group>
+				<Name>Trabalho</Name>
+				<Entry>
+					<UUID>AAAAAAAAAAAAAAAAAAAAAA==</UUID>
+					<String><Key>Title</Key><Value>vpn</Value></String>
+					<String><Key>UserName</Key><Value>cleuton</Value></String>
+					<String><Key>Password</Key><Value ProtectInMemory="True">segredo</Value></String>
+					<String><Key>TimeOtp-Secret-Base32</Key><Value>JBSWY3DPEHPK3PXP</Value></String>
+				</Entry>
+			</Group>
+			<Group>
+				<Name>Recycle Bin</Name>
+				<Entry><String><Key>Title</Key><Value>apagada</Value></String></Entry>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`
+	v := cofreVazio(t)
+	rep, err := v.Import(strings.NewReader(xml), vault.FormatKeePass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rep.Importadas, []string{"vpn"}) {
+		t.Fatalf("importadas %v", rep.Importadas)
+	}
+	e, _ := v.GetEntry("vpn")
+	if e.Senha != "segredo" || !reflect.DeepEqual(e.Tags, []string{"Trabalho"}) || e.TOTP == "" {
+		t.Fatalf("entrada KeePass interpretada errado: %+v", e)
+	}
+}
+
+func TestExportCifrada(t *testing.T) {
+	origem := cofreComExemplos(t)
+	var buf bytes.Buffer
+	if err := origem.ExportEncrypted(&buf, "senha-da-exportacao"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("cleuton")) {
+		t.Fatal("exportação cifrada contém texto claro")
+	}
+
+	destino := cofreVazio(t)
+	if _, err := destino.ImportEncrypted(bytes.NewReader(buf.Bytes()), "errada"); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha errada: esperado ErrWrongPassword, achou %v", err)
+	}
+	// texto cifrado alterado, com a senha certa
+	var x map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &x); err != nil {
+		t.Fatal(err)
+	}
+	ct := []byte(x["cipher"].(string))
+	if ct[10] == 'A' {
+		ct[10] = 'B'
+	} else {
+		ct[10] = 'A'
+	}
+	x["cipher"] = string(ct)
+	adulterada, _ := json.Marshal(x)
+	if _, err := destino.ImportEncrypted(bytes.NewReader(adulterada), "senha-da-exportacao"); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("arquivo alterado: esperado ErrCorrupted, achou %v", err)
+	}
+	if _, err := destino.ImportEncrypted(strings.NewReader("{não é json"), "senha-da-exportacao"); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("arquivo inválido: esperado ErrCorrupted, achou %v", err)
+	}
+	if _, err := destino.ImportEncrypted(bytes.NewReader(buf.Bytes()), "senha-da-exportacao"); err != nil {
+		t.Fatal(err)
+	}
+	comparar(t, destino, func(e vault.Entry) vault.Entry {
+		e.Revisao, e.Alterado = 0, time.Time{}
+		return e
+	})
+}
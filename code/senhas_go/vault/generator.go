@@ -0,0 +1,177 @@
+// generator.go
+// Geração de senhas aleatórias e de frases-senha estilo diceware.
+
+package vault
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Lista grande de palavras da EFF (7776 palavras, CC BY 3.0):
+// https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt
+//
+//go:embed eff_large_wordlist.txt
+var effWordlist string
+
+var wordlist = strings.Fields(effWordlist)
+
+// classes de caracteres
+const (
+	charsMinusculas = "abcdefghijklmnopqrstuvwxyz"
+	charsMaiusculas = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	charsDigitos    = "0123456789"
+	charsSimbolos   = "!@#$%^&*()-_=+[]{};:,.<>/?~"
+	charsAmbiguos   = "0O1lI|`'\""
+)
+
+// PasswordPolicy define como GeneratePassword monta a senha.
+// Cada classe habilitada aparece pelo menos uma vez.
+type PasswordPolicy struct {
+	Tamanho     int
+	Minusculas  bool
+	Maiusculas  bool
+	Digitos     bool
+	Simbolos    bool
+	SemAmbiguos bool // exclui caracteres confundíveis (0/O, 1/l/I...)
+}
+
+// DefaultPasswordPolicy: 20 caracteres de todas as classes
+var DefaultPasswordPolicy = PasswordPolicy{
+	Tamanho:    20,
+	Minusculas: true,
+	Maiusculas: true,
+	Digitos:    true,
+	Simbolos:   true,
+}
+
+// PassphrasePolicy define como GeneratePassphrase monta a frase-senha
+type PassphrasePolicy struct {
+	Palavras   int
+	Separador  string
+	Maiusculas bool // primeira letra de cada palavra em maiúscula
+	ComNumero  bool // acrescenta um dígito ao fim de uma das palavras
+}
+
+// DefaultPassphrasePolicy: 6 palavras (~77 bits)
+var DefaultPassphrasePolicy = PassphrasePolicy{Palavras: 6, Separador: "-"}
+
+// inteiro uniforme em [0, n)
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// remove os caracteres ambíguos de um conjunto
+func semAmbiguos(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(charsAmbiguos, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// GeneratePassword gera uma senha aleatória conforme a política
+func GeneratePassword(p PasswordPolicy) (string, error) {
+	classes := []string{}
+	for _, c := range []struct {
+		on    bool
+		chars string
+	}{
+		{p.Minusculas, charsMinusculas},
+		{p.Maiusculas, charsMaiusculas},
+		{p.Digitos, charsDigitos},
+		{p.Simbolos, charsSimbolos},
+	} {
+		if !c.on {
+			continue
+		}
+		if p.SemAmbiguos {
+			c.chars = semAmbiguos(c.chars)
+		}
+		classes = append(classes, c.chars)
+	}
+	if len(classes) == 0 {
+		return "", errors.New("política sem nenhuma classe de caracteres")
+	}
+	if p.Tamanho < len(classes) {
+		return "", errors.New("tamanho menor que o número de classes")
+	}
+
+	todas := strings.Join(classes, "")
+	senha := make([]byte, 0, p.Tamanho)
+	// um de cada classe, o resto de qualquer uma
+	for _, c := range classes {
+		i, err := randIndex(len(c))
+		if err != nil {
+			return "", err
+		}
+		senha = append(senha, c[i])
+	}
+	for len(senha) < p.Tamanho {
+		i, err := randIndex(len(todas))
+		if err != nil {
+			return "", err
+		}
+		senha = append(senha, todas[i])
+	}
+	// embaralha (Fisher-Yates) para as classes obrigatórias não ficarem no início
+	for i := len(senha) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		senha[i], senha[j] = senha[j], senha[i]
+	}
+	return string(senha), nil
+}
+
+// GeneratePassphrase sorteia palavras da lista da EFF
+func GeneratePassphrase(p PassphrasePolicy) (string, error) {
+	if p.Palavras < 1 {
+		return "", errors.New("frase-senha precisa de pelo menos uma palavra")
+	}
+	palavras := make([]string, p.Palavras)
+	for k := range palavras {
+		i, err := randIndex(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		w := wordlist[i]
+		if p.Maiusculas {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		palavras[k] = w
+	}
+	if p.ComNumero {
+		k, err := randIndex(len(palavras))
+		if err != nil {
+			return "", err
+		}
+		d, err := randIndex(10)
+		if err != nil {
+			return "", err
+		}
+		palavras[k] += charsDigitos[d : d+1]
+	}
+	return strings.Join(palavras, p.Separador), nil
+}
+
+// AddGenerated cria uma entrada com senha gerada pela política e a retorna
+func (v *Vault) AddGenerated(local, usuario string, p PasswordPolicy) (string, error) {
+	senha, err := GeneratePassword(p)
+	if err != nil {
+		return "", err
+	}
+	if err := v.AddLocal(local, usuario, senha); err != nil {
+		return "", err
+	}
+	return senha, nil
+}
@@ -0,0 +1,123 @@
+// generator_test.go
+
+/*
+Testes do gerador de senhas, do estimador de força e da auditoria
+*/
+package vault_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	p := vault.PasswordPolicy{Tamanho: 12, Minusculas: true, Digitos: true, SemAmbiguos: true}
+	for i := 0; i < 200; i++ {
+		s, err := vault.GeneratePassword(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s) != 12 {
+			t.Fatalf("tamanho errado: %q", s)
+		}
+		if strings.ContainsAny(s, "0O1lI|ABCDEFGHIJKLMNOPQRSTUVWXYZ!@#$") {
+			t.Fatalf("caractere fora da política: %q", s)
+		}
+		if !strings.ContainsAny(s, "23456789") || !strings.ContainsAny(s, "abcdefghijkmnopqrstuvwxyz") {
+			t.Fatalf("classe obrigatória ausente: %q", s)
+		}
+	}
+	if _, err := vault.GeneratePassword(vault.PasswordPolicy{Tamanho: 10}); err == nil {
+		t.Fatal("aceitou política sem classes")
+	}
+	if _, err := vault.GeneratePassword(vault.PasswordPolicy{Tamanho: 2, Minusculas: true, Maiusculas: true, Digitos: true}); err == nil {
+		t.Fatal("aceitou tamanho menor que o número de classes")
+	}
+	s, err := vault.GeneratePassword(vault.DefaultPasswordPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := vault.EstimateStrength(s); f.Nivel != vault.NivelForte {
+		t.Fatalf("senha gerada considerada %s: %q", f.Nivel, s)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	s, err := vault.GeneratePassphrase(vault.PassphrasePolicy{Palavras: 5, Separador: " ", Maiusculas: true, ComNumero: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	palavras := strings.Split(s, " ")
+	if len(palavras) != 5 {
+		t.Fatalf("esperado 5 palavras: %q", s)
+	}
+	if !strings.ContainsAny(s, "0123456789") {
+		t.Fatalf("frase sem número: %q", s)
+	}
+	for _, p := range palavras {
+		if p[0] < 'A' || p[0] > 'Z' {
+			t.Fatalf("palavra sem maiúscula: %q", s)
+		}
+	}
+	s, _ = vault.GeneratePassphrase(vault.DefaultPassphrasePolicy)
+	if f := vault.EstimateStrength(s); f.Entropia < 70 || f.Nivel != vault.NivelForte {
+		t.Fatalf("frase-senha padrão subestimada: %q %+v", s, f)
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	casos := []struct {
+		senha string
+		nivel string
+		comum bool
+	}{
+		{"123456", vault.NivelFraca, true},
+		{"P@ssw0rd", vault.NivelFraca, true},
+		{"Senha@2024", vault.NivelFraca, true},
+		{"qwertyuiop", vault.NivelFraca, true},
+		{"aaaaaaaaaaaaaaaa", vault.NivelFraca, false},
+		{"abcdefgh12345678", vault.NivelFraca, false},
+		{"dragonfly", vault.NivelFraca, false},
+		{"k8#Qz!w2Lm", vault.NivelMedia, false},
+		{"xT7#pQ2!vL9@mZ4&wR6$", vault.NivelForte, false},
+	}
+	for _, c := range casos {
+		f := vault.EstimateStrength(c.senha)
+		if f.Nivel != c.nivel || f.Comum != c.comum {
+			t.Errorf("%q: esperado %s/comum=%v, achou %s/comum=%v (%.1f bits, %v)",
+				c.senha, c.nivel, c.comum, f.Nivel, f.Comum, f.Entropia, f.Motivos)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forte, err := v.AddGenerated("banco", "cleuton", vault.DefaultPasswordPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, _ := v.GetCredenciais("banco"); p != forte {
+		t.Fatal("senha gerada não foi gravada")
+	}
+	v.AddLocal("email", "cleuton", "xT7#pQ2!vL9@mZ4&wR6$")
+	v.AddLocal("forum", "cleuton", "xT7#pQ2!vL9@mZ4&wR6$")
+	v.AddLocal("wifi", "casa", "password1")
+
+	rep, err := v.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Total != 4 || rep.Fracas != 1 || rep.Comuns != 1 || rep.Reutilizadas != 2 {
+		t.Fatalf("relatório inesperado: %+v", rep)
+	}
+	if len(rep.Itens) != 3 || rep.Itens[0].Local != "email" || rep.Itens[0].ReutilizadaEm[0] != "forum" {
+		t.Fatalf("itens inesperados: %+v", rep.Itens)
+	}
+}
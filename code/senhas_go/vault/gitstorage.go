@@ -0,0 +1,169 @@
+// gitstorage.go
+// Storage em repositório Git: cada gravação do cofre é um commit, o que
+// dá histórico e permite sincronizar por push/pull. Usa o comando git.
+
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitStorage grava o cofre no repositório em Dir (criado com git init se
+// preciso). O path do cofre é relativo a Dir. A versão é o hash do último
+// commit que alterou o arquivo; a leitura vem sempre do HEAD.
+type GitStorage struct {
+	Dir   string
+	Nome  string // autor dos commits; padrão "senhas"
+	Email string // padrão "senhas@localhost"
+}
+
+func (g GitStorage) Save(path string, data []byte) error {
+	unlock, err := g.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, err = g.commit(path, data)
+	return err
+}
+
+func (g GitStorage) Load(path string) ([]byte, error) {
+	data, _, err := g.LoadVersion(path)
+	return data, err
+}
+
+// LoadVersion retorna o arquivo como está no commit que o gravou por
+// último (a partir do HEAD) e o hash desse commit
+func (g GitStorage) LoadVersion(path string) ([]byte, string, error) {
+	if err := checkRelPath(path); err != nil {
+		return nil, "", err
+	}
+	ver, err := g.version(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if ver == "" {
+		return nil, "", fmt.Errorf("git %s: %w", path, fs.ErrNotExist)
+	}
+	data, err := g.git("show", ver+":"+filepath.ToSlash(path))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ver, nil
+}
+
+// SaveVersion faz o commit somente se o último commit do arquivo ainda
+// for version; version "" exige que o arquivo não esteja no repositório
+func (g GitStorage) SaveVersion(path string, data []byte, version string) (string, error) {
+	unlock, err := g.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	atual, err := g.version(path)
+	if err != nil {
+		return "", err
+	}
+	if atual != version {
+		return "", ErrConflict
+	}
+	return g.commit(path, data)
+}
+
+// trava entre processos do próprio repositório (cria o repositório se preciso)
+func (g GitStorage) lock() (func(), error) {
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(g.Dir, 0700); err != nil {
+			return nil, err
+		}
+		if _, err := g.git("init", "-q"); err != nil {
+			return nil, err
+		}
+	}
+	return lockFile(filepath.Join(g.Dir, ".git", "senhas"))
+}
+
+// hash do último commit que tocou o arquivo ("" se não há nenhum)
+func (g GitStorage) version(path string) (string, error) {
+	if err := checkRelPath(path); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	// repositório sem nenhum commit
+	if _, err := g.git("rev-parse", "-q", "--verify", "HEAD"); err != nil {
+		var saida *exec.ExitError
+		if errors.As(err, &saida) {
+			return "", nil
+		}
+		return "", err
+	}
+	out, err := g.git("log", "-1", "--format=%H", "HEAD", "--", filepath.ToSlash(path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// grava o arquivo na árvore de trabalho e faz o commit só dele
+func (g GitStorage) commit(path string, data []byte) (string, error) {
+	if err := checkRelPath(path); err != nil {
+		return "", err
+	}
+	full := filepath.Join(g.Dir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+		return "", err
+	}
+	if err := writeAtomic(full, data); err != nil {
+		return "", err
+	}
+	rel := filepath.ToSlash(path)
+	if _, err := g.git("add", "--", rel); err != nil {
+		return "", err
+	}
+	nome, email := g.Nome, g.Email
+	if nome == "" {
+		nome = "senhas"
+	}
+	if email == "" {
+		email = "senhas@localhost"
+	}
+	// --allow-empty: toda gravação vira um commit, mesmo sem mudança
+	if _, err := g.git("-c", "user.name="+nome, "-c", "user.email="+email,
+		"commit", "-q", "--allow-empty", "--no-verify", "-m", "senhas: atualiza "+rel, "--", rel); err != nil {
+		return "", err
+	}
+	out, err := g.git("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g GitStorage) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// o cofre precisa ficar dentro do repositório
+func checkRelPath(path string) error {
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("caminho fora do repositório: %q", path)
+	}
+	return nil
+}
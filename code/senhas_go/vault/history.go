@@ -0,0 +1,108 @@
+// history.go
+// Histórico de senhas das entradas e idade da senha. O histórico fica
+// dentro do payload cifrado da entrada; a lápide não o guarda.
+
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxHistory é o número de senhas anteriores guardadas por entrada (as
+// mais antigas saem primeiro)
+const MaxHistory = 20
+
+// PasswordVersion é um par usuário/senha anterior de uma entrada
+type PasswordVersion struct {
+	Revisao int       `json:"revisao"` // última revisão da entrada com esta senha
+	Usuario string    `json:"usuario"`
+	Senha   string    `json:"senha"`
+	Desde   time.Time `json:"desde"` // quando passou a valer
+	Ate     time.Time `json:"ate"`   // quando foi trocada
+}
+
+// PasswordDate é quando a senha atual passou a valer. Entradas sem
+// SenhaAlterada (anteriores ao histórico) usam a data de criação; cofres
+// v1 não têm data e retornam o instante zero.
+func (e Entry) PasswordDate() time.Time {
+	if !e.SenhaAlterada.IsZero() {
+		return e.SenhaAlterada
+	}
+	return e.Criado
+}
+
+// guarda o par usuário/senha de antiga no histórico de e se ele mudou
+func (e *Entry) keepHistory(antiga Entry, agora time.Time) {
+	e.Historico = antiga.Historico
+	if e.Senha == antiga.Senha && e.Usuario == antiga.Usuario {
+		e.SenhaAlterada = antiga.SenhaAlterada
+		return
+	}
+	e.SenhaAlterada = agora
+	if antiga.Senha == "" && antiga.Usuario == "" {
+		return
+	}
+	e.Historico = append(append([]PasswordVersion{}, e.Historico...), PasswordVersion{
+		Revisao: antiga.Revisao,
+		Usuario: antiga.Usuario,
+		Senha:   antiga.Senha,
+		Desde:   antiga.PasswordDate(),
+		Ate:     agora,
+	})
+	if n := len(e.Historico) - MaxHistory; n > 0 {
+		e.Historico = e.Historico[n:]
+	}
+}
+
+// History retorna as senhas anteriores do local, da mais recente para a
+// mais antiga
+func (v *Vault) History(local string) ([]PasswordVersion, error) {
+	e, err := v.GetEntry(local)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PasswordVersion, len(e.Historico))
+	for i, h := range e.Historico {
+		res[len(res)-1-i] = h
+	}
+	return res, nil
+}
+
+// Restore volta o usuário e a senha do local aos da revisão rev (uma das
+// listadas por History). A senha atual entra no histórico, então a
+// restauração também pode ser desfeita.
+func (v *Vault) Restore(local string, rev int) error {
+	_, e, err := v.getEntry(local)
+	if err != nil {
+		return err
+	}
+	for _, h := range e.Historico {
+		if h.Revisao == rev {
+			e.Usuario, e.Senha = h.Usuario, h.Senha
+			return v.UpdateEntry(local, e)
+		}
+	}
+	return fmt.Errorf("%w: revisão %d de %q no histórico", ErrNotFound, rev, local)
+}
+
+// PasswordsOlderThan lista as entradas cuja senha tem mais de idade, da
+// mais antiga para a mais nova, sem os segredos (como Search). Entradas
+// sem data (cofres v1) entram na lista, já que não há como provar que a
+// senha foi trocada.
+func (v *Vault) PasswordsOlderThan(idade time.Duration) ([]Entry, error) {
+	es, err := v.entries()
+	if err != nil {
+		return nil, err
+	}
+	limite := time.Now().Add(-idade)
+	res := []Entry{}
+	for _, e := range es {
+		if e.PasswordDate().Before(limite) {
+			res = append(res, e.withoutSecrets())
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].PasswordDate().Before(res[j].PasswordDate()) })
+	return res, nil
+}
@@ -0,0 +1,148 @@
+// history_test.go
+
+/*
+Testes do histórico de senhas, de Restore e da consulta por idade da senha
+*/
+package vault_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestHistorico(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("github", "cleuton", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	_, antes := lerCofre(t, path)
+	if err := v.UpdateLocal("github", "cleuton", "s2"); err != nil {
+		t.Fatal(err)
+	}
+	// notas não mexem no histórico nem na data da senha
+	e, _ := v.GetEntry("github")
+	dataS2 := e.PasswordDate()
+	e.Notas = "conta pessoal"
+	if err := v.UpdateEntry("github", e); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.UpdateLocal("github", "outro", "s3"); err != nil {
+		t.Fatal(err)
+	}
+	_, depois := lerCofre(t, path)
+	if antes[0]["id"] != depois[0]["id"] {
+		t.Fatal("UpdateLocal trocou o ID da entrada")
+	}
+
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err := v2.History("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 2 || hs[0].Senha != "s2" || hs[1].Senha != "s1" {
+		t.Fatalf("histórico %+v", hs)
+	}
+	if hs[0].Revisao != 3 || hs[1].Revisao != 1 || !hs[0].Desde.Equal(dataS2) || hs[0].Ate.Before(hs[0].Desde) {
+		t.Fatalf("revisões/datas do histórico %+v", hs)
+	}
+
+	if err := v2.Restore("github", 1); err != nil {
+		t.Fatal(err)
+	}
+	if u, p, _ := v2.GetCredenciais("github"); u != "cleuton" || p != "s1" {
+		t.Fatalf("Restore: %q %q", u, p)
+	}
+	if hs, _ := v2.History("github"); len(hs) != 3 || hs[0].Senha != "s3" {
+		t.Fatalf("Restore não guardou a senha atual: %+v", hs)
+	}
+	if err := v2.Restore("github", 99); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("revisão inexistente: %v", err)
+	}
+
+	// o histórico acompanha a renomeação e some com a remoção
+	e, _ = v2.GetEntry("github")
+	e.Local = "gh"
+	if err := v2.UpdateEntry("github", e); err != nil {
+		t.Fatal(err)
+	}
+	if hs, _ := v2.History("gh"); len(hs) != 3 {
+		t.Fatalf("histórico após renomear: %+v", hs)
+	}
+	if err := v2.DeleteLocal("gh"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddLocal("gh", "u", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	if hs, _ := v2.History("gh"); len(hs) != 0 {
+		t.Fatalf("histórico sobreviveu à remoção: %+v", hs)
+	}
+}
+
+func TestHistoricoLimite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("site", "u", "p0"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= vault.MaxHistory+5; i++ {
+		if err := v.UpdateLocal("site", "u", "p"+strings.Repeat("x", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hs, err := v.History("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != vault.MaxHistory || hs[len(hs)-1].Revisao != 6 {
+		t.Fatalf("histórico com %d itens, mais antigo %+v", len(hs), hs[len(hs)-1])
+	}
+}
+
+func TestPasswordsOlderThan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agora := time.Now().UTC()
+	dia := 24 * time.Hour
+	for local, idade := range map[string]time.Duration{"novo": 0, "velho": 200 * dia, "medio": 100 * dia, "trocado": 300 * dia} {
+		e := vault.Entry{Local: local, Usuario: "u", Senha: "p", Criado: agora.Add(-idade)}
+		if err := v.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.UpdateLocal("trocado", "u", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	es, err := v.PasswordsOlderThan(90 * dia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locais []string
+	for _, e := range es {
+		locais = append(locais, e.Local)
+		if e.Senha != "" {
+			t.Fatalf("%s: senha na consulta de idade", e.Local)
+		}
+	}
+	if strings.Join(locais, ",") != "velho,medio" {
+		t.Fatalf("senhas antigas: %v", locais)
+	}
+}
@@ -0,0 +1,158 @@
+// index.go
+// Índice de busca por local: HMAC do nome sob uma chave derivada da chave
+// de cifra. Permite achar a entrada sem decifrar todas as outras.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// deriva a chave do índice a partir da chave de cifra
+func indexKey(kenc []byte) ([]byte, error) {
+	kidx := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, kenc, nil, []byte("indice")), kidx); err != nil {
+		return nil, err
+	}
+	return kidx, nil
+}
+
+// tag de busca de um local
+func indexTag(kidx []byte, local string) string {
+	h := hmac.New(sha256.New, kidx)
+	h.Write([]byte(local))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// troca a chave de cifra em uso (e a do índice junto). kenc é copiada
+// para uma área nova; a anterior é zerada.
+func (v *Vault) setKey(kenc []byte) error {
+	k, err := newKeyRing(kenc)
+	if err != nil {
+		return err
+	}
+	antigas := v.chaves
+	v.useKeys(k)
+	antigas.free()
+	return nil
+}
+
+// passa a usar as chaves da área k
+func (v *Vault) useKeys(k *keyRing) {
+	v.chaves, v.key, v.idxKey, v.index = k, k.enc(), k.idx(), nil
+}
+
+// monta o mapa tag -> posições. Entradas de cofres antigos, sem índice,
+// são decifradas uma única vez e ganham a tag (gravada no próximo persist).
+func (v *Vault) buildIndex() error {
+	index := make(map[string][]int, len(v.file.Entradas))
+	for i, e := range v.file.Entradas {
+		if e.Indice == "" {
+			plain, p, err := v.openLocal(e)
+			wipe(plain)
+			if err != nil {
+				return err
+			}
+			v.file.Entradas[i].Indice = indexTag(v.idxKey, p.Local)
+		}
+		tag := v.file.Entradas[i].Indice
+		index[tag] = append(index[tag], i)
+	}
+	v.index = index
+	return nil
+}
+
+// posições das entradas vivas do local; decifra só as candidatas, para
+// confirmar o nome (o índice em disco não é confiável por si só)
+func (v *Vault) lookup(local string) ([]int, error) {
+	cand, err := v.candidates(local)
+	if err != nil {
+		return nil, err
+	}
+	res := []int{}
+	for _, i := range cand {
+		plain, err := v.decryptEntry(v.file.Entradas[i])
+		if err != nil {
+			return nil, err
+		}
+		if plain.Local == local && !plain.Removido {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+// registro do local, vivo ou lápide (prefere o vivo)
+func (v *Vault) find(local string) (pos int, e Entry, ok bool, err error) {
+	cand, err := v.candidates(local)
+	if err != nil {
+		return -1, Entry{}, false, err
+	}
+	pos = -1
+	for _, i := range cand {
+		plain, err := v.decryptEntry(v.file.Entradas[i])
+		if err != nil {
+			return -1, Entry{}, false, err
+		}
+		if plain.Local != local {
+			continue
+		}
+		if !plain.Removido {
+			return i, plain, true, nil
+		}
+		if pos < 0 {
+			pos, e = i, plain
+		}
+	}
+	return pos, e, pos >= 0, nil
+}
+
+// posições cuja tag de índice bate com o local
+func (v *Vault) candidates(local string) ([]int, error) {
+	if v.Locked() {
+		return nil, ErrLocked
+	}
+	if v.index == nil {
+		if err := v.buildIndex(); err != nil {
+			return nil, err
+		}
+	}
+	return v.index[indexTag(v.idxKey, local)], nil
+}
+
+// só o que identifica a entrada: o resto do payload (senhas, histórico)
+// não é interpretado, para não virar string
+type payloadLocal struct {
+	Versao   int    `json:"v"`
+	Local    string `json:"local"`
+	Removido bool   `json:"removido"`
+}
+
+// decifra a entrada e lê só o local e a marca de lápide; quem chama zera
+// o texto decifrado
+func (v *Vault) openLocal(e entry) ([]byte, payloadLocal, error) {
+	var p payloadLocal
+	if v.Locked() {
+		return nil, p, ErrLocked
+	}
+	_, plain, err := openEntry(v.key, e)
+	if err != nil {
+		return nil, p, err
+	}
+	if err := json.Unmarshal(plain, &p); err != nil {
+		wipe(plain)
+		return nil, p, corrupted("payload", err)
+	}
+	if p.Versao > payloadVersion {
+		wipe(plain)
+		return nil, p, fmt.Errorf("versão de payload não suportada: %d", p.Versao)
+	}
+	return plain, p, nil
+}
@@ -0,0 +1,151 @@
+// index_test.go
+
+/*
+Testes do índice de busca por local
+*/
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// lê o JSON do cofre como mapas genéricos, para manipular em testes
+func lerCofre(t *testing.T, path string) (map[string]json.RawMessage, []map[string]interface{}) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var entradas []map[string]interface{}
+	if err := json.Unmarshal(doc["entradas"], &entradas); err != nil {
+		t.Fatal(err)
+	}
+	return doc, entradas
+}
+
+// troca um campo do cabeçalho (nil remove o campo)
+func mudarCabecalho(doc map[string]json.RawMessage, campo string, valor interface{}) {
+	var cab map[string]interface{}
+	json.Unmarshal(doc["cabecalho"], &cab)
+	if valor == nil {
+		delete(cab, campo)
+	} else {
+		cab[campo] = valor
+	}
+	doc["cabecalho"], _ = json.Marshal(cab)
+}
+
+// grava o cofre manipulado de volta no disco
+func gravarCofre(t *testing.T, path string, doc map[string]json.RawMessage, entradas []map[string]interface{}) {
+	t.Helper()
+	doc["entradas"], _ = json.Marshal(entradas)
+	raw, _ := json.Marshal(doc)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndiceBusca(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := v.AddLocal(fmt.Sprintf("site%d", i), "user", fmt.Sprintf("pass%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.DeleteLocal("site10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v.GetCredenciais("site10"); err == nil {
+		t.Fatal("local apagado ainda encontrado")
+	}
+	if _, p, err := v.GetCredenciais("site42"); err != nil || p != "pass42" {
+		t.Fatalf("busca após remoção falhou: %q %v", p, err)
+	}
+
+	// o índice é gravado em disco e não revela o nome do local
+	_, entradas := lerCofre(t, path)
+	for _, e := range entradas {
+		idx, _ := e["indice"].(string)
+		if idx == "" {
+			t.Fatal("entrada sem índice")
+		}
+	}
+}
+
+func TestIndiceCofreLegado(t *testing.T) {
+	// cofre criado antes dos índices existirem
+	path := copiarFixture(t, "cofre_v1.json")
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := v2.GetCredenciais("siteB"); err != nil || p != "passB" {
+		t.Fatalf("busca em cofre legado falhou: %q %v", p, err)
+	}
+	// a próxima gravação persiste os índices reconstruídos
+	if err := v2.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	_, entradas := lerCofre(t, path)
+	for _, e := range entradas {
+		if idx, _ := e["indice"].(string); idx == "" {
+			t.Fatal("índice legado não foi persistido")
+		}
+	}
+}
+
+func TestIndiceAdulterado(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.AddLocal("siteA", "userA", "passA")
+	v.AddLocal("siteB", "userB", "passB")
+
+	// troca os índices entre as entradas
+	doc, entradas := lerCofre(t, path)
+	entradas[0]["indice"], entradas[1]["indice"] = entradas[1]["indice"], entradas[0]["indice"]
+	gravarCofre(t, path, doc, entradas)
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("MAC não detectou a troca de índices: %v", err)
+	}
+
+	// sem MAC (cofre antigo) a troca passa, mas a busca confere o nome:
+	// os índices trocados vêm de uma cópia do mesmo cofre já atualizada
+	atualizado := copiarFixture(t, "cofre_v1.json")
+	v1, err := vault.OpenVault(atualizado, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	_, comIndice := lerCofre(t, atualizado)
+	path = copiarFixture(t, "cofre_v1.json")
+	doc, entradas = lerCofre(t, path)
+	entradas[0]["indice"], entradas[1]["indice"] = comIndice[1]["indice"], comIndice[0]["indice"]
+	gravarCofre(t, path, doc, entradas)
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _, err := v2.GetCredenciais("siteA"); err == nil && u != "userA" {
+		t.Fatalf("índice adulterado retornou credenciais de outro local: %s", u)
+	}
+}
@@ -0,0 +1,180 @@
+// integrity.go
+// Integridade do cofre inteiro: HMAC do cabeçalho e da lista de entradas,
+// mais um contador de versão que só cresce, para detectar remoção, troca
+// ou reposição de entradas antigas e o retorno a uma cópia anterior.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// deriva a chave do MAC do cofre a partir da chave de cifra
+func macKey(kenc []byte) ([]byte, error) {
+	k := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, kenc, nil, []byte("integridade")), k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// escreve um campo com o tamanho na frente, para não haver ambiguidade
+// entre campos vizinhos
+func macCampo(h hash.Hash, s string) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+	h.Write(n[:])
+	h.Write([]byte(s))
+}
+
+func macNumero(h hash.Hash, n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	h.Write(b[:])
+}
+
+func macKDF(h hash.Hash, k *KDFParams) {
+	if k == nil {
+		macCampo(h, "")
+		return
+	}
+	macCampo(h, k.Algoritmo)
+	macNumero(h, uint64(k.Iteracoes))
+	macNumero(h, uint64(k.Memoria))
+	macNumero(h, uint64(k.Tempo))
+	macNumero(h, uint64(k.Paralelismo))
+}
+
+func macMembro(h hash.Hash, m member) {
+	for _, s := range []string{m.Nome, m.Publica, m.Efemera, m.IV, m.Envelope, m.Salt, m.IVPrivada, m.Privada} {
+		macCampo(h, s)
+	}
+	macKDF(h, m.KDF)
+}
+
+// HMAC sobre tudo o que está no arquivo, menos o próprio MAC
+func fileMAC(kenc []byte, vf vaultFile) (string, error) {
+	k, err := macKey(kenc)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, k)
+	c := vf.Cabecalho
+	macCampo(h, "SENHAS_MAC_V1")
+	macCampo(h, c.ID)
+	macCampo(h, c.Salt)
+	macNumero(h, uint64(c.Iter))
+	macKDF(h, c.KDF)
+	macCampo(h, c.TagCheck)
+	macNumero(h, c.Versao)
+	// membros e recuperação só entram se existirem (não muda o MAC dos demais)
+	if len(c.Membros) > 0 {
+		macCampo(h, "membros")
+		macNumero(h, uint64(len(c.Membros)))
+		for _, m := range c.Membros {
+			macMembro(h, m)
+		}
+	}
+	if c.Recuperacao != nil {
+		macCampo(h, "recuperacao")
+		macMembro(h, *c.Recuperacao)
+	}
+	if c.Auditoria != nil {
+		macCampo(h, "auditoria")
+		macNumero(h, c.Auditoria.Seq)
+		macCampo(h, c.Auditoria.Hash)
+		macCampo(h, c.Auditoria.IV)
+		macCampo(h, c.Auditoria.Chave)
+	}
+
+	macNumero(h, uint64(len(vf.Entradas)))
+	for _, e := range vf.Entradas {
+		macCampo(h, e.ID)
+		macCampo(h, e.Indice)
+		macCampo(h, e.IV)
+		macCampo(h, e.Cipher)
+	}
+
+	// sincronia em ordem fixa (mapas não têm ordem)
+	peers := make([]string, 0, len(vf.Sincronia))
+	for p := range vf.Sincronia {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	macNumero(h, uint64(len(peers)))
+	for _, p := range peers {
+		ids := make([]string, 0, len(vf.Sincronia[p]))
+		for id := range vf.Sincronia[p] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		macCampo(h, p)
+		macNumero(h, uint64(len(ids)))
+		for _, id := range ids {
+			macCampo(h, id)
+			macNumero(h, uint64(vf.Sincronia[p][id]))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// confere o MAC do arquivo. Sem mac só passam cofres anteriores a ele:
+// tag v1 (legado) e cabeçalho só com salt, iterações e tag. Eles ganham
+// o MAC e a tag v2 no próximo persist.
+func verifyMAC(kenc []byte, vf vaultFile, legado bool) error {
+	if vf.Cabecalho.MAC == "" {
+		if !legado || !vf.preMAC() {
+			return corrupted("cabeçalho", errors.New("mac ausente"))
+		}
+		return nil
+	}
+	esperado, err := fileMAC(kenc, vf)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(esperado), []byte(vf.Cabecalho.MAC)) {
+		return corrupted("cabeçalho", errors.New("mac do cofre não confere: entradas removidas, trocadas ou alteradas"))
+	}
+	return nil
+}
+
+// indica se o arquivo tem só o que existia antes do MAC
+func (vf vaultFile) preMAC() bool {
+	c := vf.Cabecalho
+	return c.Versao == 0 && c.ID == "" && c.KDF == nil && len(c.Membros) == 0 &&
+		c.Recuperacao == nil && c.Auditoria == nil && len(vf.Sincronia) == 0
+}
+
+// Version retorna o contador de versão do cofre, incrementado a cada
+// gravação. Guarde o valor para abrir depois com OpenVaultMinVersion.
+func (v *Vault) Version() uint64 {
+	return v.file.Cabecalho.Versao
+}
+
+// OpenVaultMinVersion abre o cofre como OpenVault e exige que a versão
+// gravada seja pelo menos min (a última que o chamador viu). Uma cópia
+// antiga do arquivo, mesmo íntegra, retorna ErrRollback.
+func OpenVaultMinVersion(path string, senha string, storage Storage, min uint64) (*Vault, error) {
+	v, err := OpenVault(path, senha, storage)
+	if err != nil {
+		return nil, err
+	}
+	if v.Version() < min {
+		return nil, rollback(v.Version(), min)
+	}
+	return v, nil
+}
+
+func rollback(achou, esperado uint64) error {
+	return fmt.Errorf("%w: versão %d, esperada ao menos %d", ErrRollback, achou, esperado)
+}
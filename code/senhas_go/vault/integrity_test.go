@@ -0,0 +1,205 @@
+// integrity_test.go
+
+/*
+Testes do MAC do cofre e da detecção de retorno a versões anteriores
+*/
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestMACCofre(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []string{"siteA", "siteB", "siteC"} {
+		if err := v.AddLocal(l, "user", "pass"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, antigas := lerCofre(t, path)
+	if err := v.UpdateLocal("siteB", "user", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(path)
+
+	casos := []struct {
+		nome   string
+		altera func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{}
+	}{
+		{"entrada removida", func(_ map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			return es[:2]
+		}},
+		{"entradas em outra ordem", func(_ map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			es[0], es[2] = es[2], es[0]
+			return es
+		}},
+		{"entrada antiga reposta", func(_ map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			es[1] = antigas[1]
+			return es
+		}},
+		{"versão alterada", func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			mudarCabecalho(doc, "versao", 1000)
+			return es
+		}},
+		{"mac removido", func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			mudarCabecalho(doc, "mac", nil)
+			return es
+		}},
+		{"mac e versão removidos", func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			mudarCabecalho(doc, "mac", nil)
+			mudarCabecalho(doc, "versao", nil)
+			return es[:2]
+		}},
+		{"cabeçalho convertido para legado", func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			for _, campo := range []string{"mac", "versao", "id", "kdf"} {
+				mudarCabecalho(doc, campo, nil)
+			}
+			mudarCabecalho(doc, "iteracoes", kdfRapido.Iteracoes)
+			return es[:2]
+		}},
+		{"sincronia adulterada", func(doc map[string]json.RawMessage, es []map[string]interface{}) []map[string]interface{} {
+			doc["sincronia"], _ = json.Marshal(map[string]map[string]int{"outro": {"x": 1}})
+			return es
+		}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if err := os.WriteFile(path, original, 0600); err != nil {
+				t.Fatal(err)
+			}
+			doc, es := lerCofre(t, path)
+			gravarCofre(t, path, doc, c.altera(doc, es))
+			if _, err := vault.OpenVault(path, "Senha123", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+				t.Fatalf("esperado ErrCorrupted, achou %v", err)
+			}
+		})
+	}
+
+	// o arquivo intacto continua abrindo
+	os.WriteFile(path, original, 0600)
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersaoRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version() != 1 {
+		t.Fatalf("versão inicial %d", v.Version())
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	antigo, _ := os.ReadFile(path)
+	if err := v.AddLocal("siteB", "userB", "passB"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.DeleteLocal("siteA"); err != nil {
+		t.Fatal(err)
+	}
+	vista := v.Version()
+	if vista != 4 {
+		t.Fatalf("versão após 3 gravações: %d", vista)
+	}
+
+	// uma gravação que falha não consome versão
+	v.Lock()
+	if err := v.AddLocal("siteC", "u", "p"); !errors.Is(err, vault.ErrLocked) {
+		t.Fatal(err)
+	}
+	if v.Version() != vista {
+		t.Fatalf("versão mudou sem gravar: %d", v.Version())
+	}
+
+	aberto, err := vault.OpenVaultMinVersion(path, "Senha123", storageTeste, vista)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alguém recoloca a cópia antiga, que é íntegra
+	if err := os.WriteFile(path, antigo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); err != nil {
+		t.Fatalf("cópia antiga deveria ser íntegra: %v", err)
+	}
+	if _, err := vault.OpenVaultMinVersion(path, "Senha123", storageTeste, vista); !errors.Is(err, vault.ErrRollback) {
+		t.Fatalf("esperado ErrRollback, achou %v", err)
+	}
+	if err := aberto.Reload(); !errors.Is(err, vault.ErrRollback) {
+		t.Fatalf("Reload: esperado ErrRollback, achou %v", err)
+	}
+}
+
+func TestMACCofreLegado(t *testing.T) {
+	path := copiarFixture(t, "cofre_v1.json")
+	v, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version() != 0 {
+		t.Fatalf("cofre legado com versão %d", v.Version())
+	}
+	if err := v.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	doc, es := lerCofre(t, path)
+	gravarCofre(t, path, doc, es[1:])
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("cofre atualizado deveria ter MAC: %v", err)
+	}
+	// depois da primeira gravação, tirar o MAC não o faz passar por legado
+	for _, campo := range []string{"mac", "versao", "id"} {
+		mudarCabecalho(doc, campo, nil)
+	}
+	gravarCofre(t, path, doc, es[1:])
+	if _, err := vault.OpenVault(path, "Senha123", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("cofre atualizado sem MAC: esperado ErrCorrupted, achou %v", err)
+	}
+}
+
+func TestMACCofreLegadoReload(t *testing.T) {
+	path := copiarFixture(t, "cofre_v1.json")
+	v1, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.Reload(); err != nil {
+		t.Fatalf("Reload do cofre legado intocado: %v", err)
+	}
+	// v2 grava o MAC e a tag nova; v1 continua enxergando o cofre
+	if err := v2.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.Reload(); err != nil {
+		t.Fatalf("Reload após a primeira gravação: %v", err)
+	}
+	if err := v1.AddLocal("siteD", "userD", "passD"); err != nil {
+		t.Fatal(err)
+	}
+	v3, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls := locais(t, v3); len(ls) != 4 {
+		t.Fatalf("locais: %v", ls)
+	}
+}
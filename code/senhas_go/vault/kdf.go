@@ -0,0 +1,132 @@
+// kdf.go
+// Derivação da chave-mestre a partir da senha, com algoritmo configurável.
+
+package vault
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Algoritmos de derivação suportados
+const (
+	KDFPBKDF2   = "pbkdf2-sha256"
+	KDFArgon2id = "argon2id"
+)
+
+// KDFParams descreve o algoritmo de derivação e seus parâmetros de custo.
+// Fica gravado no cabeçalho do cofre para que OpenVault saiba como derivar.
+type KDFParams struct {
+	Algoritmo   string `json:"algoritmo"`
+	Iteracoes   int    `json:"iteracoes,omitempty"`   // pbkdf2
+	Memoria     uint32 `json:"memoria,omitempty"`     // argon2id, em KiB
+	Tempo       uint32 `json:"tempo,omitempty"`       // argon2id, passadas
+	Paralelismo uint8  `json:"paralelismo,omitempty"` // argon2id, threads
+}
+
+// DefaultKDF é usado por CreateVault: Argon2id com 64 MiB e 3 passadas
+var DefaultKDF = KDFParams{
+	Algoritmo:   KDFArgon2id,
+	Memoria:     64 * 1024,
+	Tempo:       3,
+	Paralelismo: 4,
+}
+
+// limites para não aceitar cabeçalhos que travem a máquina
+const (
+	maxIteracoes = 100000000
+	maxMemoria   = 4 * 1024 * 1024 // 4 GiB
+	maxTempo     = 100
+)
+
+// valida os parâmetros antes de derivar
+func (p KDFParams) validate() error {
+	switch p.Algoritmo {
+	case KDFPBKDF2:
+		if p.Iteracoes < 1 || p.Iteracoes > maxIteracoes {
+			return fmt.Errorf("kdf %s: iterações inválidas: %d", p.Algoritmo, p.Iteracoes)
+		}
+	case KDFArgon2id:
+		if p.Tempo < 1 || p.Tempo > maxTempo {
+			return fmt.Errorf("kdf %s: tempo inválido: %d", p.Algoritmo, p.Tempo)
+		}
+		if p.Paralelismo < 1 {
+			return fmt.Errorf("kdf %s: paralelismo inválido: %d", p.Algoritmo, p.Paralelismo)
+		}
+		if p.Memoria < 8*uint32(p.Paralelismo) || p.Memoria > maxMemoria {
+			return fmt.Errorf("kdf %s: memória inválida: %d KiB", p.Algoritmo, p.Memoria)
+		}
+	default:
+		return fmt.Errorf("kdf desconhecido: %q", p.Algoritmo)
+	}
+	return nil
+}
+
+// parâmetros para re-cifragem automática: cada custo é o maior entre p e q,
+// para que subir um campo nunca sirva para baixar outro. Nunca troca
+// argon2id por pbkdf2.
+func (p KDFParams) upgrade(q KDFParams) KDFParams {
+	if p.Algoritmo != q.Algoritmo {
+		if p.Algoritmo == KDFPBKDF2 && q.Algoritmo == KDFArgon2id {
+			return q
+		}
+		return p
+	}
+	switch p.Algoritmo {
+	case KDFPBKDF2:
+		p.Iteracoes = max(p.Iteracoes, q.Iteracoes)
+	case KDFArgon2id:
+		p.Memoria = max(p.Memoria, q.Memoria)
+		p.Tempo = max(p.Tempo, q.Tempo)
+		p.Paralelismo = max(p.Paralelismo, q.Paralelismo)
+	}
+	return p
+}
+
+// deriva a chave-mestre de 32 bytes conforme o algoritmo
+func (p KDFParams) masterKey(senha, salt []byte) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	switch p.Algoritmo {
+	case KDFArgon2id:
+		return argon2.IDKey(senha, salt, p.Tempo, p.Memoria, p.Paralelismo, 32), nil
+	default:
+		return pbkdf2.Key(senha, salt, p.Iteracoes, 32, sha256.New), nil
+	}
+}
+
+// Deriva chaves de autenticação e cifra a partir da senha-mestre
+func deriveKeys(senha []byte, salt []byte, kdf KDFParams) (kauth, kenc []byte, err error) {
+	mk, err := kdf.masterKey(senha, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipe(mk)
+	// HKDF-Extract
+	extract := hkdf.New(sha256.New, mk, nil, nil)
+	kauth = make([]byte, 32)
+	if _, err := io.ReadFull(extract, kauth); err != nil {
+		return nil, nil, err
+	}
+	// Expand para kenc
+	expander := hkdf.New(sha256.New, mk, nil, []byte("cifragem"))
+	kenc = make([]byte, 32)
+	if _, err := io.ReadFull(expander, kenc); err != nil {
+		return nil, nil, err
+	}
+	return kauth, kenc, nil
+}
+
+// parâmetros efetivos do cabeçalho; cofres antigos só têm "iteracoes"
+func (h header) kdf() KDFParams {
+	if h.KDF != nil {
+		return *h.KDF
+	}
+	return KDFParams{Algoritmo: KDFPBKDF2, Iteracoes: h.Iter}
+}
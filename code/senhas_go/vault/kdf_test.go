@@ -0,0 +1,132 @@
+// kdf_test.go
+
+/*
+Testes de derivação configurável e re-cifragem do cofre
+*/
+package vault_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// parâmetros baratos para os testes não ficarem lentos
+var (
+	kdfRapido    = vault.KDFParams{Algoritmo: vault.KDFPBKDF2, Iteracoes: 1000}
+	argonRapido  = vault.KDFParams{Algoritmo: vault.KDFArgon2id, Memoria: 1024, Tempo: 1, Paralelismo: 1}
+	argonForte   = vault.KDFParams{Algoritmo: vault.KDFArgon2id, Memoria: 2048, Tempo: 2, Paralelismo: 1}
+	storageTeste = vault.FileStorage{}
+)
+
+func TestRekeyArgon2id(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "antiga", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Rekey("nova", argonRapido); err != nil {
+		t.Fatal(err)
+	}
+	if v.KDF() != argonRapido {
+		t.Fatalf("kdf não atualizado: %+v", v.KDF())
+	}
+
+	if _, err := vault.OpenVault(path, "antiga", storageTeste); err == nil {
+		t.Fatal("senha antiga ainda abre o cofre")
+	}
+	v2, err := vault.OpenVault(path, "nova", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, p, err := v2.GetCredenciais("siteA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "userA" || p != "passA" {
+		t.Fatal("credenciais perdidas no rekey")
+	}
+}
+
+func TestOpenVaultRekeyAutomatico(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, argonRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+
+	v2, err := vault.OpenVaultRekey(path, "Senha123", storageTeste, argonForte)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.KDF() != argonForte {
+		t.Fatalf("cofre não foi re-cifrado: %+v", v2.KDF())
+	}
+
+	// parâmetros mais fracos não devem rebaixar o cofre
+	v3, err := vault.OpenVaultRekey(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v3.KDF() != argonForte {
+		t.Fatalf("cofre foi rebaixado: %+v", v3.KDF())
+	}
+	if _, p, err := v3.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatal("credenciais perdidas no rekey automático")
+	}
+
+	// subir a memória não pode baixar tempo e paralelismo
+	misto := vault.KDFParams{Algoritmo: vault.KDFArgon2id, Memoria: 4096, Tempo: 1, Paralelismo: 1}
+	v4, err := vault.OpenVaultRekey(path, "Senha123", storageTeste, misto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := vault.KDFParams{Algoritmo: vault.KDFArgon2id, Memoria: 4096, Tempo: 2, Paralelismo: 1}
+	if v4.KDF() != esperado {
+		t.Fatalf("rekey misto: %+v", v4.KDF())
+	}
+}
+
+func TestCabecalhoLegado(t *testing.T) {
+	// cabeçalho no formato antigo: só "iteracoes", sem "kdf"
+	path := copiarFixture(t, "cofre_v1.json")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte(`"kdf"`)) {
+		t.Fatal("cabeçalho legado contém kdf")
+	}
+
+	v2, err := vault.OpenVault(path, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legado := (vault.KDFParams{Algoritmo: vault.KDFPBKDF2, Iteracoes: 200000}); v2.KDF() != legado {
+		t.Fatalf("kdf legado interpretado errado: %+v", v2.KDF())
+	}
+	if _, p, err := v2.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatal("cofre legado não abriu as entradas")
+	}
+}
+
+func TestKDFInvalido(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	ruim := vault.KDFParams{Algoritmo: vault.KDFArgon2id, Memoria: 1, Tempo: 1, Paralelismo: 4}
+	if _, err := vault.CreateVaultWithKDF(path, "x", storageTeste, ruim); err == nil {
+		t.Fatal("aceitou parâmetros argon2id inválidos")
+	}
+	if _, err := vault.CreateVaultWithKDF(path, "x", storageTeste, vault.KDFParams{Algoritmo: "md5"}); err == nil {
+		t.Fatal("aceitou algoritmo desconhecido")
+	}
+}
@@ -0,0 +1,216 @@
+// keepass.go
+// Exportação/importação no XML do KeePass 2.x (Arquivo > Exportar > KeePass XML).
+
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type kpFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    kpMeta   `xml:"Meta"`
+	Root    kpRoot   `xml:"Root"`
+}
+
+type kpMeta struct {
+	Generator string `xml:"Generator"`
+}
+
+type kpRoot struct {
+	Groups []kpGroup `xml:"Group"`
+}
+
+type kpGroup struct {
+	UUID    string    `xml:"UUID,omitempty"`
+	Name    string    `xml:"Name"`
+	Entries []kpEntry `xml:"Entry"`
+	Groups  []kpGroup `xml:"Group"`
+}
+
+type kpEntry struct {
+	UUID    string     `xml:"UUID"`
+	Tags    string     `xml:"Tags,omitempty"`
+	Times   kpTimes    `xml:"Times"`
+	Strings []kpString `xml:"String"`
+}
+
+type kpTimes struct {
+	CreationTime         string `xml:"CreationTime,omitempty"`
+	LastModificationTime string `xml:"LastModificationTime,omitempty"`
+}
+
+type kpString struct {
+	Key   string  `xml:"Key"`
+	Value kpValue `xml:"Value"`
+}
+
+type kpValue struct {
+	Text            string `xml:",chardata"`
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+	Protected       string `xml:"Protected,attr,omitempty"` // só no XML interno do KDBX
+}
+
+// chaves padrão do KeePass; URLs extras seguem a convenção KP2A_URL_N
+const (
+	kpTitle    = "Title"
+	kpUserName = "UserName"
+	kpPassword = "Password"
+	kpURL      = "URL"
+	kpNotes    = "Notes"
+	kpOTP      = "otp" // KeePassXC
+	kpOTPSeed  = "TimeOtp-Secret-Base32"
+	kpURLExtra = "KP2A_URL"
+)
+
+func kpTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func exportKeePass(w io.Writer, es []Entry) error {
+	g := kpGroup{Name: "senhas_go"}
+	for _, e := range es {
+		uuid := make([]byte, 16)
+		if _, err := rand.Read(uuid); err != nil {
+			return err
+		}
+		ke := kpEntry{
+			UUID:  base64.StdEncoding.EncodeToString(uuid),
+			Tags:  strings.Join(e.Tags, ";"),
+			Times: kpTimes{CreationTime: kpTime(e.Criado), LastModificationTime: kpTime(e.Alterado)},
+		}
+		add := func(k, v string, protegido bool) {
+			s := kpString{Key: k, Value: kpValue{Text: v}}
+			if protegido {
+				s.Value.ProtectInMemory = "True"
+			}
+			ke.Strings = append(ke.Strings, s)
+		}
+		add(kpTitle, e.Local, false)
+		add(kpUserName, e.Usuario, false)
+		add(kpPassword, e.Senha, true)
+		add(kpURL, firstURL(e), false)
+		add(kpNotes, e.Notas, false)
+		if e.TOTP != "" {
+			add(kpOTP, e.TOTP, true)
+		}
+		for i := 1; i < len(e.URLs); i++ {
+			k := kpURLExtra
+			if i > 1 {
+				k += "_" + strconv.Itoa(i-1)
+			}
+			add(k, e.URLs[i], false)
+		}
+		nomes := make([]string, 0, len(e.Campos))
+		for k := range e.Campos {
+			nomes = append(nomes, k)
+		}
+		sort.Strings(nomes)
+		for _, k := range nomes {
+			add(k, e.Campos[k], false)
+		}
+		g.Entries = append(g.Entries, ke)
+	}
+	f := kpFile{Meta: kpMeta{Generator: "senhas_go"}, Root: kpRoot{Groups: []kpGroup{g}}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func importKeePass(r io.Reader) ([]Entry, error) {
+	var f kpFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	es := []Entry{}
+	for _, g := range f.Root.Groups {
+		// o grupo raiz não vira tag
+		if err := importKeePassGroup(g, nil, &es); err != nil {
+			return nil, err
+		}
+	}
+	return es, nil
+}
+
+// percorre os grupos; o nome dos subgrupos vira tag das entradas
+func importKeePassGroup(g kpGroup, tags []string, es *[]Entry) error {
+	if g.Name == "Recycle Bin" || g.Name == "Lixeira" {
+		return nil
+	}
+	for _, ke := range g.Entries {
+		e := Entry{}
+		extras := map[string]string{}
+		for _, s := range ke.Strings {
+			if s.Value.Protected == "True" {
+				return errors.New("valor protegido do KDBX não suportado; use a exportação KeePass XML")
+			}
+			v := s.Value.Text
+			switch {
+			case s.Key == kpTitle:
+				e.Local = v
+			case s.Key == kpUserName:
+				e.Usuario = v
+			case s.Key == kpPassword:
+				e.Senha = v
+			case s.Key == kpURL:
+				if v != "" {
+					e.URLs = append([]string{v}, e.URLs...)
+				}
+			case s.Key == kpNotes:
+				e.Notas = v
+			case s.Key == kpOTP || s.Key == kpOTPSeed:
+				e.TOTP = v
+			case strings.HasPrefix(s.Key, kpURLExtra):
+				extras[s.Key] = v
+			default:
+				if e.Campos == nil {
+					e.Campos = map[string]string{}
+				}
+				e.Campos[s.Key] = v
+			}
+		}
+		// KP2A_URL, KP2A_URL_1, KP2A_URL_2...
+		for i := 0; ; i++ {
+			k := kpURLExtra
+			if i > 0 {
+				k += "_" + strconv.Itoa(i)
+			}
+			v, ok := extras[k]
+			if !ok {
+				break
+			}
+			e.URLs = append(e.URLs, v)
+		}
+		e.Tags = append(append([]string{}, tags...), splitTags(ke.Tags)...)
+		if len(e.Tags) == 0 {
+			e.Tags = nil
+		}
+		e.Criado, _ = time.Parse(time.RFC3339, ke.Times.CreationTime)
+		e.Alterado, _ = time.Parse(time.RFC3339, ke.Times.LastModificationTime)
+		*es = append(*es, e)
+	}
+	for _, sub := range g.Groups {
+		if err := importKeePassGroup(sub, append(append([]string{}, tags...), sub.Name), es); err != nil {
+			return err
+		}
+	}
+	return nil
+}
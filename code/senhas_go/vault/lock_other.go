@@ -0,0 +1,8 @@
+//go:build !unix
+
+package vault
+
+// sem flock nesta plataforma: a gravação continua atômica, mas sem trava
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
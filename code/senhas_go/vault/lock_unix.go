@@ -0,0 +1,25 @@
+//go:build unix
+
+package vault
+
+import (
+	"os"
+	"syscall"
+)
+
+// trava exclusiva (flock) em path.lock; o arquivo do cofre em si é
+// substituído a cada gravação, então não serve para travar
+func lockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,563 @@
+// members.go
+// Cofres compartilhados: uma chave de dados aleatória cifra as entradas e
+// vai embrulhada (X25519 + AES-GCM) para cada membro. Membros por senha
+// guardam no cofre a própria chave privada X25519, cifrada com a senha;
+// os demais trazem a chave privada de fora. Como todo membro tem chave
+// pública, a chave de dados pode ser trocada sem as senhas dos outros.
+
+package vault
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// membro de um cofre compartilhado, como fica no cabeçalho
+type member struct {
+	Nome     string `json:"nome"`
+	Publica  string `json:"publica"`  // chave pública X25519 do membro
+	Efemera  string `json:"efemera"`  // chave pública efêmera do envelope
+	IV       string `json:"iv"`       // do envelope
+	Envelope string `json:"envelope"` // chave de dados cifrada para o membro
+	// só membros por senha: a chave privada cifrada com a senha
+	Salt      string     `json:"salt,omitempty"`
+	KDF       *KDFParams `json:"kdf,omitempty"`
+	IVPrivada string     `json:"iv_privada,omitempty"`
+	Privada   string     `json:"privada,omitempty"`
+}
+
+// Member descreve um membro de cofre compartilhado
+type Member struct {
+	Nome  string `json:"nome"`
+	Senha bool   `json:"senha"` // abre com senha; senão, com chave X25519 própria
+}
+
+var errNotShared = errors.New("cofre não é compartilhado (use Share)")
+
+// GenerateMemberKey gera um par de chaves X25519 para um membro que abre
+// o cofre com chave (OpenVaultWithKey). Guarde priv.Bytes() em lugar
+// seguro e passe priv.PublicKey() para AddMemberKey.
+func GenerateMemberKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+func (vf vaultFile) shared() bool {
+	return len(vf.Cabecalho.Membros) > 0
+}
+
+// Shared indica se o cofre é compartilhado
+func (v *Vault) Shared() bool {
+	return v.file.shared()
+}
+
+// Members lista os membros do cofre compartilhado
+func (v *Vault) Members() []Member {
+	res := []Member{}
+	for _, m := range v.file.Cabecalho.Membros {
+		res = append(res, Member{Nome: m.Nome, Senha: m.Privada != ""})
+	}
+	return res
+}
+
+// CurrentMember retorna o membro que abriu o cofre ("" se não é compartilhado)
+func (v *Vault) CurrentMember() string {
+	return v.membro
+}
+
+// CreateSharedVault cria um cofre compartilhado com um primeiro membro por senha
+func CreateSharedVault(path, nome, senha string, storage Storage, kdf KDFParams) (*Vault, error) {
+	if nome == "" {
+		return nil, errors.New("nome do membro vazio")
+	}
+	if kdf.Algoritmo == "" {
+		kdf = DefaultKDF
+	}
+	id, err := newVaultID()
+	if err != nil {
+		return nil, err
+	}
+	dk, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(dk)
+	m, err := newPasswordMember(id, nome, senha, kdf, dk)
+	if err != nil {
+		return nil, err
+	}
+	v, err := newVault(path, storage, header{ID: id, TagCheck: keyCheck(dk), Membros: []member{m}}, dk)
+	if err != nil {
+		return nil, err
+	}
+	v.membro = nome
+	return v, nil
+}
+
+// Share converte um cofre de senha única em compartilhado: gera uma chave
+// de dados nova, re-cifra as entradas e cria o primeiro membro, por senha.
+// A senha-mestre antiga deixa de abrir o cofre.
+func (v *Vault) Share(nome, senha string, kdf KDFParams) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if v.Shared() {
+		return errors.New("cofre já é compartilhado")
+	}
+	if nome == "" {
+		return errors.New("nome do membro vazio")
+	}
+	if kdf.Algoritmo == "" {
+		kdf = DefaultKDF
+	}
+	dk, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(dk)
+	m, err := newPasswordMember(v.file.Cabecalho.ID, nome, senha, kdf, dk)
+	if err != nil {
+		return err
+	}
+	cab := header{
+		ID:       v.file.Cabecalho.ID,
+		TagCheck: keyCheck(dk),
+		Membros:  []member{m},
+		Versao:   v.file.Cabecalho.Versao,
+	}
+	if err := v.replaceKey(cab, dk); err != nil {
+		return err
+	}
+	v.membro = nome
+	return nil
+}
+
+// AddMember inclui um membro que abre o cofre com a própria senha
+func (v *Vault) AddMember(nome, senha string, kdf KDFParams) error {
+	if err := v.checkNewMember(nome); err != nil {
+		return err
+	}
+	if kdf.Algoritmo == "" {
+		kdf = DefaultKDF
+	}
+	m, err := newPasswordMember(v.file.Cabecalho.ID, nome, senha, kdf, v.key)
+	if err != nil {
+		return err
+	}
+	return v.appendMember(m)
+}
+
+// AddMemberKey inclui um membro que abre o cofre com a chave privada
+// correspondente a pub (ver GenerateMemberKey)
+func (v *Vault) AddMemberKey(nome string, pub *ecdh.PublicKey) error {
+	if err := v.checkNewMember(nome); err != nil {
+		return err
+	}
+	if pub == nil || pub.Curve() != ecdh.X25519() {
+		return errors.New("chave pública do membro deve ser X25519")
+	}
+	m := member{Nome: nome, Publica: base64.StdEncoding.EncodeToString(pub.Bytes())}
+	if err := m.wrap(v.file.Cabecalho.ID, v.key); err != nil {
+		return err
+	}
+	return v.appendMember(m)
+}
+
+// RemoveMember tira o membro e gira a chave de dados, para que o
+// envelope antigo dele não sirva mais para as gravações seguintes
+func (v *Vault) RemoveMember(nome string) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if !v.Shared() {
+		return errNotShared
+	}
+	restantes := []member{}
+	for _, m := range v.file.Cabecalho.Membros {
+		if m.Nome != nome {
+			restantes = append(restantes, m)
+		}
+	}
+	if len(restantes) == len(v.file.Cabecalho.Membros) {
+		return fmt.Errorf("%w: membro %q", ErrNotFound, nome)
+	}
+	if len(restantes) == 0 {
+		return errors.New("o cofre precisa de ao menos um membro")
+	}
+	if err := v.rotate(restantes); err != nil {
+		return err
+	}
+	if v.membro == nome {
+		v.membro = ""
+	}
+	return nil
+}
+
+// RotateKey gera uma chave de dados nova, re-cifra todas as entradas e
+// embrulha a chave para cada membro
+func (v *Vault) RotateKey() error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if !v.Shared() {
+		return errNotShared
+	}
+	return v.rotate(v.file.Cabecalho.Membros)
+}
+
+// OpenVaultMember abre o cofre compartilhado como o membro nome, com a senha dele
+func OpenVaultMember(path, nome, senha string, storage Storage) (*Vault, error) {
+	return openAs(path, nome, storage, func(m member, id string) (*ecdh.PrivateKey, error) {
+		if m.Privada == "" {
+			return nil, fmt.Errorf("membro %q abre com chave, não com senha", nome)
+		}
+		return m.openPrivate(senha, id)
+	})
+}
+
+// OpenVaultWithKey abre o cofre compartilhado como o membro nome, com a
+// chave privada X25519 dele
+func OpenVaultWithKey(path, nome string, priv *ecdh.PrivateKey, storage Storage) (*Vault, error) {
+	return openAs(path, nome, storage, func(member, string) (*ecdh.PrivateKey, error) {
+		return priv, nil
+	})
+}
+
+func openAs(path, nome string, storage Storage, chave func(member, string) (*ecdh.PrivateKey, error)) (*Vault, error) {
+	vf, version, err := loadFile(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	if !vf.shared() {
+		return nil, errNotShared
+	}
+	achou := false
+	for _, m := range vf.Cabecalho.Membros {
+		achou = achou || m.Nome == nome
+	}
+	if !achou {
+		return nil, fmt.Errorf("%w: membro %q", ErrNotFound, nome)
+	}
+	return openShared(vf, storage, path, version, func(m member) (*ecdh.PrivateKey, error) {
+		if m.Nome != nome {
+			return nil, ErrWrongPassword
+		}
+		return chave(m, vf.Cabecalho.ID)
+	})
+}
+
+// tenta os membros em ordem; chave dá a chave privada de cada um ou
+// ErrWrongPassword para passar ao próximo. Um registro de membro
+// corrompido é pulado: só se nenhum outro abrir o cofre o erro dele volta.
+func openShared(vf vaultFile, storage Storage, path, version string, chave func(member) (*ecdh.PrivateKey, error)) (*Vault, error) {
+	tag, err := base64.StdEncoding.DecodeString(vf.Cabecalho.TagCheck)
+	if err != nil || len(tag) != sha256.Size {
+		return nil, corrupted("tag_check", fmt.Errorf("tag inválida: %v", err))
+	}
+	var falha error
+	for _, m := range vf.Cabecalho.Membros {
+		dk, err := m.dataKey(vf, chave)
+		if err != nil {
+			if !errors.Is(err, ErrWrongPassword) && falha == nil {
+				falha = err
+			}
+			continue
+		}
+		defer wipe(dk)
+		v, err := openedVault(vf, dk, storage, path, version, false)
+		if err != nil {
+			return nil, err
+		}
+		v.membro = m.Nome
+		return v, nil
+	}
+	if falha != nil {
+		return nil, falha
+	}
+	return nil, ErrWrongPassword
+}
+
+// chave de dados aberta pelo membro, conferida com o cabeçalho
+func (m member) dataKey(vf vaultFile, chave func(member) (*ecdh.PrivateKey, error)) ([]byte, error) {
+	priv, err := chave(m)
+	if err != nil {
+		return nil, err
+	}
+	dk, err := m.unwrap(vf.Cabecalho.ID, priv)
+	if err != nil {
+		return nil, err
+	}
+	if keyCheck(dk) != vf.Cabecalho.TagCheck {
+		wipe(dk)
+		return nil, corrupted("membro "+m.Nome, errors.New("chave de dados não confere com o cabeçalho"))
+	}
+	return dk, nil
+}
+
+// ------------------ internos ------------------
+
+func (v *Vault) checkNewMember(nome string) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if !v.Shared() {
+		return errNotShared
+	}
+	if nome == "" {
+		return errors.New("nome do membro vazio")
+	}
+	for _, m := range v.file.Cabecalho.Membros {
+		if m.Nome == nome {
+			return fmt.Errorf("%w: membro %q", ErrDuplicate, nome)
+		}
+	}
+	return nil
+}
+
+func (v *Vault) appendMember(m member) error {
+	antes := v.file.Cabecalho.Membros
+	v.file.Cabecalho.Membros = append(append([]member{}, antes...), m)
+	if err := v.persist(); err != nil {
+		v.file.Cabecalho.Membros = antes
+		return err
+	}
+	return nil
+}
+
+// chave de dados nova para os membros dados
+func (v *Vault) rotate(membros []member) error {
+	dk, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer wipe(dk)
+	cab := v.file.Cabecalho
+	cab.TagCheck = keyCheck(dk)
+	cab.Membros = make([]member, len(membros))
+	for i, m := range membros {
+		if err := m.wrap(cab.ID, dk); err != nil {
+			return err
+		}
+		cab.Membros[i] = m
+	}
+	return v.replaceKey(cab, dk)
+}
+
+// Rekey de cofre compartilhado: o membro atual ganha senha nova
+func (v *Vault) rekeyMember(novaSenha string, kdf KDFParams) error {
+	if v.membro == "" {
+		return errors.New("cofre compartilhado aberto sem membro: use ResetMemberPassword")
+	}
+	return v.ResetMemberPassword(v.membro, novaSenha, kdf)
+}
+
+// ResetMemberPassword define a senha do membro nome (que passa a ser
+// membro por senha, com par de chaves novo) e gira a chave de dados.
+// Serve para quem abriu o cofre com a chave de recuperação. Parâmetros
+// zerados mantêm os do membro (ou DefaultKDF).
+func (v *Vault) ResetMemberPassword(nome, novaSenha string, kdf KDFParams) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if !v.Shared() {
+		return errNotShared
+	}
+	membros := append([]member{}, v.file.Cabecalho.Membros...)
+	for i, m := range membros {
+		if m.Nome != nome {
+			continue
+		}
+		if kdf.Algoritmo == "" && m.KDF != nil {
+			kdf = *m.KDF
+		} else if kdf.Algoritmo == "" {
+			kdf = DefaultKDF
+		}
+		novo, err := newPasswordMember(v.file.Cabecalho.ID, m.Nome, novaSenha, kdf, v.key)
+		if err != nil {
+			return err
+		}
+		membros[i] = novo
+		return v.rotate(membros)
+	}
+	return fmt.Errorf("%w: membro %q", ErrNotFound, nome)
+}
+
+func newDataKey() ([]byte, error) {
+	dk := make([]byte, 32)
+	if _, err := rand.Read(dk); err != nil {
+		return nil, err
+	}
+	return dk, nil
+}
+
+// tag que identifica a chave de dados (fica em tag_check)
+func keyCheck(dk []byte) string {
+	h := hmac.New(sha256.New, dk)
+	h.Write([]byte("CHECK_DATA_KEY_V1"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// dados adicionais dos envelopes: prendem o envelope ao cofre e ao membro
+func memberAAD(vaultID, nome string) []byte {
+	return []byte(vaultID + "\x00" + nome)
+}
+
+// membro por senha: par de chaves novo, privada cifrada com a senha
+func newPasswordMember(vaultID, nome, senha string, kdf KDFParams, dk []byte) (member, error) {
+	priv, err := GenerateMemberKey()
+	if err != nil {
+		return member{}, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return member{}, err
+	}
+	k, err := passwordWrapKey(senha, salt, kdf)
+	if err != nil {
+		return member{}, err
+	}
+	iv, ct, err := gcmSeal(k, priv.Bytes(), memberAAD(vaultID, nome))
+	if err != nil {
+		return member{}, err
+	}
+	m := member{
+		Nome:      nome,
+		Publica:   base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		KDF:       &kdf,
+		IVPrivada: base64.StdEncoding.EncodeToString(iv),
+		Privada:   base64.StdEncoding.EncodeToString(ct),
+	}
+	return m, m.wrap(vaultID, dk)
+}
+
+func passwordWrapKey(senha string, salt []byte, kdf KDFParams) ([]byte, error) {
+	mk, err := kdf.masterKey([]byte(senha), salt)
+	if err != nil {
+		return nil, err
+	}
+	return hkdfKey(mk, nil, "membro-senha")
+}
+
+func hkdfKey(secret, salt []byte, info string) ([]byte, error) {
+	k := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// decifra a chave privada do membro com a senha; senha errada não autentica
+func (m member) openPrivate(senha, vaultID string) (*ecdh.PrivateKey, error) {
+	salt, err := base64.StdEncoding.DecodeString(m.Salt)
+	if err != nil {
+		return nil, corrupted("salt do membro "+m.Nome, err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(m.IVPrivada)
+	if err != nil {
+		return nil, corrupted("iv do membro "+m.Nome, err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(m.Privada)
+	if err != nil {
+		return nil, corrupted("chave do membro "+m.Nome, err)
+	}
+	if m.KDF == nil || len(salt) == 0 {
+		return nil, corrupted("membro "+m.Nome, errors.New("kdf ou salt ausente"))
+	}
+	k, err := passwordWrapKey(senha, salt, *m.KDF)
+	if err != nil {
+		return nil, corrupted("kdf do membro "+m.Nome, err)
+	}
+	raw, err := gcmOpen(k, iv, ct, memberAAD(vaultID, m.Nome))
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, corrupted("chave do membro "+m.Nome, err)
+	}
+	return priv, nil
+}
+
+// chave do envelope: X25519 entre a efêmera e a do membro, via HKDF
+func envelopeKey(segredo, efemera, publica []byte) ([]byte, error) {
+	return hkdfKey(segredo, append(append([]byte{}, efemera...), publica...), "membro-envelope")
+}
+
+// embrulha a chave de dados para a chave pública do membro
+func (m *member) wrap(vaultID string, dk []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(m.Publica)
+	if err != nil {
+		return corrupted("chave pública do membro "+m.Nome, err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return corrupted("chave pública do membro "+m.Nome, err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	segredo, err := eph.ECDH(pub)
+	if err != nil {
+		return err
+	}
+	k, err := envelopeKey(segredo, eph.PublicKey().Bytes(), raw)
+	if err != nil {
+		return err
+	}
+	iv, ct, err := gcmSeal(k, dk, memberAAD(vaultID, m.Nome))
+	if err != nil {
+		return err
+	}
+	m.Efemera = base64.StdEncoding.EncodeToString(eph.PublicKey().Bytes())
+	m.IV = base64.StdEncoding.EncodeToString(iv)
+	m.Envelope = base64.StdEncoding.EncodeToString(ct)
+	return nil
+}
+
+// abre o envelope com a chave privada do membro
+func (m member) unwrap(vaultID string, priv *ecdh.PrivateKey) ([]byte, error) {
+	if priv == nil || priv.Curve() != ecdh.X25519() {
+		return nil, errors.New("chave privada do membro deve ser X25519")
+	}
+	if m.Publica != base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()) {
+		return nil, fmt.Errorf("%w: chave não é a do membro %q", ErrWrongPassword, m.Nome)
+	}
+	efemera, err := base64.StdEncoding.DecodeString(m.Efemera)
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(m.IV)
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(m.Envelope)
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	eph, err := ecdh.X25519().NewPublicKey(efemera)
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	segredo, err := priv.ECDH(eph)
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	k, err := envelopeKey(segredo, efemera, priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	dk, err := gcmOpen(k, iv, ct, memberAAD(vaultID, m.Nome))
+	if err != nil {
+		return nil, corrupted("envelope do membro "+m.Nome, err)
+	}
+	return dk, nil
+}
@@ -0,0 +1,203 @@
+// members_test.go
+
+/*
+Testes de cofres compartilhados: membros por senha e por chave X25519,
+remoção com troca da chave de dados e conversão de cofre de senha única
+*/
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestCofreCompartilhado(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "equipe.json")
+	v, err := vault.CreateSharedVault(path, "ana", "senha-ana", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("github", "equipe", "s3nh4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "senha-bia", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	chaveCaio, err := vault.GenerateMemberKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMemberKey("caio", chaveCaio.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "outra", kdfRapido); !errors.Is(err, vault.ErrDuplicate) {
+		t.Fatalf("membro repetido: %v", err)
+	}
+
+	// cada um abre com a própria credencial
+	abrir := map[string]func() (*vault.Vault, error){
+		"ana": func() (*vault.Vault, error) { return vault.OpenVault(path, "senha-ana", storageTeste) },
+		"bia": func() (*vault.Vault, error) { return vault.OpenVaultMember(path, "bia", "senha-bia", storageTeste) },
+		"caio": func() (*vault.Vault, error) {
+			return vault.OpenVaultWithKey(path, "caio", chaveCaio, storageTeste)
+		},
+	}
+	for nome, f := range abrir {
+		m, err := f()
+		if err != nil {
+			t.Fatalf("%s: %v", nome, err)
+		}
+		if m.CurrentMember() != nome {
+			t.Fatalf("membro atual %q, esperado %q", m.CurrentMember(), nome)
+		}
+		if _, p, err := m.GetCredenciais("github"); err != nil || p != "s3nh4" {
+			t.Fatalf("%s: %q %v", nome, p, err)
+		}
+	}
+
+	if _, err := vault.OpenVault(path, "errada", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha errada: %v", err)
+	}
+	if _, err := vault.OpenVaultMember(path, "bia", "senha-ana", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha de outro membro: %v", err)
+	}
+	outra, _ := vault.GenerateMemberKey()
+	if _, err := vault.OpenVaultWithKey(path, "caio", outra, storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("chave errada: %v", err)
+	}
+	if _, err := vault.OpenVaultMember(path, "davi", "x", storageTeste); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("membro inexistente: %v", err)
+	}
+
+	// bia mantém o cofre aberto enquanto ana a remove
+	daBia, err := vault.OpenVaultMember(path, "bia", "senha-bia", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, antes := lerCofre(t, path)
+	if err := v.RemoveMember("bia"); err != nil {
+		t.Fatal(err)
+	}
+	depoisDoc, depois := lerCofre(t, path)
+	if string(doc["cabecalho"]) == string(depoisDoc["cabecalho"]) || antes[0]["cipher"] == depois[0]["cipher"] {
+		t.Fatal("remoção não trocou a chave de dados")
+	}
+	if _, err := vault.OpenVault(path, "senha-bia", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("membro removido ainda abre: %v", err)
+	}
+	if err := daBia.Reload(); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("Reload com chave antiga: %v", err)
+	}
+	if _, err := vault.OpenVaultWithKey(path, "caio", chaveCaio, storageTeste); err != nil {
+		t.Fatalf("caio após a remoção: %v", err)
+	}
+	var nomes []string
+	for _, m := range v.Members() {
+		nomes = append(nomes, m.Nome)
+	}
+	if len(nomes) != 2 || nomes[0] != "ana" || nomes[1] != "caio" {
+		t.Fatalf("membros %v", nomes)
+	}
+
+	// troca de senha de ana não afeta caio
+	if err := v.Rekey("nova-ana", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVault(path, "senha-ana", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha antiga ainda abre: %v", err)
+	}
+	if _, err := vault.OpenVault(path, "nova-ana", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithKey(path, "caio", chaveCaio, storageTeste); err != nil {
+		t.Fatalf("caio após Rekey: %v", err)
+	}
+}
+
+func TestShare(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Mestra", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "x", kdfRapido); err == nil {
+		t.Fatal("AddMember em cofre de senha única")
+	}
+	if err := v.Share("ana", "senha-ana", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Shared() {
+		t.Fatal("cofre não ficou compartilhado")
+	}
+	if _, err := vault.OpenVault(path, "Mestra", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha-mestre antiga ainda abre: %v", err)
+	}
+	v2, err := vault.OpenVaultMember(path, "ana", "senha-ana", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := v2.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("entrada perdida na conversão: %q %v", p, err)
+	}
+	if v2.KDF() != kdfRapido {
+		t.Fatalf("kdf do membro: %+v", v2.KDF())
+	}
+
+	// tirar um membro do arquivo não passa pelo MAC
+	if err := v2.AddMember("bia", "senha-bia", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	doc, es := lerCofre(t, path)
+	var cab map[string]interface{}
+	json.Unmarshal(doc["cabecalho"], &cab)
+	cab["membros"] = cab["membros"].([]interface{})[:1]
+	doc["cabecalho"], _ = json.Marshal(cab)
+	gravarCofre(t, path, doc, es)
+	if _, err := vault.OpenVault(path, "senha-ana", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("membro removido à mão: %v", err)
+	}
+}
+
+func TestMembroCorrompido(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "equipe.json")
+	v, err := vault.CreateSharedVault(path, "ana", "senha-ana", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("github", "equipe", "s3nh4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "senha-bia", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	chaveCaio, _ := vault.GenerateMemberKey()
+	if err := v.AddMemberKey("caio", chaveCaio.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	// o registro de ana, o primeiro, não abre com senha nenhuma; os outros
+	// seguem abrindo
+	if err := vault.CorruptMember(v, "ana"); err != nil {
+		t.Fatal(err)
+	}
+	bia, err := vault.OpenVault(path, "senha-bia", storageTeste)
+	if err != nil {
+		t.Fatalf("bia depois de um membro corrompido: %v", err)
+	}
+	if bia.CurrentMember() != "bia" {
+		t.Fatalf("membro atual %q", bia.CurrentMember())
+	}
+	if _, err := vault.OpenVaultWithKey(path, "caio", chaveCaio, storageTeste); err != nil {
+		t.Fatalf("caio depois de um membro corrompido: %v", err)
+	}
+	// nenhum membro abre: não dá para saber se a senha era a de ana
+	if _, err := vault.OpenVault(path, "senha-ana", storageTeste); !errors.Is(err, vault.ErrCorrupted) {
+		t.Fatalf("membro corrompido: esperado ErrCorrupted, achou %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package vault
+
+import "syscall"
+
+// MADV_DONTDUMP: as páginas das chaves ficam fora de core dumps
+const madvDontDump = 0x10
+
+// área fora do heap (mmap anônimo), travada na RAM para não ir para o
+// swap e excluída de core dumps
+func lockedAlloc(n int) ([]byte, error) {
+	b, err := syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Mlock(b); err != nil {
+		syscall.Munmap(b)
+		return nil, err
+	}
+	// sem suporte (kernel antigo) a área continua travada; não é fatal
+	syscall.Madvise(b, madvDontDump)
+	return b, nil
+}
+
+// devolve uma área de lockedAlloc, que já deve estar zerada
+func lockedFree(b []byte) {
+	syscall.Munlock(b)
+	syscall.Munmap(b)
+}
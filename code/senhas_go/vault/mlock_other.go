@@ -0,0 +1,12 @@
+//go:build !linux
+
+package vault
+
+import "errors"
+
+// mlock das chaves só existe no Linux
+func lockedAlloc(n int) ([]byte, error) {
+	return nil, errors.New("MlockKeys só é suportado no Linux")
+}
+
+func lockedFree(b []byte) {}
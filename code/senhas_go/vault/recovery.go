@@ -0,0 +1,204 @@
+// recovery.go
+// Troca de senha e chave de recuperação. A chave de recuperação é uma
+// chave X25519 impressa para o usuário guardar em papel; o cofre só guarda
+// a pública e a chave de cifra embrulhada para ela (como um membro por
+// chave), refeita a cada troca de chave.
+
+package vault
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// nome do envelope de recuperação (entra no AAD)
+const nomeRecuperacao = "recuperação"
+
+// ChangePassword troca a senha-mestre (ou a senha do membro que abriu o
+// cofre compartilhado), conferindo a senha atual. As entradas são
+// re-cifradas e a chave de recuperação, se houver, continua valendo; as
+// partes de SplitKey, que são da chave antiga, não.
+func (v *Vault) ChangePassword(atual, nova string) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if nova == "" {
+		return errors.New("senha nova vazia")
+	}
+	if err := v.checkPassword(atual); err != nil {
+		return err
+	}
+	return v.Rekey(nova, v.KDF())
+}
+
+// confere a senha contra o cabeçalho (ou contra o membro atual)
+func (v *Vault) checkPassword(senha string) error {
+	cab := v.file.Cabecalho
+	if v.Shared() {
+		for _, m := range cab.Membros {
+			if m.Nome == v.membro && m.Privada != "" {
+				_, err := m.openPrivate(senha, cab.ID)
+				return err
+			}
+		}
+		return errors.New("cofre compartilhado aberto sem membro por senha")
+	}
+	salt, err := base64.StdEncoding.DecodeString(cab.Salt)
+	if err != nil {
+		return corrupted("salt", err)
+	}
+	tag, err := base64.StdEncoding.DecodeString(cab.TagCheck)
+	if err != nil {
+		return corrupted("tag_check", err)
+	}
+	kauth, kenc, err := deriveKeys([]byte(senha), salt, cab.kdf())
+	if err != nil {
+		return corrupted("kdf", err)
+	}
+	wipe(kenc)
+	defer wipe(kauth)
+	_, err = matchTag(tag, kauth)
+	return err
+}
+
+// CreateVaultWithRecovery cria o cofre como CreateVaultWithKDF e gera a
+// chave de recuperação, retornada para ser impressa (não fica no cofre)
+func CreateVaultWithRecovery(path, senha string, storage Storage, kdf KDFParams) (*Vault, string, error) {
+	v, err := CreateVaultWithKDF(path, senha, storage, kdf)
+	if err != nil {
+		return nil, "", err
+	}
+	codigo, err := v.AddRecoveryKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return v, codigo, nil
+}
+
+// AddRecoveryKey gera uma chave de recuperação nova (a anterior deixa de valer)
+func (v *Vault) AddRecoveryKey() (string, error) {
+	if v.Locked() {
+		return "", ErrLocked
+	}
+	priv, err := GenerateMemberKey()
+	if err != nil {
+		return "", err
+	}
+	r := &member{Nome: nomeRecuperacao, Publica: base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes())}
+	if err := r.wrap(v.file.Cabecalho.ID, v.key); err != nil {
+		return "", err
+	}
+	antes := v.file.Cabecalho.Recuperacao
+	v.file.Cabecalho.Recuperacao = r
+	if err := v.persist(); err != nil {
+		v.file.Cabecalho.Recuperacao = antes
+		return "", err
+	}
+	return formatRecoveryKey(priv.Bytes()), nil
+}
+
+// RemoveRecoveryKey apaga o envelope de recuperação
+func (v *Vault) RemoveRecoveryKey() error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	antes := v.file.Cabecalho.Recuperacao
+	if antes == nil {
+		return nil
+	}
+	v.file.Cabecalho.Recuperacao = nil
+	if err := v.persist(); err != nil {
+		v.file.Cabecalho.Recuperacao = antes
+		return err
+	}
+	return nil
+}
+
+// HasRecoveryKey indica se o cofre tem chave de recuperação
+func (v *Vault) HasRecoveryKey() bool {
+	return v.file.Cabecalho.Recuperacao != nil
+}
+
+// OpenVaultWithRecoveryKey abre o cofre com a chave de recuperação, para
+// quem esqueceu a senha. Em seguida use Rekey (ou, em cofre compartilhado,
+// ResetMemberPassword) para definir a senha nova.
+func OpenVaultWithRecoveryKey(path, codigo string, storage Storage) (*Vault, error) {
+	raw, err := parseRecoveryKey(codigo)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	vf, version, err := loadFile(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	r := vf.Cabecalho.Recuperacao
+	if r == nil {
+		return nil, errors.New("cofre sem chave de recuperação")
+	}
+	kenc, err := r.unwrap(vf.Cabecalho.ID, priv)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kenc)
+	if vf.Cabecalho.MAC == "" {
+		return nil, corrupted("cabeçalho", errors.New("mac ausente"))
+	}
+	if vf.shared() && keyCheck(kenc) != vf.Cabecalho.TagCheck {
+		return nil, corrupted("recuperação", errors.New("chave de dados não confere com o cabeçalho"))
+	}
+	return openedVault(vf, kenc, storage, path, version, false)
+}
+
+// refaz o envelope de recuperação para a chave de cifra nova
+func (v *Vault) rewrapRecovery(cab *header, kenc []byte) error {
+	if v.file.Cabecalho.Recuperacao == nil {
+		cab.Recuperacao = nil
+		return nil
+	}
+	r := *v.file.Cabecalho.Recuperacao
+	if err := r.wrap(cab.ID, kenc); err != nil {
+		return err
+	}
+	cab.Recuperacao = &r
+	return nil
+}
+
+// 32 bytes da chave + 3 de verificação, em base32 com grupos de 4
+func formatRecoveryKey(raw []byte) string {
+	soma := sha256.Sum256(raw)
+	b32 := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(append(append([]byte{}, raw...), soma[:3]...))
+	grupos := []string{}
+	for i := 0; i < len(b32); i += 4 {
+		grupos = append(grupos, b32[i:min(i+4, len(b32))])
+	}
+	return strings.Join(grupos, "-")
+}
+
+// aceita o código com ou sem hífens e espaços, em qualquer caixa
+func parseRecoveryKey(codigo string) ([]byte, error) {
+	limpo := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(codigo))
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(limpo)
+	if err != nil || len(raw) != 35 {
+		return nil, ErrInvalidRecoveryKey
+	}
+	soma := sha256.Sum256(raw[:32])
+	if !hmac.Equal(soma[:3], raw[32:]) {
+		return nil, fmt.Errorf("%w: soma de verificação não confere", ErrInvalidRecoveryKey)
+	}
+	return raw[:32], nil
+}
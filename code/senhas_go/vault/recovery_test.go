@@ -0,0 +1,156 @@
+// recovery_test.go
+
+/*
+Testes de troca de senha e da chave de recuperação
+*/
+package vault_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestChangePassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "antiga", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.ChangePassword("errada", "nova"); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha atual errada: %v", err)
+	}
+	if err := v.ChangePassword("antiga", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	if v.KDF() != kdfRapido {
+		t.Fatalf("troca de senha mudou o kdf: %+v", v.KDF())
+	}
+	if _, err := vault.OpenVault(path, "antiga", storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("senha antiga ainda abre: %v", err)
+	}
+	v2, err := vault.OpenVault(path, "nova", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := v2.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("entrada perdida: %q %v", p, err)
+	}
+
+	// cofre compartilhado: troca a senha do membro atual
+	sp := filepath.Join(t.TempDir(), "equipe.json")
+	s, err := vault.CreateSharedVault(sp, "ana", "senha-ana", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangePassword("senha-ana", "nova-ana"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultMember(sp, "ana", "nova-ana", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChaveRecuperacao(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, codigo, err := vault.CreateVaultWithRecovery(path, "esquecida", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.HasRecoveryKey() {
+		t.Fatal("cofre sem chave de recuperação")
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	// a recuperação sobrevive a trocas de senha e de kdf
+	if err := v.ChangePassword("esquecida", "outra"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Rekey("esquecida", argonRapido); err != nil {
+		t.Fatal(err)
+	}
+
+	// o código pode ser digitado em minúsculas e sem hífens
+	digitado := strings.ToLower(strings.ReplaceAll(codigo, "-", " "))
+	r, err := vault.OpenVaultWithRecoveryKey(path, digitado, storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := r.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("recuperação: %q %v", p, err)
+	}
+	if err := r.Rekey("nova", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVault(path, "nova", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithRecoveryKey(path, codigo, storageTeste); err != nil {
+		t.Fatalf("recuperação depois do Rekey: %v", err)
+	}
+
+	// erro de digitação
+	errado := []byte(codigo)
+	if errado[0] == 'A' {
+		errado[0] = 'B'
+	} else {
+		errado[0] = 'A'
+	}
+	if _, err := vault.OpenVaultWithRecoveryKey(path, string(errado), storageTeste); !errors.Is(err, vault.ErrInvalidRecoveryKey) {
+		t.Fatalf("código com erro: %v", err)
+	}
+
+	// chave nova invalida a anterior
+	novo, err := r.AddRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithRecoveryKey(path, codigo, storageTeste); !errors.Is(err, vault.ErrWrongPassword) {
+		t.Fatalf("código antigo: %v", err)
+	}
+	if err := r.RemoveRecoveryKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithRecoveryKey(path, novo, storageTeste); err == nil {
+		t.Fatal("abriu sem chave de recuperação")
+	}
+}
+
+func TestRecuperacaoCompartilhado(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "equipe.json")
+	v, err := vault.CreateSharedVault(path, "ana", "senha-ana", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigo, err := v.AddRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "senha-bia", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.RemoveMember("bia"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := vault.OpenVaultWithRecoveryKey(path, codigo, storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResetMemberPassword("ana", "nova-ana", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultMember(path, "ana", "nova-ana", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithRecoveryKey(path, codigo, storageTeste); err != nil {
+		t.Fatalf("recuperação depois da rotação: %v", err)
+	}
+}
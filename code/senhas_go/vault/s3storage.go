@@ -0,0 +1,203 @@
+// s3storage.go
+// Storage em bucket compatível com S3 (AWS, MinIO, Ceph...), só com a
+// biblioteca padrão: API REST com assinatura AWS Signature V4.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage grava o cofre como um objeto; o path do cofre vira a chave.
+// A versão é o ETag do objeto e SaveVersion usa gravação condicional
+// (If-Match / If-None-Match), suportada pela AWS e pelo MinIO.
+type S3Storage struct {
+	Endpoint  string // ex.: https://s3.sa-east-1.amazonaws.com ou http://localhost:9000
+	Bucket    string
+	Regiao    string // padrão us-east-1
+	AccessKey string // vazio: requisições anônimas
+	SecretKey string
+	Client    *http.Client // padrão http.DefaultClient
+}
+
+func (s S3Storage) Save(path string, data []byte) error {
+	_, err := s.put(path, data, nil)
+	return err
+}
+
+func (s S3Storage) Load(path string) ([]byte, error) {
+	data, _, err := s.LoadVersion(path)
+	return data, err
+}
+
+// LoadVersion retorna o objeto e seu ETag
+func (s S3Storage) LoadVersion(path string) ([]byte, string, error) {
+	resp, body, err := s.do(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", fmt.Errorf("s3 %s: %w", path, fs.ErrNotExist)
+	}
+	return nil, "", s3Error(resp, body)
+}
+
+// SaveVersion grava somente se o ETag do objeto ainda for version;
+// version "" exige que o objeto não exista
+func (s S3Storage) SaveVersion(path string, data []byte, version string) (string, error) {
+	cond := map[string]string{"If-Match": version}
+	if version == "" {
+		cond = map[string]string{"If-None-Match": "*"}
+	}
+	return s.put(path, data, cond)
+}
+
+// Remove apaga o objeto (o S3 não acusa objeto inexistente)
+func (s S3Storage) Remove(path string) error {
+	resp, body, err := s.do(http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp, body)
+	}
+	return nil
+}
+
+func (s S3Storage) put(path string, data []byte, cab map[string]string) (string, error) {
+	resp, body, err := s.do(http.MethodPut, path, data, cab)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header.Get("ETag"), nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409: outra gravação condicional no mesmo objeto em andamento
+		return "", ErrConflict
+	}
+	return "", s3Error(resp, body)
+}
+
+func s3Error(resp *http.Response, body []byte) error {
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+}
+
+// executa a requisição (URL no estilo path: endpoint/bucket/chave) e lê o corpo
+func (s S3Storage) do(method, path string, data []byte, cab map[string]string) (*http.Response, []byte, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := strings.TrimPrefix(path, "/")
+	u.Path = "/" + s.Bucket + "/" + key
+	u.RawPath = "/" + s3Escape(s.Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range cab {
+		req.Header.Set(k, v)
+	}
+	if s.AccessKey != "" {
+		s.sign(req, data, time.Now())
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// ------------------ Signature V4 ------------------
+
+// assina a requisição com todos os cabeçalhos presentes mais o host
+func (s S3Storage) sign(req *http.Request, payload []byte, agora time.Time) {
+	regiao := s.Regiao
+	if regiao == "" {
+		regiao = "us-east-1"
+	}
+	data := agora.UTC().Format("20060102T150405Z")
+	dia := data[:8]
+	hash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", data)
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+
+	valores := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		valores[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	nomes := make([]string, 0, len(valores))
+	for k := range valores {
+		nomes = append(nomes, k)
+	}
+	sort.Strings(nomes)
+	var canon strings.Builder
+	for _, k := range nomes {
+		canon.WriteString(k + ":" + valores[k] + "\n")
+	}
+	assinados := strings.Join(nomes, ";")
+
+	creq := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canon.String(), assinados, hash,
+	}, "\n")
+	escopo := dia + "/" + regiao + "/s3/aws4_request"
+	sts := "AWS4-HMAC-SHA256\n" + data + "\n" + escopo + "\n" + sha256Hex([]byte(creq))
+
+	k := hmacSHA256([]byte("AWS4"+s.SecretKey), dia)
+	for _, parte := range []string{regiao, "s3", "aws4_request"} {
+		k = hmacSHA256(k, parte)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		s.AccessKey, escopo, assinados, hmacSHA256(k, sts)))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+// codificação de URI da AWS (RFC 3986), mantendo as barras da chave
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
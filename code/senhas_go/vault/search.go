@@ -0,0 +1,250 @@
+// search.go
+// Busca nas entradas: texto (substring ou aproximada) em local, usuário,
+// URLs e tags, casamento por domínio, ordenação e paginação. A busca é
+// feita sobre as entradas decifradas, em memória.
+
+package vault
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SortField é o critério de ordenação de Search
+type SortField string
+
+const (
+	SortRelevance SortField = "relevancia" // padrão; empates por local
+	SortLocal     SortField = "local"
+	SortUsuario   SortField = "usuario"
+	SortAlterado  SortField = "alterado"
+	SortSenha     SortField = "senha" // data da senha (PasswordDate)
+)
+
+// Query descreve uma busca. Critérios vazios não filtram; os preenchidos
+// precisam valer todos.
+type Query struct {
+	Texto   string   `json:"texto,omitempty"`   // sem diferenciar caixa; em local, usuário, URLs e tags
+	Fuzzy   bool     `json:"fuzzy,omitempty"`   // Texto também casa como subsequência ("gthb" acha "github")
+	Dominio string   `json:"dominio,omitempty"` // host ou URL; acha o mesmo domínio, um pai ou um filho dele
+	Tags    []string `json:"tags,omitempty"`    // a entrada precisa ter todas (sem diferenciar caixa)
+
+	Ordem  SortField `json:"ordem,omitempty"`
+	Desc   bool      `json:"desc,omitempty"`
+	Inicio int       `json:"inicio,omitempty"` // paginação: quantos resultados pular
+	Limite int       `json:"limite,omitempty"` // máximo de resultados (0 = todos)
+}
+
+// SearchResult é uma página de resultados de Search
+type SearchResult struct {
+	Entradas []Entry
+	Total    int // resultados antes da paginação
+}
+
+// Search retorna as entradas vivas que atendem q, ordenadas e paginadas.
+// As entradas vêm sem senha e sem totp (nem as senhas do histórico): a
+// busca não conta como leitura, então os segredos se leem com GetEntry.
+func (v *Vault) Search(q Query) (SearchResult, error) {
+	ordem := q.Ordem
+	if ordem == "" {
+		ordem = SortRelevance
+	}
+	if !validSort(ordem) {
+		return SearchResult{}, fmt.Errorf("ordenação desconhecida: %q", q.Ordem)
+	}
+	if q.Inicio < 0 || q.Limite < 0 {
+		return SearchResult{}, fmt.Errorf("paginação inválida: início %d, limite %d", q.Inicio, q.Limite)
+	}
+	es, err := v.entries()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	texto := strings.ToLower(strings.TrimSpace(q.Texto))
+	dominio := domainOf(q.Dominio)
+	if q.Dominio != "" && dominio == "" {
+		return SearchResult{}, fmt.Errorf("domínio inválido: %q", q.Dominio)
+	}
+
+	type achado struct {
+		e     Entry
+		score int
+	}
+	achados := []achado{}
+	for _, e := range es {
+		if !hasTags(e.Tags, q.Tags) {
+			continue
+		}
+		if dominio != "" && !matchDomain(e, dominio) {
+			continue
+		}
+		score := 1
+		if texto != "" {
+			if score = matchText(e, texto, q.Fuzzy); score == 0 {
+				continue
+			}
+		}
+		achados = append(achados, achado{e, score})
+	}
+
+	menor := func(a, b achado) bool {
+		switch ordem {
+		case SortRelevance:
+			if a.score != b.score {
+				return a.score > b.score
+			}
+		case SortUsuario:
+			if a.e.Usuario != b.e.Usuario {
+				return strings.ToLower(a.e.Usuario) < strings.ToLower(b.e.Usuario)
+			}
+		case SortAlterado:
+			if !a.e.Alterado.Equal(b.e.Alterado) {
+				return a.e.Alterado.Before(b.e.Alterado)
+			}
+		case SortSenha:
+			if da, db := a.e.PasswordDate(), b.e.PasswordDate(); !da.Equal(db) {
+				return da.Before(db)
+			}
+		}
+		return strings.ToLower(a.e.Local) < strings.ToLower(b.e.Local)
+	}
+	sort.SliceStable(achados, func(i, j int) bool {
+		if q.Desc {
+			return menor(achados[j], achados[i])
+		}
+		return menor(achados[i], achados[j])
+	})
+
+	res := SearchResult{Entradas: []Entry{}, Total: len(achados)}
+	fim := len(achados)
+	if q.Limite > 0 {
+		fim = min(fim, q.Inicio+q.Limite)
+	}
+	for i := q.Inicio; i < fim; i++ {
+		res.Entradas = append(res.Entradas, achados[i].e.withoutSecrets())
+	}
+	return res, nil
+}
+
+func validSort(o SortField) bool {
+	switch o {
+	case SortRelevance, SortLocal, SortUsuario, SortAlterado, SortSenha:
+		return true
+	}
+	return false
+}
+
+// a entrada tem todas as tags pedidas?
+func hasTags(tags, pedidas []string) bool {
+	for _, p := range pedidas {
+		achou := false
+		for _, t := range tags {
+			if strings.EqualFold(t, p) {
+				achou = true
+				break
+			}
+		}
+		if !achou {
+			return false
+		}
+	}
+	return true
+}
+
+// relevância do texto na entrada (0 = não casa). Vale o melhor campo:
+// local igual > começa com > contém > outros campos contêm > subsequência.
+func matchText(e Entry, texto string, fuzzy bool) int {
+	local := strings.ToLower(e.Local)
+	switch {
+	case local == texto:
+		return 100
+	case strings.HasPrefix(local, texto):
+		return 80
+	case strings.Contains(local, texto):
+		return 60
+	}
+	campos := append([]string{e.Usuario}, e.URLs...)
+	campos = append(campos, e.Tags...)
+	for _, c := range campos {
+		if strings.Contains(strings.ToLower(c), texto) {
+			return 40
+		}
+	}
+	if !fuzzy {
+		return 0
+	}
+	melhor := 0
+	for _, c := range append([]string{e.Local}, campos...) {
+		melhor = max(melhor, fuzzyScore(strings.ToLower(c), texto))
+	}
+	return melhor
+}
+
+// texto como subsequência de s: 1 a 30, mais alto quanto mais juntos os
+// caracteres; 0 se não casa
+func fuzzyScore(s, texto string) int {
+	i, saltos, primeiro := 0, 0, -1
+	for j, r := range s {
+		if i == len(texto) {
+			break
+		}
+		c, n := utf8.DecodeRuneInString(texto[i:])
+		if r != c {
+			if primeiro >= 0 {
+				saltos++
+			}
+			continue
+		}
+		if primeiro < 0 {
+			primeiro = j
+		}
+		i += n
+	}
+	if i < len(texto) {
+		return 0
+	}
+	return max(1, 30-saltos)
+}
+
+// domínio normalizado de um host ou URL: minúsculo, sem porta, sem "www."
+// e sem ponto final ("https://WWW.Exemplo.com:443/x" -> "exemplo.com").
+// Retorna "" se não parece um domínio.
+func domainOf(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || strings.ContainsAny(s, " \t") {
+		return ""
+	}
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	h := strings.TrimSuffix(u.Hostname(), ".")
+	h = strings.TrimPrefix(h, "www.")
+	if !strings.Contains(h, ".") {
+		return ""
+	}
+	return h
+}
+
+// o local ou alguma URL da entrada é do domínio d, de um domínio pai
+// (login.exemplo.com acha exemplo.com) ou de um subdomínio dele
+func matchDomain(e Entry, d string) bool {
+	hosts := []string{domainOf(e.Local)}
+	for _, u := range e.URLs {
+		hosts = append(hosts, domainOf(u))
+	}
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		if h == d || strings.HasSuffix(d, "."+h) || strings.HasSuffix(h, "."+d) {
+			return true
+		}
+	}
+	return false
+}
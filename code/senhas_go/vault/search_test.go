@@ -0,0 +1,107 @@
+// search_test.go
+
+/*
+Testes da busca: texto, busca aproximada, domínio, tags, ordenação e paginação
+*/
+package vault_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func cofreBusca(t *testing.T) *vault.Vault {
+	t.Helper()
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "cofre.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []vault.Entry{
+		{Local: "example.com", Usuario: "ana", Tags: []string{"Trabalho"}},
+		{Local: "GitHub", Usuario: "cleuton", Senha: "s3nh4", TOTP: "JBSWY3DPEHPK3PXP", URLs: []string{"https://github.com/login"}, Tags: []string{"dev", "trabalho"}},
+		{Local: "gitlab", Usuario: "cleuton@exemplo.com", URLs: []string{"https://gitlab.example.org"}, Tags: []string{"dev"}},
+		{Local: "Banco", Usuario: "12345", URLs: []string{"https://www.banco.com.br/"}},
+		{Local: "git", Usuario: "root"},
+	} {
+		if err := v.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+func nomesBusca(r vault.SearchResult) string {
+	var l []string
+	for _, e := range r.Entradas {
+		l = append(l, e.Local)
+	}
+	return strings.Join(l, ",")
+}
+
+func TestSearch(t *testing.T) {
+	v := cofreBusca(t)
+	casos := []struct {
+		nome  string
+		q     vault.Query
+		quer  string
+		total int
+	}{
+		{"tudo por local", vault.Query{Ordem: vault.SortLocal}, "Banco,example.com,git,GitHub,gitlab", 5},
+		{"relevância", vault.Query{Texto: "GIT"}, "git,GitHub,gitlab", 3},
+		{"usuário e url", vault.Query{Texto: "exemplo", Ordem: vault.SortLocal}, "gitlab", 1},
+		{"tag como texto", vault.Query{Texto: "trab", Ordem: vault.SortLocal}, "example.com,GitHub", 2},
+		{"sem fuzzy", vault.Query{Texto: "gthb"}, "", 0},
+		{"fuzzy", vault.Query{Texto: "gthb", Fuzzy: true}, "GitHub", 1},
+		{"subdomínio acha o pai", vault.Query{Dominio: "login.example.com"}, "example.com", 1},
+		{"url com www e porta", vault.Query{Dominio: "https://WWW.banco.com.br:443/x"}, "Banco", 1},
+		{"pai acha subdomínio", vault.Query{Dominio: "example.org"}, "gitlab", 1},
+		{"domínio sem parente", vault.Query{Dominio: "mple.com"}, "", 0},
+		{"tags", vault.Query{Tags: []string{"TRABALHO", "dev"}}, "GitHub", 1},
+		{"usuário desc", vault.Query{Ordem: vault.SortUsuario, Desc: true, Texto: "git"}, "git,gitlab,GitHub", 3},
+		{"página", vault.Query{Ordem: vault.SortLocal, Inicio: 1, Limite: 2}, "example.com,git", 5},
+		{"página além do fim", vault.Query{Inicio: 10, Limite: 2}, "", 5},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			r, err := v.Search(c.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := nomesBusca(r); got != c.quer || r.Total != c.total {
+				t.Fatalf("resultado %q (total %d), esperado %q (total %d)", got, r.Total, c.quer, c.total)
+			}
+		})
+	}
+
+	// a busca não conta como leitura: os segredos ficam de fora
+	r, err := v.Search(vault.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range r.Entradas {
+		if e.Senha != "" || e.TOTP != "" {
+			t.Fatalf("busca retornou segredos de %s", e.Local)
+		}
+	}
+
+	if _, err := v.Search(vault.Query{Ordem: "tamanho"}); err == nil {
+		t.Fatal("ordenação desconhecida aceita")
+	}
+	if _, err := v.Search(vault.Query{Dominio: "localhost"}); err == nil {
+		t.Fatal("domínio sem ponto aceito")
+	}
+	if _, err := v.Search(vault.Query{Limite: -1}); err == nil {
+		t.Fatal("limite negativo aceito")
+	}
+
+	// apagadas não aparecem
+	if err := v.DeleteLocal("git"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := v.Search(vault.Query{Texto: "git"}); nomesBusca(r) != "GitHub,gitlab" {
+		t.Fatalf("busca com lápide: %q", nomesBusca(r))
+	}
+}
@@ -0,0 +1,270 @@
+// secret.go
+// Higiene de memória: as chaves do cofre ficam numa área própria, zerada
+// no Lock (e travada na RAM com MlockKeys), e as senhas podem ser lidas
+// como Secret, um buffer que quem usa zera com Destroy. Strings do Go
+// (Entry.Senha, ExportClear) não podem ser zeradas: ficam na memória até
+// o coletor reaproveitar o espaço.
+
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"runtime"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MlockKeys faz as chaves dos cofres abertos a partir daqui ficarem numa
+// área fora do heap, travada na RAM (sem swap) e fora de core dumps. Só
+// no Linux; em outros sistemas, e se o limite de memória travada
+// (RLIMIT_MEMLOCK) não permitir, abrir o cofre falha.
+var MlockKeys = false
+
+// zera o buffer
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// área das chaves de um cofre aberto: Kenc seguida da chave do índice
+type keyRing struct {
+	buf     []byte
+	travada bool // veio de lockedAlloc
+}
+
+// copia kenc para uma área nova e deriva a chave do índice nela
+func newKeyRing(kenc []byte) (*keyRing, error) {
+	kidx, err := indexKey(kenc)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kidx)
+	k := &keyRing{}
+	n := len(kenc) + len(kidx)
+	if MlockKeys {
+		if k.buf, err = lockedAlloc(n); err != nil {
+			return nil, err
+		}
+		k.travada = true
+	} else {
+		k.buf = make([]byte, n)
+	}
+	copy(k.buf, kenc)
+	copy(k.buf[len(kenc):], kidx)
+	// cofre esquecido sem Lock: a área é zerada (e liberada) pelo coletor
+	runtime.SetFinalizer(k, (*keyRing).free)
+	return k, nil
+}
+
+func (k *keyRing) enc() []byte {
+	return k.buf[: len(k.buf)-32 : len(k.buf)-32]
+}
+
+func (k *keyRing) idx() []byte {
+	return k.buf[len(k.buf)-32:]
+}
+
+// zera e libera a área; pode ser chamada mais de uma vez
+func (k *keyRing) free() {
+	if k == nil || k.buf == nil {
+		return
+	}
+	wipe(k.buf)
+	if k.travada {
+		lockedFree(k.buf)
+	}
+	k.buf = nil
+	runtime.SetFinalizer(k, nil)
+}
+
+// Secret é um segredo decifrado num buffer próprio, que pode ser zerado.
+// Quem recebe deve chamar Destroy assim que terminar de usar; Lock zera
+// os Secrets ainda vivos do cofre.
+type Secret struct {
+	b []byte
+}
+
+func newSecret(b []byte) *Secret {
+	s := &Secret{b: b}
+	runtime.SetFinalizer(s, (*Secret).Destroy)
+	return s
+}
+
+// Bytes retorna o buffer do segredo (nil depois de Destroy). Não guarde
+// cópias: elas não são zeradas.
+func (s *Secret) Bytes() []byte {
+	return s.b
+}
+
+// Len é o tamanho do segredo em bytes
+func (s *Secret) Len() int {
+	return len(s.b)
+}
+
+// Destroy zera o buffer do segredo
+func (s *Secret) Destroy() {
+	wipe(s.b)
+	s.b = nil
+}
+
+// Destroyed indica se o segredo já foi zerado
+func (s *Secret) Destroyed() bool {
+	return s.b == nil
+}
+
+// String não revela o segredo, para não vazar em logs e fmt
+func (s *Secret) String() string {
+	return "[segredo]"
+}
+
+func (s *Secret) GoString() string {
+	return "vault.Secret{[segredo]}"
+}
+
+// GetPassword retorna a senha de um local como Secret. Ao contrário de
+// GetEntry e GetCredenciais, nenhuma string com a senha é criada: a
+// entrada é achada pelo índice, do texto decifrado só se interpretam o
+// local e a marca de lápide (nem a senha atual nem as do histórico viram
+// Entry), a senha vai direto para o Secret e o texto decifrado é zerado.
+func (v *Vault) GetPassword(local string) (*Secret, error) {
+	cand, err := v.candidates(local)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range cand {
+		plain, p, err := v.openLocal(v.file.Entradas[i])
+		if err != nil {
+			return nil, err
+		}
+		if p.Local != local || p.Removido {
+			wipe(plain)
+			continue
+		}
+		defer wipe(plain)
+		if err := v.audit(AuditRead, v.file.Entradas[i].ID); err != nil {
+			return nil, err
+		}
+		return v.passwordSecret(plain)
+	}
+	return nil, notFound(local)
+}
+
+// tira a senha do texto decifrado para um Secret novo
+func (v *Vault) passwordSecret(plain []byte) (*Secret, error) {
+	var p struct {
+		Senha json.RawMessage `json:"senha"`
+	}
+	if err := json.Unmarshal(plain, &p); err != nil {
+		return nil, corrupted("payload", err)
+	}
+	defer wipe(p.Senha)
+	senha, err := unquoteBytes(p.Senha)
+	if err != nil {
+		return nil, corrupted("senha da entrada", err)
+	}
+	s := newSecret(senha)
+	// os já destruídos saem da lista
+	vivos := v.segredos[:0]
+	for _, x := range v.segredos {
+		if !x.Destroyed() {
+			vivos = append(vivos, x)
+		}
+	}
+	v.segredos = append(vivos, s)
+	return s, nil
+}
+
+// decodifica uma string JSON direto para bytes, sem passar por string.
+// Vazio ou null (payloads antigos sem senha) viram buffer vazio.
+func unquoteBytes(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return []byte{}, nil
+	}
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil, errors.New("senha não é string")
+	}
+	raw = raw[1 : len(raw)-1]
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		if i+1 >= len(raw) {
+			wipe(out)
+			return nil, errors.New("escape incompleto")
+		}
+		i++
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, n := unquoteRune(raw[i+1:])
+			if n == 0 {
+				wipe(out)
+				return nil, errors.New("escape \\u inválido")
+			}
+			out = utf8.AppendRune(out, r)
+			i += n
+		default:
+			wipe(out)
+			return nil, errors.New("escape inválido")
+		}
+	}
+	return out, nil
+}
+
+// lê os hexas de um \u (e o par substituto seguinte, se houver); retorna
+// a runa e quantos bytes consumiu (0 = inválido)
+func unquoteRune(b []byte) (rune, int) {
+	r1, ok := hex4(b)
+	if !ok {
+		return 0, 0
+	}
+	if !utf16.IsSurrogate(r1) {
+		return r1, 4
+	}
+	if len(b) >= 10 && b[4] == '\\' && b[5] == 'u' {
+		if r2, ok := hex4(b[6:]); ok {
+			if r := utf16.DecodeRune(r1, r2); r != utf8.RuneError {
+				return r, 10
+			}
+		}
+	}
+	// substituto solto: o encoding/json também troca por U+FFFD
+	return utf8.RuneError, 4
+}
+
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
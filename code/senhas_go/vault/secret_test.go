@@ -0,0 +1,199 @@
+// secret_test.go
+
+/*
+Testes de higiene de memória: chaves e Secrets zerados no Lock e no Rekey,
+GetPassword sem strings e mlock das chaves no Linux
+*/
+package vault_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func zerado(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLockZera(t *testing.T) {
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "cofre.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("banco", "ana", "s3gr3d0"); err != nil {
+		t.Fatal(err)
+	}
+	chaves, _ := vault.KeyBuffer(v)
+	if len(chaves) != 64 || zerado(chaves) {
+		t.Fatalf("área das chaves: %d bytes", len(chaves))
+	}
+	s, err := v.GetPassword("banco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	senha := s.Bytes()
+	if string(senha) != "s3gr3d0" {
+		t.Fatalf("senha %q", senha)
+	}
+
+	v.Lock()
+	if !zerado(chaves) || !zerado(senha) || !s.Destroyed() || s.Bytes() != nil {
+		t.Fatalf("Lock não zerou: chaves %x, senha %q", chaves, senha)
+	}
+	if _, err := v.GetPassword("banco"); !errors.Is(err, vault.ErrLocked) {
+		t.Fatalf("GetPassword trancado: %v", err)
+	}
+	v.Lock() // de novo não faz nada
+}
+
+func TestRekeyZeraChaveAntiga(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("banco", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	antigas, _ := vault.KeyBuffer(v)
+	if err := v.Rekey("Nova", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	novas, _ := vault.KeyBuffer(v)
+	if !zerado(antigas) || zerado(novas) {
+		t.Fatalf("chaves após Rekey: antigas %x", antigas)
+	}
+	if _, _, err := v.GetCredenciais("banco"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetPassword(t *testing.T) {
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "cofre.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senhas := map[string]string{
+		"escapes": "a\"b\\c/d\n\t\u0001<>&",
+		"unicode": "sênha-😀- ",
+		"vazia":   "",
+	}
+	for local, senha := range senhas {
+		if err := v.AddLocal(local, "ana", senha); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for local, senha := range senhas {
+		s, err := v.GetPassword(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(s.Bytes()) != senha || s.Len() != len(senha) {
+			t.Fatalf("%s: %q, esperado %q", local, s.Bytes(), senha)
+		}
+		if fmt.Sprint(s) != "[segredo]" || fmt.Sprintf("%#v", s) == "" {
+			t.Fatalf("%s: segredo formatado como %v", local, s)
+		}
+		b := s.Bytes()
+		s.Destroy()
+		if !zerado(b) || !s.Destroyed() || s.Len() != 0 {
+			t.Fatalf("%s: Destroy não zerou %q", local, b)
+		}
+	}
+	if _, err := v.GetPassword("nenhum"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("local inexistente: %v", err)
+	}
+}
+
+// GetPassword não interpreta a entrada inteira: a memória alocada é a da
+// decifragem (texto cifrado e decifrado) e a do Secret, sem as strings das
+// senhas atual e anteriores, e o local certo é achado entre lápides
+func TestGetPasswordSemStrings(t *testing.T) {
+	v, err := vault.CreateVaultWithKDF(filepath.Join(t.TempDir(), "cofre.json"), "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// o local apagado e recriado deixa uma lápide com o mesmo índice
+	if err := v.AddLocal("banco", "ana", "antiga"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.DeleteLocal("banco"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("banco", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	const tamanho, versoes = 32 * 1024, 20
+	for i := 0; i < versoes; i++ {
+		if err := v.UpdateLocal("banco", "ana", strings.Repeat(string(rune('a'+i)), tamanho)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var antes, depois runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&antes)
+	s, err := v.GetPassword("banco")
+	runtime.ReadMemStats(&depois)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	if s.Len() != tamanho || s.Bytes()[0] != byte('a'+versoes-1) {
+		t.Fatalf("senha errada: %d bytes", s.Len())
+	}
+	// o payload tem a senha atual e as anteriores (o histórico)
+	payload := uint64((versoes + 1) * tamanho)
+	if alocado := depois.TotalAlloc - antes.TotalAlloc; alocado > 2*payload+4*tamanho {
+		t.Fatalf("GetPassword alocou %d bytes para um payload de %d", alocado, payload)
+	}
+}
+
+func TestMlockKeys(t *testing.T) {
+	vault.MlockKeys = true
+	defer func() { vault.MlockKeys = false }()
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Fatal("MlockKeys aceito fora do Linux")
+		}
+		return
+	}
+	if err != nil {
+		t.Skipf("mlock não permitido aqui: %v", err)
+	}
+	if _, travada := vault.KeyBuffer(v); !travada {
+		t.Fatal("chaves fora da área travada")
+	}
+	if err := v.AddLocal("banco", "ana", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Rekey("Nova", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	v.Lock()
+
+	v2, err := vault.OpenVault(path, "Nova", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v2.Lock()
+	if _, travada := vault.KeyBuffer(v2); !travada {
+		t.Fatal("chaves do cofre reaberto fora da área travada")
+	}
+	if _, senha, err := v2.GetCredenciais("banco"); err != nil || senha != "x" {
+		t.Fatalf("leitura com chaves travadas: %q %v", senha, err)
+	}
+}
@@ -0,0 +1,251 @@
+// shamir.go
+// Acesso de emergência por partes (Shamir, k de n): SplitKey divide a
+// chave de dados do cofre em n partes imprimíveis, das quais k quaisquer
+// a reconstroem em OpenVaultWithShares. Menos de k partes não revelam
+// nada da chave. Nada fica no cofre: as partes valem enquanto a chave de
+// dados for a mesma, e Rekey (ChangePassword), RotateKey, RemoveMember e
+// ResetMemberPassword, que trocam a chave, as invalidam.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// versão do formato da parte (a 1 dividia uma chave de custódia guardada
+// no cofre e não é mais aceita)
+const versaoParte = 2
+
+// versão, k, x, divisão (4 bytes), y (32 bytes) e 3 de verificação
+const tamParte = 1 + 1 + 1 + 4 + 32 + 3
+
+// parte decodificada
+type share struct {
+	k, x    byte
+	divisao [4]byte // confere a chave reconstruída (ver shareSet)
+	y       []byte
+}
+
+// SplitKey divide a chave de dados em n partes, das quais k abrem o cofre
+// (2 <= k <= n <= 255). Cada parte deve ir para um custodiante diferente;
+// nenhuma fica no cofre. As partes deixam de valer quando a chave de
+// dados muda (Rekey, ChangePassword, RotateKey, RemoveMember,
+// ResetMemberPassword): para revogá-las, troque a chave e divida de novo.
+func (v *Vault) SplitKey(k, n int) ([]string, error) {
+	if v.Locked() {
+		return nil, ErrLocked
+	}
+	if k < 2 || k > n || n > 255 {
+		return nil, fmt.Errorf("partes inválidas: %d de %d (2 <= k <= n <= 255)", k, n)
+	}
+	ys, err := splitSecret(v.key, k, n)
+	if err != nil {
+		return nil, err
+	}
+	divisao := shareSet(v.key)
+	partes := make([]string, n)
+	for i, y := range ys {
+		partes[i] = formatShare(share{k: byte(k), x: byte(i + 1), divisao: divisao, y: y})
+		wipe(y)
+	}
+	return partes, nil
+}
+
+// ShareThreshold retorna quantas partes (k) a divisão da parte exige
+func ShareThreshold(parte string) (int, error) {
+	s, err := parseShare(parte)
+	if err != nil {
+		return 0, err
+	}
+	wipe(s.y)
+	return int(s.k), nil
+}
+
+// OpenVaultWithShares junta as partes, reconstrói a chave de dados e abre
+// o cofre. Partes repetidas contam uma vez; partes de outra divisão, com
+// erro de digitação, em número menor que k ou de uma chave de dados que o
+// cofre não usa mais retornam ErrInvalidShare. Em seguida, como na
+// recuperação, use Rekey (ou ResetMemberPassword).
+func OpenVaultWithShares(path string, partes []string, storage Storage) (*Vault, error) {
+	var ss []share
+	defer func() {
+		for _, s := range ss {
+			wipe(s.y)
+		}
+	}()
+	vistos := map[byte]bool{}
+	for i, p := range partes {
+		s, err := parseShare(p)
+		if err != nil {
+			return nil, fmt.Errorf("parte %d: %w", i+1, err)
+		}
+		if len(ss) > 0 && (s.k != ss[0].k || s.divisao != ss[0].divisao) {
+			wipe(s.y)
+			return nil, fmt.Errorf("%w: parte %d é de outra divisão", ErrInvalidShare, i+1)
+		}
+		if vistos[s.x] {
+			wipe(s.y)
+			continue
+		}
+		vistos[s.x] = true
+		ss = append(ss, s)
+	}
+	if len(ss) == 0 {
+		return nil, fmt.Errorf("%w: nenhuma parte", ErrInvalidShare)
+	}
+	if len(ss) < int(ss[0].k) {
+		return nil, fmt.Errorf("%w: %d partes, a divisão exige %d", ErrInvalidShare, len(ss), ss[0].k)
+	}
+	kenc := combineShares(ss[:ss[0].k])
+	defer wipe(kenc)
+	if shareSet(kenc) != ss[0].divisao {
+		return nil, fmt.Errorf("%w: as partes não reconstroem a chave", ErrInvalidShare)
+	}
+	vf, version, err := loadFile(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	if vf.Cabecalho.MAC == "" {
+		return nil, corrupted("cabeçalho", errors.New("mac ausente"))
+	}
+	// a chave reconstruída confere com as partes: se não autentica o
+	// arquivo, o cofre trocou de chave depois da divisão (ou foi alterado)
+	if err := verifyMAC(kenc, vf, false); err != nil {
+		return nil, fmt.Errorf("%w: as partes são de uma chave de dados que o cofre não usa mais (Rekey, RotateKey ou RemoveMember) ou o cofre foi alterado", ErrInvalidShare)
+	}
+	return openedVault(vf, kenc, storage, path, version, false)
+}
+
+// ------------------ internos ------------------
+
+// 4 bytes de um HMAC da chave de dados, comuns a todas as partes das
+// divisões dela: conferem a chave reconstruída sem o arquivo
+func shareSet(kenc []byte) [4]byte {
+	h := hmac.New(sha256.New, kenc)
+	h.Write([]byte("SENHAS_SHARES_V2"))
+	return [4]byte(h.Sum(nil)[:4])
+}
+
+// mesmo formato da chave de recuperação: base32 em grupos de 4
+func formatShare(s share) string {
+	raw := make([]byte, 0, tamParte)
+	raw = append(raw, versaoParte, s.k, s.x)
+	raw = append(raw, s.divisao[:]...)
+	raw = append(raw, s.y...)
+	soma := sha256.Sum256(raw)
+	raw = append(raw, soma[:3]...)
+	defer wipe(raw)
+	b32 := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+	grupos := []string{}
+	for i := 0; i < len(b32); i += 4 {
+		grupos = append(grupos, b32[i:min(i+4, len(b32))])
+	}
+	return strings.Join(grupos, "-")
+}
+
+// aceita a parte com ou sem hífens e espaços, em qualquer caixa
+func parseShare(parte string) (share, error) {
+	limpo := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(parte))
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(limpo)
+	if err != nil || len(raw) != tamParte {
+		return share{}, ErrInvalidShare
+	}
+	defer wipe(raw)
+	soma := sha256.Sum256(raw[:tamParte-3])
+	if !hmac.Equal(soma[:3], raw[tamParte-3:]) {
+		return share{}, fmt.Errorf("%w: soma de verificação não confere", ErrInvalidShare)
+	}
+	if raw[0] != versaoParte {
+		return share{}, fmt.Errorf("%w: versão %d desconhecida", ErrInvalidShare, raw[0])
+	}
+	s := share{k: raw[1], x: raw[2], divisao: [4]byte(raw[3:7]), y: append([]byte{}, raw[7:tamParte-3]...)}
+	if s.k < 2 || s.x == 0 {
+		wipe(s.y)
+		return share{}, fmt.Errorf("%w: cabeçalho da parte inválido", ErrInvalidShare)
+	}
+	return s, nil
+}
+
+// divide o segredo em n partes (x = 1..n): para cada byte, um polinômio
+// aleatório de grau k-1 com o byte como termo constante
+func splitSecret(segredo []byte, k, n int) ([][]byte, error) {
+	ys := make([][]byte, n)
+	for i := range ys {
+		ys[i] = make([]byte, len(segredo))
+	}
+	coef := make([]byte, k)
+	defer wipe(coef)
+	for b, s := range segredo {
+		coef[0] = s
+		if _, err := rand.Read(coef[1:]); err != nil {
+			return nil, err
+		}
+		for i := range ys {
+			// Horner
+			x, y := byte(i+1), byte(0)
+			for j := k - 1; j >= 0; j-- {
+				y = gfMul(y, x) ^ coef[j]
+			}
+			ys[i][b] = y
+		}
+	}
+	return ys, nil
+}
+
+// interpolação de Lagrange em x = 0; os x devem ser distintos e não nulos
+func combineShares(ss []share) []byte {
+	// L_i(0) = prod x_j / (x_j - x_i), j != i (subtração é xor)
+	l := make([]byte, len(ss))
+	for i := range ss {
+		num, den := byte(1), byte(1)
+		for j := range ss {
+			if i != j {
+				num = gfMul(num, ss[j].x)
+				den = gfMul(den, ss[j].x^ss[i].x)
+			}
+		}
+		l[i] = gfMul(num, gfInv(den))
+	}
+	segredo := make([]byte, len(ss[0].y))
+	for b := range segredo {
+		var s byte
+		for i := range ss {
+			s ^= gfMul(ss[i].y[b], l[i])
+		}
+		segredo[b] = s
+	}
+	return segredo
+}
+
+// multiplicação em GF(2^8) com o polinômio do AES (x^8+x^4+x^3+x+1), sem
+// desvios nem tabelas que dependam dos valores
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// inverso multiplicativo: a^254 (0 vira 0)
+func gfInv(a byte) byte {
+	r, x := byte(1), a
+	for i := 0; i < 7; i++ {
+		x = gfMul(x, x)
+		r = gfMul(r, x)
+	}
+	return r
+}
@@ -0,0 +1,264 @@
+// shamir_test.go
+
+/*
+Testes do acesso de emergência por partes (Shamir k de n): todo
+subconjunto de k partes reconstrói a chave, menos de k não
+*/
+package vault_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// subconjuntos de {0..n-1} com tamanho t, como máscaras de bits
+func subconjuntos(n, t int) [][]int {
+	var res [][]int
+	for m := 0; m < 1<<n; m++ {
+		var s []int
+		for i := 0; i < n; i++ {
+			if m&(1<<i) != 0 {
+				s = append(s, i)
+			}
+		}
+		if len(s) == t {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func TestShamirSubconjuntos(t *testing.T) {
+	segredo := make([]byte, 32)
+	rand.Read(segredo)
+	for n := 2; n <= 6; n++ {
+		for k := 2; k <= n; k++ {
+			ys, err := vault.SplitSecret(segredo, k, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for tam := 1; tam <= n; tam++ {
+				for _, sub := range subconjuntos(n, tam) {
+					var xs []byte
+					var partes [][]byte
+					for _, i := range sub {
+						xs = append(xs, byte(i+1))
+						partes = append(partes, ys[i])
+					}
+					igual := bytes.Equal(vault.CombineSecret(xs, partes), segredo)
+					if tam >= k && !igual {
+						t.Fatalf("%d de %d: partes %v não reconstroem", k, n, sub)
+					}
+					if tam < k && igual {
+						t.Fatalf("%d de %d: partes %v (menos que k) reconstroem", k, n, sub)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOpenVaultWithShares(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "senha", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.SplitKey(1, 3); err == nil {
+		t.Fatal("k = 1 aceito")
+	}
+	if _, err := v.SplitKey(4, 3); err == nil {
+		t.Fatal("k > n aceito")
+	}
+
+	for n := 2; n <= 4; n++ {
+		for k := 2; k <= n; k++ {
+			partes, err := v.SplitKey(k, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(partes) != n {
+				t.Fatalf("%d de %d: %d partes", k, n, len(partes))
+			}
+			if m, err := vault.ShareThreshold(partes[0]); err != nil || m != k {
+				t.Fatalf("ShareThreshold: %d %v", m, err)
+			}
+			for _, sub := range subconjuntos(n, k) {
+				var escolhidas []string
+				for _, i := range sub {
+					escolhidas = append(escolhidas, partes[i])
+				}
+				r, err := vault.OpenVaultWithShares(path, escolhidas, storageTeste)
+				if err != nil {
+					t.Fatalf("%d de %d, partes %v: %v", k, n, sub, err)
+				}
+				if _, p, err := r.GetCredenciais("siteA"); err != nil || p != "passA" {
+					t.Fatalf("%d de %d, partes %v: %q %v", k, n, sub, p, err)
+				}
+			}
+			for _, sub := range subconjuntos(n, k-1) {
+				var escolhidas []string
+				for _, i := range sub {
+					escolhidas = append(escolhidas, partes[i])
+				}
+				if _, err := vault.OpenVaultWithShares(path, escolhidas, storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+					t.Fatalf("%d de %d, só %v: %v", k, n, sub, err)
+				}
+			}
+		}
+	}
+}
+
+func TestSharesRekeyEErros(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "senha", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	partes, err := v.SplitKey(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// digitadas sem hífens e em minúsculas, e repetidas contam uma vez
+	digitada := strings.ToLower(strings.ReplaceAll(partes[4], "-", ""))
+	r, err := vault.OpenVaultWithShares(path, []string{partes[1], digitada, partes[1], partes[3]}, storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := r.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("cofre aberto pelas partes: %q %v", p, err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, []string{partes[0], partes[1], partes[1]}, storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+		t.Fatalf("partes repetidas contaram: %v", err)
+	}
+
+	// erro de digitação
+	errada := []byte(partes[0])
+	if errada[5] == 'A' {
+		errada[5] = 'B'
+	} else {
+		errada[5] = 'A'
+	}
+	if _, err := vault.OpenVaultWithShares(path, []string{string(errada), partes[1], partes[2]}, storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+		t.Fatalf("parte com erro: %v", err)
+	}
+
+	// outra divisão da mesma chave também abre, mas não se mistura com esta
+	novas, err := r.SplitKey(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, novas[1:], storageTeste); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, []string{novas[0], partes[1]}, storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+		t.Fatalf("divisões misturadas: %v", err)
+	}
+
+	// as partes são da chave de dados: trocar a senha troca a chave e as
+	// invalida
+	if err := r.ChangePassword("senha", "nova"); err != nil {
+		t.Fatal(err)
+	}
+	for _, ps := range [][]string{partes[:3], novas[:2]} {
+		if _, err := vault.OpenVaultWithShares(path, ps, storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+			t.Fatalf("partes depois de trocar a senha: %v", err)
+		}
+	}
+	depois, err := r.SplitKey(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, depois, storageTeste); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharesCompartilhado(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "equipe.json")
+	v, err := vault.CreateSharedVault(path, "ana", "senha-ana", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddMember("bia", "senha-bia", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	partes, err := v.SplitKey(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tirar um membro gira a chave de dados: as partes deixam de valer
+	if err := v.RemoveMember("bia"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, partes[:2], storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+		t.Fatalf("partes depois de RemoveMember: %v", err)
+	}
+	partes, err = v.SplitKey(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := vault.OpenVaultWithShares(path, []string{partes[2], partes[0]}, storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResetMemberPassword("ana", "nova-ana", kdfRapido); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultMember(path, "ana", "nova-ana", storageTeste); err != nil {
+		t.Fatal(err)
+	}
+	// RotateKey também
+	if err := r.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.OpenVaultWithShares(path, partes[1:], storageTeste); !errors.Is(err, vault.ErrInvalidShare) {
+		t.Fatalf("partes depois de RotateKey: %v", err)
+	}
+}
+
+// k partes quaisquer, sem a primeira e fora de ordem
+func TestSharesSemAPrimeira(t *testing.T) {
+	segredo := make([]byte, 32)
+	rand.Read(segredo)
+	ys, err := vault.SplitSecret(segredo, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(vault.CombineSecret([]byte{2, 4, 5}, [][]byte{ys[1], ys[3], ys[4]}), segredo) {
+		t.Fatal("partes 2, 4 e 5 não reconstroem")
+	}
+
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "senha", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddLocal("siteA", "userA", "passA"); err != nil {
+		t.Fatal(err)
+	}
+	partes, err := v.SplitKey(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := vault.OpenVaultWithShares(path, []string{partes[4], partes[1], partes[3]}, storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err := r.GetCredenciais("siteA"); err != nil || p != "passA" {
+		t.Fatalf("partes 5, 2 e 4: %q %v", p, err)
+	}
+}
@@ -0,0 +1,164 @@
+// sqlstorage.go
+// Storage em tabela SQL via database/sql (SQLite, Postgres, MySQL...).
+// O driver fica por conta de quem usa: basta importar e passar o *sql.DB.
+
+package vault
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SQLStorage grava cada cofre numa linha (caminho, dados, revisao).
+// A revisão é incrementada a cada gravação e serve de versão:
+// SaveVersion só atualiza a linha se a revisão ainda for a lida.
+type SQLStorage struct {
+	DB       *sql.DB
+	Tabela   string // padrão "cofres"
+	Postgres bool   // placeholders $1, $2... em vez de ?
+}
+
+var nomeTabela = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CreateTable cria a tabela, se ainda não existir
+func (s SQLStorage) CreateTable() error {
+	q, err := s.query(`CREATE TABLE IF NOT EXISTS %s (
+		caminho VARCHAR(255) PRIMARY KEY,
+		dados   TEXT NOT NULL,
+		revisao INTEGER NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(q)
+	return err
+}
+
+// monta a consulta com o nome da tabela e os placeholders do banco
+func (s SQLStorage) query(q string) (string, error) {
+	t := s.Tabela
+	if t == "" {
+		t = "cofres"
+	}
+	if !nomeTabela.MatchString(t) {
+		return "", fmt.Errorf("nome de tabela inválido: %q", t)
+	}
+	q = fmt.Sprintf(q, t)
+	if !s.Postgres {
+		return q, nil
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String(), nil
+}
+
+// Save grava sem verificar a revisão (sobrescreve o que houver)
+func (s SQLStorage) Save(path string, data []byte) error {
+	q, err := s.query(`UPDATE %s SET dados = ?, revisao = revisao + 1 WHERE caminho = ?`)
+	if err != nil {
+		return err
+	}
+	res, err := s.DB.Exec(q, string(data), path)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = s.insert(path, data)
+	return err
+}
+
+// Remove apaga a linha do caminho
+func (s SQLStorage) Remove(path string) error {
+	q, err := s.query(`DELETE FROM %s WHERE caminho = ?`)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(q, path)
+	return err
+}
+
+func (s SQLStorage) Load(path string) ([]byte, error) {
+	data, _, err := s.LoadVersion(path)
+	return data, err
+}
+
+// LoadVersion retorna os dados e a revisão (em decimal)
+func (s SQLStorage) LoadVersion(path string) ([]byte, string, error) {
+	q, err := s.query(`SELECT dados, revisao FROM %s WHERE caminho = ?`)
+	if err != nil {
+		return nil, "", err
+	}
+	var (
+		dados string
+		rev   int64
+	)
+	err = s.DB.QueryRow(q, path).Scan(&dados, &rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("sql %s: %w", path, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(dados), strconv.FormatInt(rev, 10), nil
+}
+
+// SaveVersion grava somente se a revisão no banco ainda for version;
+// version "" exige que a linha não exista
+func (s SQLStorage) SaveVersion(path string, data []byte, version string) (string, error) {
+	if version == "" {
+		v, err := s.insert(path, data)
+		if err != nil {
+			// chave duplicada: outro processo criou o cofre antes
+			if _, _, lerr := s.LoadVersion(path); lerr == nil {
+				return "", ErrConflict
+			}
+			return "", err
+		}
+		return v, nil
+	}
+	rev, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("versão inválida %q: %w", version, err)
+	}
+	q, err := s.query(`UPDATE %s SET dados = ?, revisao = ? WHERE caminho = ? AND revisao = ?`)
+	if err != nil {
+		return "", err
+	}
+	res, err := s.DB.Exec(q, string(data), rev+1, path, rev)
+	if err != nil {
+		return "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrConflict
+	}
+	return strconv.FormatInt(rev+1, 10), nil
+}
+
+func (s SQLStorage) insert(path string, data []byte) (string, error) {
+	q, err := s.query(`INSERT INTO %s (caminho, dados, revisao) VALUES (?, ?, 1)`)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.DB.Exec(q, path, string(data)); err != nil {
+		return "", err
+	}
+	return "1", nil
+}
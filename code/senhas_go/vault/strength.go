@@ -0,0 +1,262 @@
+// strength.go
+// Estimativa de força das senhas e auditoria do cofre (fracas, comuns, reutilizadas).
+
+package vault
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// níveis de força
+const (
+	NivelFraca = "fraca"
+	NivelMedia = "media"
+	NivelForte = "forte"
+)
+
+// Strength é a estimativa de força de uma senha
+type Strength struct {
+	Entropia float64 // bits estimados
+	Nivel    string
+	Comum    bool // senha (ou variação dela) presente em listas de vazamentos
+	Motivos  []string
+}
+
+// AuditItem descreve uma entrada com algum problema
+type AuditItem struct {
+	Local         string
+	Forca         Strength
+	ReutilizadaEm []string // outros locais com a mesma senha
+}
+
+// AuditReport é o resultado de Vault.Audit
+type AuditReport struct {
+	Total        int // entradas analisadas
+	Fracas       int
+	Comuns       int
+	Reutilizadas int
+	Itens        []AuditItem // só as entradas com problema, ordenadas por local
+}
+
+// senhas mais comuns em vazamentos públicos (já normalizadas)
+var senhasComuns = map[string]bool{}
+
+func init() {
+	for _, s := range strings.Fields(`
+		123456 123456789 12345678 12345 1234567 1234567890 111111 000000 123123
+		654321 666666 121212 112233 123321 696969 159753 147258369 987654321
+		password passw0rd password1 qwerty qwerty123 qwertyuiop asdfgh asdfghjkl
+		zxcvbnm 1q2w3e4r 1qaz2wsx qazwsx abc123 abcdef iloveyou admin administrator
+		welcome letmein monkey dragon master sunshine princess football baseball
+		shadow superman batman trustno1 starwars whatever freedom hello charlie
+		michael jordan jennifer hunter buster soccer harley ranger killer pokemon
+		computer internet secret mustang access login root toor changeme default
+		guest test senha senha123 mudar mudar123 brasil flamengo corinthians
+		palmeiras vasco gremio amor teamo deusefiel jesus cristo estrela
+		minhasenha segredo`) {
+		senhasComuns[s] = true
+	}
+}
+
+// palavras da lista diceware, para detectar palavras de dicionário
+var palavrasDicionario = func() map[string]bool {
+	m := make(map[string]bool, len(wordlist))
+	for _, w := range wordlist {
+		m[w] = true
+	}
+	return m
+}()
+
+// sequências de teclado (e do teclado numérico)
+var sequenciasTeclado = []string{
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "abcdefghijklmnopqrstuvwxyz",
+	"1qaz2wsx3edc4rfv", "qazwsxedc",
+}
+
+// desfaz substituições comuns (leet speak)
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// EstimateStrength estima a entropia de uma senha levando em conta
+// senhas comuns, palavras de dicionário, frases-senha, repetições e sequências
+func EstimateStrength(senha string) Strength {
+	s := Strength{}
+	lower := strings.ToLower(senha)
+	norm := leet.Replace(lower)
+	// núcleo: sem números/símbolos no começo e no fim ("Senha@2024" -> "senha")
+	core := strings.TrimFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	prefixo := lower[:strings.Index(lower, core)]
+	sufixo := lower[len(prefixo)+len(core):]
+	afixos := patternBits(prefixo) + patternBits(sufixo)
+
+	switch {
+	case senha == "":
+		s.Motivos = append(s.Motivos, "senha vazia")
+	case senhasComuns[lower] || senhasComuns[norm] || senhasComuns[core] || senhasComuns[leet.Replace(core)]:
+		s.Comum = true
+		s.Entropia = math.Log2(float64(len(senhasComuns))) + afixos
+		s.Motivos = append(s.Motivos, "senha comum em vazamentos")
+	case len(core) >= 3 && (palavrasDicionario[core] || palavrasDicionario[leet.Replace(core)]):
+		s.Entropia = math.Log2(float64(len(wordlist))) + 1 + afixos
+		s.Motivos = append(s.Motivos, "palavra de dicionário")
+	default:
+		if n, ok := passphraseWords(lower); ok {
+			s.Entropia = float64(n)*math.Log2(float64(len(wordlist))) + 1
+		} else {
+			s.Entropia = patternBits(senha)
+		}
+	}
+
+	if len([]rune(senha)) < 8 && senha != "" {
+		s.Motivos = append(s.Motivos, "menos de 8 caracteres")
+	}
+	switch {
+	case s.Comum || s.Entropia < 40:
+		s.Nivel = NivelFraca
+	case s.Entropia < 72:
+		s.Nivel = NivelMedia
+	default:
+		s.Nivel = NivelForte
+	}
+	return s
+}
+
+// número de palavras se a senha for só palavras da lista com separadores
+func passphraseWords(lower string) (int, bool) {
+	partes := strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	if len(partes) < 2 {
+		return 0, false
+	}
+	for _, p := range partes {
+		if !palavrasDicionario[p] {
+			return 0, false
+		}
+	}
+	return len(partes), true
+}
+
+// entropia por caractere pelo alfabeto usado, descontando repetições,
+// sequências (abc, 321) e trechos de sequências de teclado
+func patternBits(senha string) float64 {
+	if senha == "" {
+		return 0
+	}
+	runes := []rune(senha)
+	bits := math.Log2(float64(alphabetSize(runes)))
+
+	fraco := make([]bool, len(runes))
+	for i := 1; i < len(runes); i++ {
+		d := runes[i] - runes[i-1]
+		if d == 0 || d == 1 || d == -1 {
+			fraco[i] = true
+		}
+	}
+	lower := []rune(strings.ToLower(senha))
+	for _, seq := range sequenciasTeclado {
+		for _, sq := range []string{seq, reverse(seq)} {
+			for i := 0; i+4 <= len(lower); i++ {
+				if strings.Contains(sq, string(lower[i:i+4])) {
+					for k := i + 1; k < i+4; k++ {
+						fraco[k] = true
+					}
+				}
+			}
+		}
+	}
+
+	total := 0.0
+	for _, f := range fraco {
+		if f {
+			total++
+		} else {
+			total += bits
+		}
+	}
+	return total
+}
+
+// tamanho do alfabeto pelas classes de caracteres presentes
+func alphabetSize(runes []rune) int {
+	var min, mai, dig, sim, outros bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			min = true
+		case r >= 'A' && r <= 'Z':
+			mai = true
+		case r >= '0' && r <= '9':
+			dig = true
+		case r < 128:
+			sim = true
+		default:
+			outros = true
+		}
+	}
+	n := 0
+	for _, c := range []struct {
+		on bool
+		n  int
+	}{{min, 26}, {mai, 26}, {dig, 10}, {sim, 33}, {outros, 100}} {
+		if c.on {
+			n += c.n
+		}
+	}
+	return n
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// Audit decifra todas as entradas e aponta senhas fracas, comuns e
+// reutilizadas (o log de operações do cofre é outro: ver EnableAuditLog)
+func (v *Vault) Audit() (AuditReport, error) {
+	rep := AuditReport{}
+	entradas := []Entry{}
+	porSenha := map[string][]string{}
+	for _, e := range v.file.Entradas {
+		plain, err := v.decryptEntry(e)
+		if err != nil {
+			return AuditReport{}, err
+		}
+		if plain.Removido {
+			continue
+		}
+		entradas = append(entradas, plain)
+		porSenha[plain.Senha] = append(porSenha[plain.Senha], plain.Local)
+	}
+	rep.Total = len(entradas)
+	sort.Slice(entradas, func(i, j int) bool { return entradas[i].Local < entradas[j].Local })
+
+	for _, e := range entradas {
+		item := AuditItem{Local: e.Local, Forca: EstimateStrength(e.Senha)}
+		for _, outro := range porSenha[e.Senha] {
+			if outro != e.Local {
+				item.ReutilizadaEm = append(item.ReutilizadaEm, outro)
+			}
+		}
+		fraca := item.Forca.Nivel == NivelFraca
+		if fraca {
+			rep.Fracas++
+		}
+		if item.Forca.Comum {
+			rep.Comuns++
+		}
+		if len(item.ReutilizadaEm) > 0 {
+			rep.Reutilizadas++
+		}
+		if fraca || item.Forca.Comum || len(item.ReutilizadaEm) > 0 {
+			rep.Itens = append(rep.Itens, item)
+		}
+	}
+	if err := v.audit(AuditScan, ""); err != nil {
+		return AuditReport{}, err
+	}
+	return rep, nil
+}
@@ -0,0 +1,381 @@
+// sync.go
+// Sincronização bidirecional entre cofres (merge de três vias por entrada).
+
+package vault
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SyncConflict é uma entrada alterada dos dois lados desde a última sincronização.
+// Removido = true indica que aquele lado apagou a entrada.
+type SyncConflict struct {
+	Local string // nome no cofre que chamou Sync
+	Nosso Entry  // versão do cofre que chamou Sync
+	Deles Entry  // versão do cofre alvo
+}
+
+// ConflictResolver decide o conteúdo final de uma entrada em conflito.
+// Retornar uma Entry com Removido = true apaga a entrada dos dois lados.
+type ConflictResolver func(c SyncConflict) (Entry, error)
+
+// PreferNewest fica com a versão alterada por último (padrão do Sync)
+func PreferNewest(c SyncConflict) (Entry, error) {
+	if c.Deles.Alterado.After(c.Nosso.Alterado) {
+		return c.Deles, nil
+	}
+	return c.Nosso, nil
+}
+
+// PreferOurs fica sempre com a versão do cofre que chamou Sync
+func PreferOurs(c SyncConflict) (Entry, error) {
+	return c.Nosso, nil
+}
+
+// PreferTheirs fica sempre com a versão do cofre alvo
+func PreferTheirs(c SyncConflict) (Entry, error) {
+	return c.Deles, nil
+}
+
+// SyncChanges lista os locais alterados em um dos cofres
+type SyncChanges struct {
+	Adicionadas []string
+	Atualizadas []string
+	Apagadas    []string
+
+	orfaos []Attachment // anexos que a entrada deixou de ter: blobs a apagar depois de gravar
+}
+
+// SyncReport é o resultado de Sync
+type SyncReport struct {
+	Origem    SyncChanges    // alterações aplicadas no cofre que chamou Sync
+	Destino   SyncChanges    // alterações aplicadas no cofre alvo
+	Conflitos []SyncConflict // conflitos encontrados (já resolvidos)
+}
+
+// registro de uma entrada (viva ou lápide) durante o Sync
+type syncRecord struct {
+	pos   int
+	id    string
+	entry Entry
+}
+
+// todos os registros do cofre, por local
+func (v *Vault) records() (map[string]syncRecord, error) {
+	res := make(map[string]syncRecord, len(v.file.Entradas))
+	for i, e := range v.file.Entradas {
+		plain, err := v.decryptEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		// duplicatas de cofres antigos: vale a primeira viva
+		if r, ok := res[plain.Local]; ok && !r.entry.Removido {
+			continue
+		}
+		res[plain.Local] = syncRecord{pos: i, id: e.ID, entry: plain}
+	}
+	return res, nil
+}
+
+// a entrada mudou desde a última sincronização com o cofre peer?
+func (v *Vault) changedSince(peer string, r syncRecord) bool {
+	rev, ok := v.file.Sincronia[peer][r.id]
+	return !ok || rev != r.entry.Revisao
+}
+
+// compara o conteúdo ignorando revisão, datas e histórico
+func sameContent(a, b Entry) bool {
+	a.Revisao, b.Revisao = 0, 0
+	a.SenhaAlterada, b.SenhaAlterada = time.Time{}, time.Time{}
+	a.Historico, b.Historico = nil, nil
+	a.Criado, b.Criado = time.Time{}, time.Time{}
+	a.Alterado, b.Alterado = time.Time{}, time.Time{}
+	if a.Removido && b.Removido {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// aplica e no registro r de v (cria, atualiza, renomeia ou vira lápide), sem persistir.
+// Mantém a data de alteração de quem originou a mudança. Os blobs dos
+// anexos novos vêm de origem, onde a entrada tem o ID id.
+func (v *Vault) applySync(origem *Vault, id string, r syncRecord, existe bool, e Entry, ch *SyncChanges) error {
+	if !e.Removido {
+		// outra entrada viva já usa o nome (criada em separado, ou renomeada
+		// só de um lado): não dá para ter as duas com o mesmo local
+		pos, err := v.lookup(e.Local)
+		if err != nil {
+			return err
+		}
+		for _, p := range pos {
+			if !existe || p != r.pos {
+				return fmt.Errorf("sync: entradas diferentes com o mesmo nome: %w", duplicate(e.Local))
+			}
+		}
+	}
+	if err := v.copyBlobs(origem, e, r.entry.Anexos); err != nil {
+		return err
+	}
+	if !existe {
+		if e.Removido {
+			return nil // nada a apagar
+		}
+		ch.Adicionadas = append(ch.Adicionadas, e.Local)
+		return v.addEntry(e, id)
+	}
+	eid, err := entryID(v.file.Entradas[r.pos])
+	if err != nil {
+		return err
+	}
+	switch {
+	case e.Removido && r.entry.Removido:
+		return nil
+	case e.Removido:
+		ch.Apagadas = append(ch.Apagadas, r.entry.Local)
+		e = Entry{Local: e.Local, Criado: r.entry.Criado, Alterado: e.Alterado, Removido: true}
+	case r.entry.Removido:
+		ch.Adicionadas = append(ch.Adicionadas, e.Local)
+	default:
+		ch.Atualizadas = append(ch.Atualizadas, e.Local)
+	}
+	e.Revisao = r.entry.Revisao + 1
+	if err := v.putEntry(r.pos, eid, e); err != nil {
+		return err
+	}
+	ch.orfaos = append(ch.orfaos, droppedAttachments(r.entry.Anexos, e.Anexos)...)
+	return nil
+}
+
+// anexos de antes que não estão em depois (pelo ID do blob)
+func droppedAttachments(antes, depois []Attachment) []Attachment {
+	ficam := map[string]bool{}
+	for _, a := range depois {
+		ficam[a.ID] = true
+	}
+	res := []Attachment{}
+	for _, a := range antes {
+		if !ficam[a.ID] {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// Sync faz o merge bidirecional entre v e target. Entradas são casadas pelo
+// ID (uma renomeação é uma alteração da mesma entrada) e, as que não têm
+// par pelo ID, pelo local; o que mudou só de um lado desde a última
+// sincronização entre os dois cofres é copiado para o outro (incluindo
+// remoções), e o que mudou dos dois lados é um conflito, resolvido por
+// resolver (nil = PreferNewest). Duas entradas diferentes que acabariam
+// com o mesmo local retornam ErrDuplicate: renomeie uma e repita.
+// Se a gravação de um dos cofres falha, as alterações em memória dele são
+// desfeitas (o destino é gravado primeiro). Os blobs dos anexos que uma
+// remoção ou alteração tirou da entrada são apagados, como em DeleteLocal,
+// depois que o cofre correspondente foi gravado.
+func (v *Vault) Sync(target *Vault, resolver ConflictResolver) (SyncReport, error) {
+	if resolver == nil {
+		resolver = PreferNewest
+	}
+	antesV, antesT := v.saveState(), target.saveState()
+	rep, err := v.merge(target, resolver)
+	if err == nil {
+		err = target.audit(AuditSync, "")
+	}
+	if err == nil {
+		err = target.persist()
+	}
+	if err != nil {
+		v.restoreState(antesV)
+		target.restoreState(antesT)
+		return rep, err
+	}
+	target.removeBlobs(rep.Destino.orfaos)
+	err = v.audit(AuditSync, "")
+	if err == nil {
+		err = v.persist()
+	}
+	if err != nil {
+		v.restoreState(antesV)
+		return rep, err
+	}
+	v.removeBlobs(rep.Origem.orfaos)
+	return rep, nil
+}
+
+// par de registros da mesma entrada nos dois cofres (um lado pode faltar)
+type syncPair struct {
+	a, b     syncRecord
+	okA, okB bool
+}
+
+func (p syncPair) local() string {
+	if p.okA {
+		return p.a.entry.Local
+	}
+	return p.b.entry.Local
+}
+
+// casa os registros dos dois cofres: primeiro pelo ID; os que sobram, pelo
+// local (entradas criadas em separado nos dois cofres)
+func syncPairs(nossos, deles map[string]syncRecord) []syncPair {
+	porID := make(map[string]string, len(deles))
+	for l, b := range deles {
+		porID[b.id] = l
+	}
+	usados := map[string]bool{}
+	pares := []syncPair{}
+	sobra := []syncRecord{}
+	for _, a := range nossos {
+		if l, ok := porID[a.id]; ok {
+			pares = append(pares, syncPair{a: a, b: deles[l], okA: true, okB: true})
+			usados[l] = true
+			continue
+		}
+		sobra = append(sobra, a)
+	}
+	idsNossos := make(map[string]bool, len(nossos))
+	for _, a := range nossos {
+		idsNossos[a.id] = true
+	}
+	for _, a := range sobra {
+		b, ok := deles[a.entry.Local]
+		if ok && !usados[a.entry.Local] && !idsNossos[b.id] {
+			pares = append(pares, syncPair{a: a, b: b, okA: true, okB: true})
+			usados[a.entry.Local] = true
+			continue
+		}
+		pares = append(pares, syncPair{a: a, okA: true})
+	}
+	for l, b := range deles {
+		if !usados[l] {
+			pares = append(pares, syncPair{b: b, okB: true})
+		}
+	}
+	sort.Slice(pares, func(i, j int) bool { return pares[i].local() < pares[j].local() })
+	return pares
+}
+
+// merge bidirecional de Sync, sem persistir
+func (v *Vault) merge(target *Vault, resolver ConflictResolver) (SyncReport, error) {
+	rep := SyncReport{}
+	nossos, err := v.records()
+	if err != nil {
+		return rep, err
+	}
+	deles, err := target.records()
+	if err != nil {
+		return rep, err
+	}
+	idV, idT := v.file.Cabecalho.ID, target.file.Cabecalho.ID
+
+	for _, p := range syncPairs(nossos, deles) {
+		a, b := p.a, p.b
+		if p.okA && p.okB && a.id != b.id {
+			// casados pelo local (criados em separado ou sincronizados antes
+			// do ID comum): os dois ficam com o menor ID
+			if a.id < b.id {
+				err = target.adoptID(&b, a.id)
+			} else {
+				err = v.adoptID(&a, b.id)
+			}
+			if err != nil {
+				return rep, err
+			}
+		}
+		switch {
+		case p.okA && !p.okB:
+			err = target.applySync(v, a.id, b, false, a.entry, &rep.Destino)
+		case !p.okA && p.okB:
+			err = v.applySync(target, b.id, a, false, b.entry, &rep.Origem)
+		case sameContent(a.entry, b.entry):
+			// nada a fazer
+		default:
+			mudouA, mudouB := v.changedSince(idT, a), target.changedSince(idV, b)
+			switch {
+			case mudouA && !mudouB:
+				err = target.applySync(v, a.id, b, true, a.entry, &rep.Destino)
+			case !mudouA && mudouB:
+				err = v.applySync(target, b.id, a, true, b.entry, &rep.Origem)
+			default:
+				c := SyncConflict{Local: a.entry.Local, Nosso: a.entry, Deles: b.entry}
+				rep.Conflitos = append(rep.Conflitos, c)
+				var res Entry
+				if res, err = resolver(c); err != nil {
+					return rep, err
+				}
+				if res.Local == "" {
+					res.Local = a.entry.Local
+				}
+				if !sameContent(res, a.entry) {
+					if err = v.applySync(target, b.id, a, true, res, &rep.Origem); err != nil {
+						return rep, err
+					}
+				}
+				if !sameContent(res, b.entry) {
+					err = target.applySync(v, a.id, b, true, res, &rep.Destino)
+				}
+			}
+		}
+		if err != nil {
+			return rep, err
+		}
+	}
+
+	// grava a revisão atual de cada entrada como base da próxima sincronização
+	if err := v.markSynced(idT); err != nil {
+		return rep, err
+	}
+	return rep, target.markSynced(idV)
+}
+
+// troca o ID do registro r pelo id do outro cofre, levando junto as
+// revisões já sincronizadas. Se id já está em uso em v, fica o atual.
+func (v *Vault) adoptID(r *syncRecord, id string) error {
+	if v.hasID(id) {
+		return nil
+	}
+	eid, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return corrupted("id da entrada", err)
+	}
+	if err := v.putEntry(r.pos, eid, r.entry); err != nil {
+		return err
+	}
+	for peer, base := range v.file.Sincronia {
+		rev, ok := base[r.id]
+		if !ok {
+			continue
+		}
+		// mapa novo: o de antes pode estar guardado em saveState
+		nova := make(map[string]int, len(base))
+		for k, x := range base {
+			nova[k] = x
+		}
+		delete(nova, r.id)
+		nova[id] = rev
+		v.file.Sincronia[peer] = nova
+	}
+	r.id = id
+	return nil
+}
+
+// registra as revisões atuais como sincronizadas com o cofre peer
+func (v *Vault) markSynced(peer string) error {
+	base := make(map[string]int, len(v.file.Entradas))
+	for _, e := range v.file.Entradas {
+		plain, err := v.decryptEntry(e)
+		if err != nil {
+			return err
+		}
+		base[e.ID] = plain.Revisao
+	}
+	if v.file.Sincronia == nil {
+		v.file.Sincronia = map[string]map[string]int{}
+	}
+	v.file.Sincronia[peer] = base
+	return nil
+}
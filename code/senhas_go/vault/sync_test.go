@@ -0,0 +1,255 @@
+// sync_test.go
+
+/*
+Testes do Sync bidirecional: propagação de alterações, remoções e conflitos
+*/
+package vault_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+// cria dois cofres vazios para sincronizar
+func doisCofres(t *testing.T) (*vault.Vault, *vault.Vault, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	pa, pb := filepath.Join(dir, "laptop.json"), filepath.Join(dir, "compartilhado.json")
+	a, err := vault.CreateVaultWithKDF(pa, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := vault.CreateVaultWithKDF(pb, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b, pa, pb
+}
+
+func locais(t *testing.T, v *vault.Vault) []string {
+	t.Helper()
+	ls, err := v.ListLocais()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ls)
+	return ls
+}
+
+func sincronizar(t *testing.T, a, b *vault.Vault, r vault.ConflictResolver) vault.SyncReport {
+	t.Helper()
+	rep, err := a.Sync(b, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+func TestSyncBidirecional(t *testing.T) {
+	a, b, pa, pb := doisCofres(t)
+	a.AddLocal("siteA", "userA", "passA")
+	a.AddLocal("siteB", "userB", "passB")
+	b.AddLocal("siteC", "userC", "passC")
+
+	rep := sincronizar(t, a, b, nil)
+	if !reflect.DeepEqual(rep.Destino.Adicionadas, []string{"siteA", "siteB"}) ||
+		!reflect.DeepEqual(rep.Origem.Adicionadas, []string{"siteC"}) {
+		t.Fatalf("relatório inesperado: %+v", rep)
+	}
+	esperado := []string{"siteA", "siteB", "siteC"}
+	if !reflect.DeepEqual(locais(t, a), esperado) || !reflect.DeepEqual(locais(t, b), esperado) {
+		t.Fatal("cofres diferentes após sync")
+	}
+
+	// alteração de um lado só vai para o outro, sem conflito
+	a.UpdateLocal("siteA", "userA", "nova")
+	b.DeleteLocal("siteB")
+
+	// reabre do disco: a base da última sincronização é persistida
+	a, _ = vault.OpenVault(pa, "Senha123", storageTeste)
+	b, _ = vault.OpenVault(pb, "Senha123", storageTeste)
+	rep = sincronizar(t, a, b, nil)
+	if len(rep.Conflitos) != 0 {
+		t.Fatalf("conflito inesperado: %+v", rep.Conflitos)
+	}
+	if !reflect.DeepEqual(rep.Destino.Atualizadas, []string{"siteA"}) ||
+		!reflect.DeepEqual(rep.Origem.Apagadas, []string{"siteB"}) {
+		t.Fatalf("relatório inesperado: %+v", rep)
+	}
+	if _, p, _ := b.GetCredenciais("siteA"); p != "nova" {
+		t.Fatal("atualização não propagou")
+	}
+	if _, _, err := a.GetCredenciais("siteB"); err == nil {
+		t.Fatal("remoção não propagou")
+	}
+
+	// sem alterações, um novo sync não faz nada
+	rep = sincronizar(t, b, a, nil)
+	if !reflect.DeepEqual(rep, vault.SyncReport{}) {
+		t.Fatalf("sync repetido alterou algo: %+v", rep)
+	}
+}
+
+func TestSyncConflitos(t *testing.T) {
+	a, b, _, _ := doisCofres(t)
+	a.AddLocal("site", "user", "base")
+	sincronizar(t, a, b, nil)
+
+	// os dois lados alteram: o mais recente vence por padrão
+	a.UpdateLocal("site", "user", "do-laptop")
+	b.UpdateLocal("site", "user", "do-compartilhado")
+	rep := sincronizar(t, a, b, nil)
+	if len(rep.Conflitos) != 1 || rep.Conflitos[0].Local != "site" {
+		t.Fatalf("conflito não detectado: %+v", rep)
+	}
+	for _, v := range []*vault.Vault{a, b} {
+		if _, p, _ := v.GetCredenciais("site"); p != "do-compartilhado" {
+			t.Fatalf("PreferNewest escolheu %q", p)
+		}
+	}
+
+	// estratégia do chamador
+	a.UpdateLocal("site", "user", "x")
+	b.UpdateLocal("site", "user", "y")
+	rep = sincronizar(t, a, b, func(c vault.SyncConflict) (vault.Entry, error) {
+		e := c.Nosso
+		e.Senha = c.Nosso.Senha + c.Deles.Senha
+		return e, nil
+	})
+	if len(rep.Conflitos) != 1 {
+		t.Fatalf("conflito não detectado: %+v", rep)
+	}
+	for _, v := range []*vault.Vault{a, b} {
+		if _, p, _ := v.GetCredenciais("site"); p != "xy" {
+			t.Fatalf("resolução do chamador não aplicada: %q", p)
+		}
+	}
+
+	// remoção de um lado contra edição do outro
+	a.DeleteLocal("site")
+	b.UpdateLocal("site", "user", "editada")
+	rep = sincronizar(t, a, b, vault.PreferTheirs)
+	if len(rep.Conflitos) != 1 || !rep.Conflitos[0].Nosso.Removido {
+		t.Fatalf("conflito remoção x edição não detectado: %+v", rep)
+	}
+	if _, p, err := a.GetCredenciais("site"); err != nil || p != "editada" {
+		t.Fatalf("PreferTheirs não restaurou a entrada: %q %v", p, err)
+	}
+}
+
+func TestSyncRenomeia(t *testing.T) {
+	a, b, _, _ := doisCofres(t)
+	a.AddLocal("antigo", "user", "pass")
+	sincronizar(t, a, b, nil)
+	if err := a.UpdateLocal("antigo", "user", "pass2"); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+
+	// renomear é alterar a mesma entrada, dos dois lados
+	e, _ := a.GetEntry("antigo")
+	e.Local = "novo"
+	if err := a.UpdateEntry("antigo", e); err != nil {
+		t.Fatal(err)
+	}
+	rep := sincronizar(t, a, b, nil)
+	if len(rep.Destino.Apagadas) != 0 || len(rep.Destino.Adicionadas) != 0 ||
+		!reflect.DeepEqual(rep.Destino.Atualizadas, []string{"novo"}) {
+		t.Fatalf("renomeação não propagou como alteração: %+v", rep)
+	}
+	if !reflect.DeepEqual(locais(t, b), []string{"novo"}) {
+		t.Fatalf("locais no destino: %v", locais(t, b))
+	}
+	if h, err := b.History("novo"); err != nil || len(h) != 1 || h[0].Senha != "pass" {
+		t.Fatalf("histórico perdido na renomeação: %+v %v", h, err)
+	}
+	e, _ = b.GetEntry("novo")
+	e.Local = "outro"
+	if err := b.UpdateEntry("novo", e); err != nil {
+		t.Fatal(err)
+	}
+	rep = sincronizar(t, a, b, nil)
+	if !reflect.DeepEqual(rep.Origem.Atualizadas, []string{"outro"}) || !reflect.DeepEqual(locais(t, a), []string{"outro"}) {
+		t.Fatalf("renomeação no alvo: %+v %v", rep, locais(t, a))
+	}
+
+	// o nome antigo fica livre para uma entrada nova
+	if err := a.AddLocal("antigo", "user", "de-volta"); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+	if _, p, _ := b.GetCredenciais("antigo"); p != "de-volta" {
+		t.Fatal("local novo não propagou")
+	}
+
+	// entradas criadas em separado casam pelo local e passam a ter o mesmo ID
+	a.AddLocal("wifi", "casa", "w1")
+	b.AddLocal("wifi", "casa", "w1")
+	sincronizar(t, a, b, nil)
+	e, _ = b.GetEntry("wifi")
+	e.Local = "wifi-casa"
+	if err := b.UpdateEntry("wifi", e); err != nil {
+		t.Fatal(err)
+	}
+	rep = sincronizar(t, a, b, nil)
+	if !reflect.DeepEqual(rep.Origem.Atualizadas, []string{"wifi-casa"}) || len(rep.Origem.Adicionadas) != 0 {
+		t.Fatalf("renomeação de entrada criada em separado: %+v", rep)
+	}
+
+	// renomear para um nome que o outro lado criou à parte não junta as duas
+	a.AddLocal("vpn", "u", "v1")
+	sincronizar(t, a, b, nil)
+	e, _ = a.GetEntry("vpn")
+	e.Local = "vpn2"
+	if err := a.UpdateEntry("vpn", e); err != nil {
+		t.Fatal(err)
+	}
+	b.AddLocal("vpn2", "outro", "v2")
+	if _, err := a.Sync(b, nil); !errors.Is(err, vault.ErrDuplicate) {
+		t.Fatalf("nome repetido: esperado ErrDuplicate, achou %v", err)
+	}
+}
+
+// gravação que falha no destino não deixa nada pela metade em memória
+func TestSyncGravacaoFalha(t *testing.T) {
+	a, b, _, pb := doisCofres(t)
+	a.AddLocal("siteA", "userA", "passA")
+	b.AddLocal("siteB", "userB", "passB")
+
+	// outro processo grava o destino: b fica desatualizado
+	outro, err := vault.OpenVault(pb, "Senha123", storageTeste)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := outro.AddLocal("siteC", "userC", "passC"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Sync(b, nil); !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("esperado ErrConflict, achou %v", err)
+	}
+	if ls := locais(t, a); !reflect.DeepEqual(ls, []string{"siteA"}) {
+		t.Fatalf("origem alterada: %v", ls)
+	}
+	if ls := locais(t, b); !reflect.DeepEqual(ls, []string{"siteB"}) {
+		t.Fatalf("destino alterado: %v", ls)
+	}
+	if err := b.DeleteLocal("siteB"); !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("DeleteLocal: esperado ErrConflict, achou %v", err)
+	}
+	if ls := locais(t, b); !reflect.DeepEqual(ls, []string{"siteB"}) {
+		t.Fatalf("lápide não gravada ficou em memória: %v", ls)
+	}
+
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	sincronizar(t, a, b, nil)
+	if ls := locais(t, a); !reflect.DeepEqual(ls, []string{"siteA", "siteB", "siteC"}) {
+		t.Fatalf("origem após Reload: %v", ls)
+	}
+}
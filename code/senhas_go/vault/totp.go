@@ -0,0 +1,188 @@
+// totp.go
+// Geração de códigos TOTP (RFC 6238) a partir do segredo guardado na entrada.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTPConfig é o conteúdo de uma URI otpauth://totp/...
+type TOTPConfig struct {
+	Segredo   []byte
+	Algoritmo string // SHA1, SHA256 ou SHA512
+	Digitos   int    // 6 ou 8
+	Periodo   int    // em segundos
+	Emissor   string
+	Conta     string
+}
+
+// ParseTOTP interpreta uma URI otpauth://totp/... ou um segredo base32 puro
+// (nesse caso assume SHA1, 6 dígitos e 30 segundos, como o Google Authenticator)
+func ParseTOTP(s string) (TOTPConfig, error) {
+	c := TOTPConfig{Algoritmo: "SHA1", Digitos: 6, Periodo: 30}
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		seg, err := decodeBase32(s)
+		if err != nil {
+			return TOTPConfig{}, err
+		}
+		c.Segredo = seg
+		return c, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return TOTPConfig{}, err
+	}
+	if strings.ToLower(u.Host) != "totp" {
+		return TOTPConfig{}, fmt.Errorf("tipo otp não suportado: %q", u.Host)
+	}
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		c.Emissor, c.Conta = label[:i], strings.TrimSpace(label[i+1:])
+	} else {
+		c.Conta = label
+	}
+	q := u.Query()
+	if c.Segredo, err = decodeBase32(q.Get("secret")); err != nil {
+		return TOTPConfig{}, err
+	}
+	if e := q.Get("issuer"); e != "" {
+		c.Emissor = e
+	}
+	if a := q.Get("algorithm"); a != "" {
+		c.Algoritmo = strings.ToUpper(a)
+	}
+	if d := q.Get("digits"); d != "" {
+		if c.Digitos, err = strconv.Atoi(d); err != nil {
+			return TOTPConfig{}, fmt.Errorf("digits inválido: %q", d)
+		}
+	}
+	if p := q.Get("period"); p != "" {
+		if c.Periodo, err = strconv.Atoi(p); err != nil {
+			return TOTPConfig{}, fmt.Errorf("period inválido: %q", p)
+		}
+	}
+	if err := c.validate(); err != nil {
+		return TOTPConfig{}, err
+	}
+	return c, nil
+}
+
+func (c TOTPConfig) validate() error {
+	if len(c.Segredo) == 0 {
+		return errors.New("segredo totp vazio")
+	}
+	if c.hash() == nil {
+		return fmt.Errorf("algoritmo totp não suportado: %q", c.Algoritmo)
+	}
+	if c.Digitos != 6 && c.Digitos != 8 {
+		return fmt.Errorf("dígitos totp não suportados: %d", c.Digitos)
+	}
+	if c.Periodo < 1 {
+		return fmt.Errorf("período totp inválido: %d", c.Periodo)
+	}
+	return nil
+}
+
+func (c TOTPConfig) hash() func() hash.Hash {
+	switch c.Algoritmo {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// URI monta a representação otpauth:// da configuração
+func (c TOTPConfig) URI() string {
+	label := c.Conta
+	if c.Emissor != "" {
+		label = c.Emissor + ":" + c.Conta
+	}
+	q := url.Values{}
+	q.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c.Segredo))
+	if c.Emissor != "" {
+		q.Set("issuer", c.Emissor)
+	}
+	q.Set("algorithm", c.Algoritmo)
+	q.Set("digits", strconv.Itoa(c.Digitos))
+	q.Set("period", strconv.Itoa(c.Periodo))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Code calcula o código válido no instante at e quantos segundos faltam
+// para ele expirar
+func (c TOTPConfig) Code(at time.Time) (codigo string, restante int) {
+	t := at.Unix()
+	if t < 0 {
+		t = 0
+	}
+	contador := uint64(t) / uint64(c.Periodo)
+	restante = c.Periodo - int(uint64(t)%uint64(c.Periodo))
+	return hotp(c.hash(), c.Segredo, contador, c.Digitos), restante
+}
+
+// HOTP (RFC 4226) com truncamento dinâmico
+func hotp(h func() hash.Hash, segredo []byte, contador uint64, digitos int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], contador)
+	mac := hmac.New(h, segredo)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digitos; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digitos, bin%mod)
+}
+
+// base32 tolerante: ignora espaços, caixa e padding
+func decodeBase32(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, errors.New("segredo totp vazio")
+	}
+	seg, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("segredo totp inválido: %w", err)
+	}
+	return seg, nil
+}
+
+// GenerateTOTP gera o código TOTP do local no instante at, retornando
+// também os segundos que faltam para o código mudar
+func (v *Vault) GenerateTOTP(local string, at time.Time) (codigo string, restante int, err error) {
+	e, err := v.GetEntry(local)
+	if err != nil {
+		return "", 0, err
+	}
+	if e.TOTP == "" {
+		return "", 0, fmt.Errorf("local %q não tem totp", local)
+	}
+	c, err := ParseTOTP(e.TOTP)
+	if err != nil {
+		return "", 0, err
+	}
+	codigo, restante = c.Code(at)
+	return codigo, restante, nil
+}
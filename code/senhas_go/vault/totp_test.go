@@ -0,0 +1,96 @@
+// totp_test.go
+
+/*
+Testes de TOTP contra os vetores do RFC 6238 (apêndice B)
+*/
+package vault_test
+
+import (
+	"encoding/base32"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cleutonsampaio/senhas/vault"
+)
+
+func TestTOTPVetoresRFC6238(t *testing.T) {
+	segredos := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vetores := []struct {
+		t    int64
+		alg  string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, vt := range vetores {
+		c := vault.TOTPConfig{Segredo: []byte(segredos[vt.alg]), Algoritmo: vt.alg, Digitos: 8, Periodo: 30}
+		// ida e volta pela URI, para testar o parser junto
+		c2, err := vault.ParseTOTP(c.URI())
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, restante := c2.Code(time.Unix(vt.t, 0))
+		if code != vt.code {
+			t.Errorf("t=%d %s: esperado %s, achou %s", vt.t, vt.alg, vt.code, code)
+		}
+		if esperado := 30 - int(vt.t%30); restante != esperado {
+			t.Errorf("t=%d: restante esperado %d, achou %d", vt.t, esperado, restante)
+		}
+	}
+}
+
+func TestGenerateTOTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cofre.json")
+	v, err := vault.CreateVaultWithKDF(path, "Senha123", storageTeste, kdfRapido)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	uri := "otpauth://totp/Exemplo:alice@exemplo.com?secret=" + seg + "&issuer=Exemplo&digits=6&period=60"
+	if err := v.AddEntry(vault.Entry{Local: "exemplo", Usuario: "alice", Senha: "x", TOTP: uri}); err != nil {
+		t.Fatal(err)
+	}
+	code, restante, err := v.GenerateTOTP("exemplo", time.Unix(1111111111, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := vault.ParseTOTP(uri)
+	if c.Emissor != "Exemplo" || c.Conta != "alice@exemplo.com" || c.Periodo != 60 {
+		t.Fatalf("uri interpretada errado: %+v", c)
+	}
+	if len(code) != 6 || restante != 60-int(1111111111%60) {
+		t.Fatalf("código %q restante %d", code, restante)
+	}
+
+	if err := v.AddLocal("sem2fa", "u", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v.GenerateTOTP("sem2fa", time.Now()); err == nil {
+		t.Fatal("gerou totp para entrada sem segredo")
+	}
+	if err := v.AddEntry(vault.Entry{Local: "ruim", TOTP: "otpauth://totp/x?secret=" + seg + "&digits=7"}); err == nil {
+		t.Fatal("aceitou totp com 7 dígitos")
+	}
+}
@@ -7,17 +7,16 @@ package vault
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdh"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
-
-	"golang.org/x/crypto/hkdf"
-	"golang.org/x/crypto/pbkdf2"
+	"io/fs"
 )
 
 // Interface de persistência: salvar e carregar o JSON bruto do cofre.
@@ -26,16 +25,60 @@ type Storage interface {
 	Load(path string) ([]byte, error)
 }
 
+// Storage com controle de versão: persist() usa SaveVersion com a versão
+// lida na abertura e recebe ErrConflict se o conteúdo gravado mudou.
+type VersionedStorage interface {
+	Storage
+	LoadVersion(path string) (data []byte, version string, err error)
+	SaveVersion(path string, data []byte, version string) (newVersion string, err error)
+}
+
+// Storage que grava e lê em fluxo, sem montar o conteúdo inteiro em
+// memória. Usado pelos anexos; sem ele, o blob passa por Save/Load.
+type StreamStorage interface {
+	Storage
+	SaveStream(path string, r io.Reader) error
+	LoadStream(path string) (io.ReadCloser, error)
+}
+
+// Storage que sabe apagar: usado para os blobs de anexos removidos.
+// Remove de um caminho que não existe não é erro.
+type RemovableStorage interface {
+	Storage
+	Remove(path string) error
+}
+
+// Storage que acrescenta linhas ao fim de um arquivo sem reescrevê-lo nem
+// fazer backup. Usado pelo log de auditoria; sem ele, o log inteiro é
+// relido e regravado a cada registro.
+type AppendStorage interface {
+	Storage
+	// AppendLine trava path e passa a next a última linha do arquivo (nil
+	// se vazio ou inexistente). Acrescenta a linha que next retornar e
+	// depois substitui o arquivo topo pelo conteúdo retornado para ele,
+	// tudo sob a mesma trava.
+	AppendLine(path, topo string, next func(ultima []byte) (linha, conteudo []byte, err error)) error
+}
+
 // estrutura interna do cabeçalho
 type header struct {
-	Salt     string `json:"salt"`
-	Iter     int    `json:"iteracoes"`
-	TagCheck string `json:"tag_check"`
+	ID       string     `json:"id,omitempty"`        // identifica o cofre no Sync
+	Salt     string     `json:"salt,omitempty"`      // vazio em cofre compartilhado
+	Iter     int        `json:"iteracoes,omitempty"` // só em cofres antigos (pbkdf2)
+	KDF      *KDFParams `json:"kdf,omitempty"`
+	TagCheck string     `json:"tag_check"`
+	Membros  []member   `json:"membros,omitempty"` // cofre compartilhado
+	// chave de cifra embrulhada para a chave de recuperação
+	Recuperacao *member    `json:"recuperacao,omitempty"`
+	Auditoria   *auditHead `json:"auditoria,omitempty"` // topo do log de auditoria (ver EnableAuditLog)
+	Versao      uint64     `json:"versao,omitempty"`    // incrementada a cada gravação
+	MAC         string     `json:"mac,omitempty"`       // HMAC do cabeçalho e das entradas
 }
 
 // estrutura de cada entrada cifrada
 type entry struct {
 	ID     string `json:"id"`
+	Indice string `json:"indice,omitempty"` // HMAC do local, para busca
 	IV     string `json:"iv"`
 	Cipher string `json:"cipher"`
 }
@@ -44,77 +87,398 @@ type entry struct {
 type vaultFile struct {
 	Cabecalho header  `json:"cabecalho"`
 	Entradas  []entry `json:"entradas"`
+	// revisão de cada entrada (por ID) na última sincronização com cada cofre
+	Sincronia map[string]map[string]int `json:"sincronia,omitempty"`
 }
 
 // Vault é o objeto ativo em memória
 // guarda o conteúdo e a chave de cifra
 type Vault struct {
 	file     vaultFile
-	key      []byte // Kenc
+	key      []byte   // Kenc
+	idxKey   []byte   // chave do índice de busca
+	chaves   *keyRing // área onde key e idxKey vivem (ver secret.go)
+	segredos []*Secret
+	index    map[string][]int
 	backend  Storage
 	filePath string
+	version  string // versão lida/gravada, se o backend for VersionedStorage
+	membro   string // membro que abriu o cofre compartilhado
+	tagNova  string // tag v2 a gravar no próximo persist de um cofre anterior ao MAC
+	ator     string // quem aparece nos registros de auditoria (ver SetActor)
 }
 
-// Deriva chaves de autenticação e cifra a partir da senha-mestre
-func deriveKeys(senha []byte, salt []byte, iter int) (kauth, kenc []byte) {
-	// PBKDF2-HMAC-SHA256
-	mk := pbkdf2.Key(senha, salt, iter, 32, sha256.New)
-	// HKDF-Extract
-	extract := hkdf.New(sha256.New, mk, nil, nil)
-	kauth = make([]byte, 32)
-	io.ReadFull(extract, kauth)
-	// Expand para kenc
-	expander := hkdf.New(sha256.New, mk, nil, []byte("cifragem"))
-	kenc = make([]byte, 32)
-	expander.Read(kenc)
-	return
+// Cria um novo cofre e persiste, usando DefaultKDF
+func CreateVault(path string, senha string, storage Storage) (*Vault, error) {
+	return CreateVaultWithKDF(path, senha, storage, DefaultKDF)
 }
 
-// Cria um novo cofre e persiste
-func CreateVault(path string, senha string, storage Storage) (*Vault, error) {
-	salt := make([]byte, 16)
-	rand.Read(salt)
-	kauth, kenc := deriveKeys([]byte(senha), salt, 200000)
-	// tag de verificação
-	h := hmac.New(sha256.New, kauth)
-	h.Write([]byte("CHECK_VAULT_V1"))
-	tag := h.Sum(nil)
+// Cria um novo cofre com o algoritmo de derivação escolhido
+func CreateVaultWithKDF(path string, senha string, storage Storage, kdf KDFParams) (*Vault, error) {
+	cab, kenc, err := newHeader(senha, kdf)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kenc)
+	if cab.ID, err = newVaultID(); err != nil {
+		return nil, err
+	}
+	return newVault(path, storage, cab, kenc)
+}
+
+// monta o cofre vazio com o cabeçalho dado e grava
+func newVault(path string, storage Storage, cab header, kenc []byte) (*Vault, error) {
 	vf := vaultFile{
-		Cabecalho: header{
-			Salt:     base64.StdEncoding.EncodeToString(salt),
-			Iter:     200000,
-			TagCheck: base64.StdEncoding.EncodeToString(tag),
-		},
-		Entradas: []entry{},
-	}
-	data, _ := json.MarshalIndent(vf, "", "  ")
-	if err := storage.Save(path, data); err != nil {
+		Cabecalho: cab,
+		Entradas:  []entry{},
+	}
+	v := &Vault{file: vf, backend: storage, filePath: path}
+	if err := v.setKey(kenc); err != nil {
+		return nil, err
+	}
+	if vs, ok := storage.(VersionedStorage); ok {
+		// CreateVault sobrescreve um cofre existente
+		_, ver, err := vs.LoadVersion(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		v.version = ver
+	}
+	if err := v.persist(); err != nil {
 		return nil, err
 	}
-	return &Vault{file: vf, key: kenc, backend: storage, filePath: path}, nil
+	return v, nil
 }
 
-// Abre um cofre existente, valida senha (sem decifrar entradas)
+// Abre um cofre existente, valida senha (sem decifrar entradas).
+// Senha errada retorna ErrWrongPassword; arquivo inválido ou adulterado
+// (MAC do cofre não confere), ErrCorrupted. Num cofre compartilhado a
+// senha é testada em cada membro por senha (uma derivação por membro);
+// OpenVaultMember vai direto ao membro.
 func OpenVault(path string, senha string, storage Storage) (*Vault, error) {
-	raw, err := storage.Load(path)
+	vf, version, err := loadFile(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	if vf.shared() {
+		return openShared(vf, storage, path, version, func(m member) (*ecdh.PrivateKey, error) {
+			if m.Privada == "" {
+				return nil, ErrWrongPassword
+			}
+			return m.openPrivate(senha, vf.Cabecalho.ID)
+		})
+	}
+	// decodifica salt e tag
+	salt, err := base64.StdEncoding.DecodeString(vf.Cabecalho.Salt)
+	if err != nil {
+		return nil, corrupted("salt", err)
+	}
+	tagStored, err := base64.StdEncoding.DecodeString(vf.Cabecalho.TagCheck)
+	if err != nil {
+		return nil, corrupted("tag_check", err)
+	}
+	if len(salt) == 0 || len(tagStored) != sha256.Size {
+		return nil, corrupted("cabeçalho", errors.New("salt ou tag_check ausente"))
+	}
+	kauth, kenc, err := deriveKeys([]byte(senha), salt, vf.Cabecalho.kdf())
+	if err != nil {
+		return nil, corrupted("kdf", err)
+	}
+	// o cofre aberto guarda a própria cópia de kenc
+	defer wipe(kauth)
+	defer wipe(kenc)
+	// verifica tag; a v1 é de cofres anteriores ao MAC
+	legado, err := matchTag(tagStored, kauth)
 	if err != nil {
 		return nil, err
 	}
+	v, err := openedVault(vf, kenc, storage, path, version, legado)
+	if err != nil {
+		return nil, err
+	}
+	if legado {
+		// com a tag v2, gravada junto com o primeiro MAC, o MAC passa a
+		// ser obrigatório
+		v.tagNova = base64.StdEncoding.EncodeToString(checkTag(kauth))
+	}
+	return v, nil
+}
+
+// lê e interpreta o arquivo do cofre
+func loadFile(storage Storage, path string) (vaultFile, string, error) {
+	var (
+		raw     []byte
+		version string
+		err     error
+	)
+	if vs, ok := storage.(VersionedStorage); ok {
+		raw, version, err = vs.LoadVersion(path)
+	} else {
+		raw, err = storage.Load(path)
+	}
+	if err != nil {
+		return vaultFile{}, "", err
+	}
 	var vf vaultFile
 	if err := json.Unmarshal(raw, &vf); err != nil {
+		return vaultFile{}, "", corrupted("json do cofre", err)
+	}
+	return vf, version, nil
+}
+
+// confere o MAC e monta o cofre aberto com a chave de cifra. legado
+// indica a tag v1, a única que aceita um cofre sem MAC.
+func openedVault(vf vaultFile, kenc []byte, storage Storage, path, version string, legado bool) (*Vault, error) {
+	if err := verifyMAC(kenc, vf, legado); err != nil {
 		return nil, err
 	}
-	// decodifica salt e tag
-	salt, _ := base64.StdEncoding.DecodeString(vf.Cabecalho.Salt)
-	tagStored, _ := base64.StdEncoding.DecodeString(vf.Cabecalho.TagCheck)
-	kauth, kenc := deriveKeys([]byte(senha), salt, vf.Cabecalho.Iter)
-	// verifica tag
+	if vf.Cabecalho.ID == "" {
+		// cofre antigo: ganha um ID, gravado no próximo persist
+		var err error
+		if vf.Cabecalho.ID, err = newVaultID(); err != nil {
+			return nil, err
+		}
+	}
+	v := &Vault{file: vf, backend: storage, filePath: path, version: version}
+	if err := v.setKey(kenc); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Abre o cofre e, se algum custo do kdf gravado for menor que o de kdf,
+// re-cifra tudo com a mesma senha, subindo cada custo ao maior dos dois
+func OpenVaultRekey(path string, senha string, storage Storage, kdf KDFParams) (*Vault, error) {
+	v, err := OpenVault(path, senha, storage)
+	if err != nil {
+		return nil, err
+	}
+	if alvo := v.KDF().upgrade(kdf); alvo != v.KDF() {
+		if err := v.Rekey(senha, alvo); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// KDF retorna os parâmetros de derivação em uso pelo cofre (num cofre
+// compartilhado, os do membro que o abriu)
+func (v *Vault) KDF() KDFParams {
+	if v.Shared() {
+		for _, m := range v.file.Cabecalho.Membros {
+			if m.Nome == v.membro && m.KDF != nil {
+				return *m.KDF
+			}
+		}
+		return DefaultKDF
+	}
+	return v.file.Cabecalho.kdf()
+}
+
+// Lock tranca o cofre: zera as chaves em memória e os Secrets ainda não
+// destruídos. Depois disso as operações que decifram ou cifram retornam
+// ErrLocked.
+func (v *Vault) Lock() {
+	v.chaves.free()
+	for _, s := range v.segredos {
+		s.Destroy()
+	}
+	v.key, v.idxKey, v.chaves, v.segredos, v.index = nil, nil, nil, nil, nil
+}
+
+// Locked indica se o cofre foi trancado
+func (v *Vault) Locked() bool {
+	return v.key == nil
+}
+
+// Reload relê o cofre do armazenamento mantendo as chaves em memória,
+// para quem guarda o Vault aberto (como um agente) ver as gravações de
+// outros processos. Falha se a senha-mestre ou a derivação mudaram.
+func (v *Vault) Reload() error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	var (
+		raw     []byte
+		version string
+		err     error
+	)
+	if vs, ok := v.backend.(VersionedStorage); ok {
+		raw, version, err = vs.LoadVersion(v.filePath)
+		if err == nil && version == v.version {
+			return nil
+		}
+	} else {
+		raw, err = v.backend.Load(v.filePath)
+	}
+	if err != nil {
+		return err
+	}
+	var vf vaultFile
+	if err := json.Unmarshal(raw, &vf); err != nil {
+		return corrupted("json do cofre", err)
+	}
+	// outro processo pode ter gravado a tag v2 de um cofre legado
+	tag := vf.Cabecalho.TagCheck
+	if vf.Cabecalho.Salt != v.file.Cabecalho.Salt || (tag != v.file.Cabecalho.TagCheck && tag != v.tagNova) {
+		return fmt.Errorf("%w: senha-mestre, derivação ou chave do cofre alterada; abra o cofre de novo", ErrWrongPassword)
+	}
+	legado := v.tagNova != "" && tag == v.file.Cabecalho.TagCheck
+	if err := verifyMAC(v.key, vf, legado); err != nil {
+		return err
+	}
+	if vf.Cabecalho.MAC == "" && v.file.Cabecalho.MAC != "" {
+		return corrupted("cabeçalho", errors.New("mac ausente"))
+	}
+	if vf.Cabecalho.Versao < v.file.Cabecalho.Versao {
+		return rollback(vf.Cabecalho.Versao, v.file.Cabecalho.Versao)
+	}
+	if vf.Cabecalho.ID == "" {
+		vf.Cabecalho.ID = v.file.Cabecalho.ID
+	}
+	if !legado {
+		v.tagNova = ""
+	}
+	v.file, v.version, v.index = vf, version, nil
+	return nil
+}
+
+// Rekey troca senha e/ou parâmetros de derivação: gera novo salt,
+// deriva chaves novas e re-cifra todas as entradas.
+// Parâmetros zerados significam DefaultKDF. Num cofre compartilhado troca
+// a senha do membro que abriu o cofre e gira a chave de dados.
+func (v *Vault) Rekey(novaSenha string, kdf KDFParams) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if kdf.Algoritmo == "" {
+		kdf = DefaultKDF
+	}
+	if v.Shared() {
+		return v.rekeyMember(novaSenha, kdf)
+	}
+	cab, kenc, err := newHeader(novaSenha, kdf)
+	if err != nil {
+		return err
+	}
+	defer wipe(kenc)
+	cab.ID, cab.Versao = v.file.Cabecalho.ID, v.file.Cabecalho.Versao
+	return v.replaceKey(cab, kenc)
+}
+
+// re-cifra todas as entradas com kenc, troca o cabeçalho e persiste;
+// se a gravação falhar, o cofre em memória volta ao que era
+func (v *Vault) replaceKey(cab header, kenc []byte) error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	if err := v.rewrapRecovery(&cab, kenc); err != nil {
+		return err
+	}
+	if err := v.rewrapAudit(&cab, kenc); err != nil {
+		return err
+	}
+	nova, err := newKeyRing(kenc)
+	if err != nil {
+		return err
+	}
+	novas := make([]entry, 0, len(v.file.Entradas))
+	for _, e := range v.file.Entradas {
+		ne, err := v.resealEntry(nova, e)
+		if err != nil {
+			nova.free()
+			return err
+		}
+		novas = append(novas, ne)
+	}
+	antigo, antigas, tagNova := v.file, v.chaves, v.tagNova
+	v.file = vaultFile{Cabecalho: cab, Entradas: novas, Sincronia: v.file.Sincronia}
+	v.useKeys(nova)
+	v.tagNova = "" // o cabeçalho novo já tem a tag v2
+	if err := v.persist(); err != nil {
+		v.file = antigo
+		v.tagNova = tagNova
+		v.useKeys(antigas)
+		nova.free()
+		return err
+	}
+	antigas.free()
+	return nil
+}
+
+// decifra a entrada com a chave atual e cifra de novo com a da área k
+func (v *Vault) resealEntry(k *keyRing, e entry) (entry, error) {
+	id, plain, err := openEntry(v.key, e)
+	if err != nil {
+		return entry{}, err
+	}
+	defer wipe(plain)
+	ne, err := sealEntry(k.enc(), id, plain)
+	if err != nil {
+		return entry{}, err
+	}
+	plainEntry, err := parsePayload(plain)
+	if err != nil {
+		return entry{}, err
+	}
+	ne.Indice = indexTag(k.idx(), plainEntry.Local)
+	return ne, nil
+}
+
+// monta um cabeçalho novo (salt, kdf e tag) e retorna a chave de cifra
+func newHeader(senha string, kdf KDFParams) (header, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return header{}, nil, err
+	}
+	kauth, kenc, err := deriveKeys([]byte(senha), salt, kdf)
+	if err != nil {
+		return header{}, nil, err
+	}
+	defer wipe(kauth)
+	return header{
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+		KDF:      &kdf,
+		TagCheck: base64.StdEncoding.EncodeToString(checkTag(kauth)),
+	}, kenc, nil
+}
+
+// identificador aleatório do cofre
+func newVaultID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+// tag de verificação da senha-mestre. O rótulo v2 marca os cofres com
+// MAC; sem ele, quem apagasse o MAC faria o cofre passar por legado.
+func checkTag(kauth []byte) []byte {
+	return tagWithLabel(kauth, "CHECK_VAULT_V2")
+}
+
+// tag dos cofres anteriores ao MAC
+func legacyCheckTag(kauth []byte) []byte {
+	return tagWithLabel(kauth, "CHECK_VAULT_V1")
+}
+
+func tagWithLabel(kauth []byte, rotulo string) []byte {
 	h := hmac.New(sha256.New, kauth)
-	h.Write([]byte("CHECK_VAULT_V1"))
-	if !hmac.Equal(tagStored, h.Sum(nil)) {
-		return nil, errors.New("senha-mestre incorreta")
+	h.Write([]byte(rotulo))
+	return h.Sum(nil)
+}
+
+// confere a tag gravada contra kauth; legado indica a tag v1.
+// Nenhuma das duas bate: ErrWrongPassword.
+func matchTag(tag, kauth []byte) (legado bool, err error) {
+	switch {
+	case hmac.Equal(tag, checkTag(kauth)):
+		return false, nil
+	case hmac.Equal(tag, legacyCheckTag(kauth)):
+		return true, nil
 	}
-	return &Vault{file: vf, key: kenc, backend: storage, filePath: path}, nil
+	return false, ErrWrongPassword
 }
 
 // lista todos os locais (nome decifrado)
@@ -125,6 +489,9 @@ func (v *Vault) ListLocais() ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		if plain.Removido {
+			continue
+		}
 		res = append(res, plain.Local)
 	}
 	return res, nil
@@ -132,66 +499,88 @@ func (v *Vault) ListLocais() ([]string, error) {
 
 // recupera usuario e senha de um local
 func (v *Vault) GetCredenciais(local string) (user, pass string, err error) {
-	for _, e := range v.file.Entradas {
-		plain, errD := v.decryptEntry(e)
-		if errD != nil {
-			continue
-		}
-		if plain.Local == local {
-			return plain.Usuario, plain.Senha, nil
-		}
+	pos, err := v.position(local)
+	if err != nil {
+		return "", "", err
+	}
+	plain, err := v.decryptEntry(v.file.Entradas[pos])
+	if err != nil {
+		return "", "", err
 	}
-	return "", "", errors.New("local não encontrado")
+	if err := v.audit(AuditRead, v.file.Entradas[pos].ID); err != nil {
+		return "", "", err
+	}
+	return plain.Usuario, plain.Senha, nil
 }
 
 // cria nova entrada
 func (v *Vault) AddLocal(local, usuario, senha string) error {
-	eid := make([]byte, 16)
-	rand.Read(eid)
-	iv := make([]byte, 12)
-	rand.Read(iv)
-	data := map[string]string{"local": local, "usuario": usuario, "senha": senha}
-	jsonB, _ := json.Marshal(data)
-	block, _ := aes.NewCipher(v.key)
-	aesgcm, _ := cipher.NewGCM(block)
-	cipherText := aesgcm.Seal(nil, iv, jsonB, eid)
-	v.file.Entradas = append(v.file.Entradas, entry{
-		ID:     base64.StdEncoding.EncodeToString(eid),
-		IV:     base64.StdEncoding.EncodeToString(iv),
-		Cipher: base64.StdEncoding.EncodeToString(cipherText),
-	})
-	return v.persist()
+	return v.AddEntry(Entry{Local: local, Usuario: usuario, Senha: senha})
 }
 
-// altera usuario/senha de um local existente
+// altera usuario/senha de um local existente (demais campos são mantidos)
 func (v *Vault) UpdateLocal(local, novoUser, novaSenha string) error {
-	// remove e re-adiciona
-	if err := v.DeleteLocal(local); err != nil {
+	_, e, err := v.getEntry(local)
+	if err != nil {
 		return err
 	}
-	return v.AddLocal(local, novoUser, novaSenha)
+	e.Usuario, e.Senha = novoUser, novaSenha
+	return v.UpdateEntry(local, e)
 }
 
-// apaga um local
+// apaga um local. A entrada vira uma lápide (sem usuário nem senha)
+// para que a remoção se propague no Sync.
 func (v *Vault) DeleteLocal(local string) error {
-	novo := []entry{}
-	found := false
-	for _, e := range v.file.Entradas {
-		plain, err := v.decryptEntry(e)
-		if err == nil && plain.Local == local {
-			found = true
-			continue
+	pos, err := v.lookup(local)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return notFound(local)
+	}
+	// os blobs dos anexos só saem depois de gravar a lápide
+	var anexos []Attachment
+	for _, i := range pos {
+		e, err := v.decryptEntry(v.file.Entradas[i])
+		if err != nil {
+			return err
+		}
+		anexos = append(anexos, e.Anexos...)
+	}
+	id := v.file.Entradas[pos[0]].ID
+	// duplicatas de cofres antigos saem de vez; a primeira vira lápide
+	apagar := map[int]bool{}
+	for _, i := range pos[1:] {
+		apagar[i] = true
+	}
+	antes := v.saveState()
+	if err := v.tombstone(pos[0]); err != nil {
+		return err
+	}
+	if len(apagar) > 0 {
+		novo := []entry{}
+		for i, e := range v.file.Entradas {
+			if !apagar[i] {
+				novo = append(novo, e)
+			}
 		}
-		novo = append(novo, e)
+		v.file.Entradas = novo
+		v.index = nil
 	}
-	if !found {
-		return errors.New("local não encontrado")
+	err = v.audit(AuditDelete, id)
+	if err == nil {
+		err = v.persist()
 	}
-	v.file.Entradas = novo
-	return v.persist()
+	if err != nil {
+		v.restoreState(antes)
+		return err
+	}
+	v.removeBlobs(anexos)
+	return nil
 }
 
-// exporta todas as entradas em texto claro
+// exporta todas as entradas em texto claro. As senhas viram strings,
+// que não podem ser zeradas (ver GetPassword).
 func (v *Vault) ExportClear() ([]map[string]string, error) {
 	out := []map[string]string{}
 	for _, e := range v.file.Entradas {
@@ -199,58 +588,166 @@ func (v *Vault) ExportClear() ([]map[string]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		if plain.Removido {
+			continue
+		}
 		out = append(out, map[string]string{
 			"local":   plain.Local,
 			"usuario": plain.Usuario,
 			"senha":   plain.Senha,
 		})
 	}
+	if err := v.audit(AuditExport, ""); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
-// sincroniza entradas do vault v com outro target
-func (v *Vault) Sync(target *Vault) error {
-	locs, err := v.ListLocais()
+// entradas e bases de sincronia antes de uma alteração em memória, para
+// desfazê-la se a gravação falhar (persist já desfaz o cabeçalho)
+type fileState struct {
+	entradas  []entry
+	sincronia map[string]map[string]int
+}
+
+func (v *Vault) saveState() fileState {
+	s := fileState{entradas: append([]entry{}, v.file.Entradas...)}
+	if v.file.Sincronia != nil {
+		s.sincronia = make(map[string]map[string]int, len(v.file.Sincronia))
+		for peer, base := range v.file.Sincronia {
+			s.sincronia[peer] = base
+		}
+	}
+	return s
+}
+
+func (v *Vault) restoreState(s fileState) {
+	v.file.Entradas, v.file.Sincronia, v.index = s.entradas, s.sincronia, nil
+}
+
+// descarrega e persiste no backend, com a versão seguinte e o MAC novo
+func (v *Vault) persist() error {
+	if v.Locked() {
+		return ErrLocked
+	}
+	cab := v.file.Cabecalho
+	v.file.Cabecalho.Versao++
+	if v.tagNova != "" {
+		v.file.Cabecalho.TagCheck = v.tagNova
+	}
+	if v.AuditLogEnabled() {
+		if err := v.refreshAuditHead(); err != nil {
+			v.file.Cabecalho = cab
+			return err
+		}
+	}
+	if err := v.persistFile(); err != nil {
+		v.file.Cabecalho = cab
+		return err
+	}
+	v.tagNova = ""
+	return nil
+}
+
+func (v *Vault) persistFile() error {
+	mac, err := fileMAC(v.key, v.file)
 	if err != nil {
 		return err
 	}
-	for _, local := range locs {
-		u, s, _ := v.GetCredenciais(local)
-		target.DeleteLocal(local)
-		target.AddLocal(local, u, s)
+	v.file.Cabecalho.MAC = mac
+	data, err := json.MarshalIndent(v.file, "", "  ")
+	if err != nil {
+		return err
 	}
+	vs, ok := v.backend.(VersionedStorage)
+	if !ok {
+		return v.backend.Save(v.filePath, data)
+	}
+	ver, err := vs.SaveVersion(v.filePath, data, v.version)
+	if err != nil {
+		return err
+	}
+	v.version = ver
 	return nil
 }
 
-// descarrega e persiste no backend
-func (v *Vault) persist() error {
-	data, _ := json.MarshalIndent(v.file, "", "  ")
-	return v.backend.Save(v.filePath, data)
+// decryptEntry decifra e interpreta uma entrada
+func (v *Vault) decryptEntry(e entry) (Entry, error) {
+	if v.Locked() {
+		return Entry{}, ErrLocked
+	}
+	_, plain, err := openEntry(v.key, e)
+	if err != nil {
+		return Entry{}, err
+	}
+	return parsePayload(plain)
 }
 
-// decryptEntry retorna estrutura interna
-func (v *Vault) decryptEntry(e entry) (struct{ Local, Usuario, Senha string }, error) {
-	id, _ := base64.StdEncoding.DecodeString(e.ID)
-	iv, _ := base64.StdEncoding.DecodeString(e.IV)
-	ct, _ := base64.StdEncoding.DecodeString(e.Cipher)
-	block, _ := aes.NewCipher(v.key)
-	aesgcm, _ := cipher.NewGCM(block)
-	plain, err := aesgcm.Open(nil, iv, ct, id)
+// cifra o payload de uma entrada com AES-GCM, usando o ID como AAD
+func sealEntry(key, eid, plain []byte) (entry, error) {
+	iv, ct, err := gcmSeal(key, plain, eid)
 	if err != nil {
-		return struct{ Local, Usuario, Senha string }{}, err
+		return entry{}, err
 	}
-	var d map[string]string
-	json.Unmarshal(plain, &d)
-	return struct{ Local, Usuario, Senha string }{d["local"], d["usuario"], d["senha"]}, nil
+	return entry{
+		ID:     base64.StdEncoding.EncodeToString(eid),
+		IV:     base64.StdEncoding.EncodeToString(iv),
+		Cipher: base64.StdEncoding.EncodeToString(ct),
+	}, nil
 }
 
-// ------------------ exemplo de storage local ------------------
-
-type FileStorage struct{}
+// decifra o payload bruto de uma entrada, retornando também o ID decodificado
+// A chave já foi validada pela tag do cabeçalho: se a entrada não
+// autentica, foi alterada.
+func openEntry(key []byte, e entry) (id, plain []byte, err error) {
+	id, err = entryID(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(e.IV)
+	if err != nil {
+		return nil, nil, corrupted("iv da entrada", err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(e.Cipher)
+	if err != nil {
+		return nil, nil, corrupted("cipher da entrada", err)
+	}
+	plain, err = gcmOpen(key, iv, ct, id)
+	if err != nil {
+		return nil, nil, corrupted("entrada "+e.ID, err)
+	}
+	return id, plain, nil
+}
 
-func (fs FileStorage) Save(path string, data []byte) error {
-	return ioutil.WriteFile(path, data, 0600)
+// AES-GCM com IV aleatório de 12 bytes
+func gcmSeal(key, plain, aad []byte) (iv, ct []byte, err error) {
+	iv = make([]byte, 12)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return iv, aesgcm.Seal(nil, iv, plain, aad), nil
 }
-func (fs FileStorage) Load(path string) ([]byte, error) {
-	return ioutil.ReadFile(path)
+
+func gcmOpen(key, iv, ct, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// Open entra em pânico com IV de outro tamanho
+	if len(iv) != aesgcm.NonceSize() {
+		return nil, fmt.Errorf("iv com %d bytes", len(iv))
+	}
+	return aesgcm.Open(nil, iv, ct, aad)
 }
@@ -67,7 +67,7 @@ func TestVaultLocal(t *testing.T) {
 	}
 
 	// 7) sincroniza v1 -> v2
-	if err := v1.Sync(v2); err != nil {
+	if _, err := v1.Sync(v2, nil); err != nil {
 		t.Fatal(err)
 	}
 